@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const usage = `usage: bankctl <command> [flags]
+
+commands:
+  verify    check the transaction hash chain
+  audit     query the audit log by account and time range
+  apikey    create an API key for a subject
+  token     issue a signed bearer token (secret from BANK_TOKEN_SECRET)
+  principal manage principals: add, link, list
+  batch     apply deposits, withdrawals and transfers from a JSON file
+  balance   show the balance of an account at a point in time
+  rebuild   replay the event log of the eventsourced backend and snapshot it
+  backup    write a backup archive of the data files, also while the server runs
+  restore   check a backup archive and replace the data files with it`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "audit":
+		err = runAudit(os.Args[2:])
+	case "apikey":
+		err = runAPIKey(os.Args[2:])
+	case "token":
+		err = runToken(os.Args[2:])
+	case "principal":
+		err = runPrincipal(os.Args[2:])
+	case "batch":
+		err = runBatch(os.Args[2:])
+	case "balance":
+		err = runBalance(os.Args[2:])
+	case "rebuild":
+		err = runRebuild(os.Args[2:])
+	case "backup":
+		err = runBackup(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bankctl %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	accPath := flags.String("accounts", "data/accounts.json", "accounts file")
+	txPath := flags.String("transactions", "data/transactions.json", "transactions file")
+	flags.Parse(args)
+
+	// Checking the data must not rewrite it, so files of an older format
+	// are read as they are.
+	repo, err := storage.OpenFileStorage(*accPath, *txPath, storage.WithoutUpgrade())
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	txs, err := repo.LoadTransactions()
+	if err != nil {
+		return err
+	}
+
+	if err := storage.VerifyChain(txs); err != nil {
+		var chainErr *storage.ChainError
+		if errors.As(err, &chainErr) {
+			return fmt.Errorf("chain broken at transaction #%d (%s): %s",
+				chainErr.Index, chainErr.TransactionID, chainErr.Reason)
+		}
+		return err
+	}
+
+	fmt.Printf("chain ok: %d transactions verified\n", len(txs))
+	return nil
+}
+
+func runAudit(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	logPath := flags.String("log", "data/audit.jsonl", "audit log file")
+	accountID := flags.String("account", "", "only events for this account")
+	from := flags.String("from", "", "start of range, RFC 3339 (inclusive)")
+	to := flags.String("to", "", "end of range, RFC 3339 (exclusive)")
+	flags.Parse(args)
+
+	filter := audit.Filter{AccountID: *accountID}
+
+	var err error
+	if filter.From, err = parseTime(*from); err != nil {
+		return fmt.Errorf("parse -from: %w", err)
+	}
+	if filter.To, err = parseTime(*to); err != nil {
+		return fmt.Errorf("parse -to: %w", err)
+	}
+
+	events, err := audit.NewFileSink(*logPath).Query(filter)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func runAPIKey(args []string) error {
+	flags := flag.NewFlagSet("apikey", flag.ExitOnError)
+	keysPath := flags.String("keys", "data/api_keys.json", "api keys file")
+	subject := flags.String("subject", "", "identity the key authenticates as")
+	flags.Parse(args)
+
+	plain, key, err := auth.NewKeyStore(*keysPath).Create(*subject)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created key %s for %s; it is shown only once:\n%s\n", key.ID, key.Subject, plain)
+	return nil
+}
+
+func runToken(args []string) error {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	subject := flags.String("subject", "", "identity the token authenticates as")
+	ttl := flags.Duration("ttl", time.Hour, "token lifetime")
+	flags.Parse(args)
+
+	secret := os.Getenv("BANK_TOKEN_SECRET")
+	if secret == "" {
+		return fmt.Errorf("BANK_TOKEN_SECRET is not set")
+	}
+	if *subject == "" {
+		return fmt.Errorf("empty subject")
+	}
+	if *ttl <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	now := time.Now()
+	token, err := auth.SignToken([]byte(secret), auth.Claims{
+		Subject:   *subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(*ttl).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
+
+func runPrincipal(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected add, link or list")
+	}
+
+	flags := flag.NewFlagSet("principal "+args[0], flag.ExitOnError)
+	path := flags.String("principals", "data/principals.json", "principals file")
+	id := flags.String("id", "", "principal ID, the subject of its key or token")
+	name := flags.String("name", "", "display name (add)")
+	role := flags.String("role", "", "customer, teller, auditor or admin (add)")
+	accountID := flags.String("account", "", "account to link (link)")
+	flags.Parse(args[1:])
+
+	store := auth.NewPrincipalStore(*path)
+
+	switch args[0] {
+	case "add":
+		return store.Put(auth.Principal{ID: *id, Name: *name, Role: auth.Role(*role)})
+	case "link":
+		if *accountID == "" {
+			return fmt.Errorf("empty account")
+		}
+		return store.LinkAccount(*id, *accountID)
+	case "list":
+		principals, err := store.List()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(principals)
+	default:
+		return fmt.Errorf("unknown principal command %q", args[0])
+	}
+}
+
+// runBatch applies a JSON array of instructions, as accepted by POST
+// /batches, directly to the data files. It runs as the system actor, so
+// no authorization, approval or fraud checks apply.
+func runBatch(args []string) error {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	accPath := flags.String("accounts", "data/accounts.json", "accounts file")
+	txPath := flags.String("transactions", "data/transactions.json", "transactions file")
+	outboxPath := flags.String("outbox", "data/outbox.json", "outbox file")
+	auditPath := flags.String("audit", "data/audit.jsonl", "audit log file")
+	file := flags.String("file", "", "instructions file, - for stdin")
+	mode := flags.String("mode", string(service.BatchAtomic), "atomic or best_effort")
+	flags.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("empty -file")
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var instructions []service.Instruction
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&instructions); err != nil {
+		return fmt.Errorf("parse %s: %w", *file, err)
+	}
+
+	repo, err := storage.OpenFileStorage(*accPath, *txPath, storage.WithOutbox(*outboxPath))
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	svc := service.NewService(repo, service.WithAuditSink(audit.NewFileSink(*auditPath)))
+	result, err := svc.ApplyBatch(context.Background(), service.BatchMode(*mode), instructions)
+	if err == nil || errors.Is(err, service.ErrBatchRejected) {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func runBalance(args []string) error {
+	flags := flag.NewFlagSet("balance", flag.ExitOnError)
+	accPath := flags.String("accounts", "data/accounts.json", "accounts file")
+	txPath := flags.String("transactions", "data/transactions.json", "transactions file")
+	accountID := flags.String("account", "", "account to report")
+	at := flags.String("at", "", "point in time, RFC 3339 (default now)")
+	flags.Parse(args)
+
+	when := time.Now()
+	if *at != "" {
+		var err error
+		if when, err = parseTime(*at); err != nil {
+			return fmt.Errorf("parse -at: %w", err)
+		}
+	}
+
+	repo, err := storage.OpenFileStorage(*accPath, *txPath)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	balance, err := service.NewService(repo).BalanceAt(context.Background(), *accountID, when)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s at %s: %v\n", *accountID, when.Format(time.RFC3339), balance)
+	return nil
+}
+
+// runRebuild replays the event log from the start, so it also repairs a
+// snapshot that no longer matches the log. With -account it prints the
+// monthly totals of that account as built by the replay.
+func runRebuild(args []string) error {
+	flags := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	logPath := flags.String("events", "data/events.jsonl", "event log file")
+	snapPath := flags.String("snapshot", "data/events.snapshot.json", "snapshot file")
+	accountID := flags.String("account", "", "print the monthly totals of this account")
+	flags.Parse(args)
+
+	totals := storage.NewMonthlyTotals()
+	es := storage.NewEventStore(*logPath,
+		storage.WithSnapshots(*snapPath, 0),
+		storage.WithProjection(totals))
+	if err := es.Rebuild(); err != nil {
+		return err
+	}
+	state, err := es.State()
+	if err != nil {
+		return err
+	}
+	if err := es.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("rebuilt %s: %d accounts, %d transactions\n", *snapPath, state.Accounts, state.Transactions)
+	if *accountID == "" {
+		return nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(totals.Totals(*accountID))
+}
+
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	accPath := flags.String("accounts", "data/accounts.json", "accounts file")
+	txPath := flags.String("transactions", "data/transactions.json", "transactions file")
+	out := flags.String("out", "", "archive to write (default bank-<time>.tar.gz)")
+	flags.Parse(args)
+
+	path := *out
+	if path == "" {
+		path = "bank-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+	}
+
+	repo, err := storage.OpenFileStorage(*accPath, *txPath)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	manifest, err := repo.Backup(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	fmt.Printf("backup written to %s: %d accounts, %d transactions\n",
+		path, manifest.Accounts, manifest.Transactions)
+	return nil
+}
+
+// runRestore replaces the data files only once the whole archive has
+// passed its checks. The server may keep running: the restore takes the
+// same lock as every other writer. Only the accounts and transactions are
+// restored; the other stores and the audit log are left as they are.
+// Undelivered events are dropped with the outbox.
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	accPath := flags.String("accounts", "data/accounts.json", "accounts file")
+	txPath := flags.String("transactions", "data/transactions.json", "transactions file")
+	outboxPath := flags.String("outbox", "data/outbox.json", "outbox file")
+	in := flags.String("in", "", "archive to restore")
+	dryRun := flags.Bool("dry-run", false, "only check the archive")
+	flags.Parse(args)
+
+	if *in == "" {
+		return fmt.Errorf("empty -in")
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := storage.ReadBackup(f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid: %d accounts, %d transactions, taken %s\n",
+		*in, b.Manifest.Accounts, b.Manifest.Transactions, b.Manifest.CreatedAt.Format(time.RFC3339))
+	if *dryRun {
+		return nil
+	}
+
+	repo := storage.NewFileStorage(*accPath, *txPath, storage.WithOutbox(*outboxPath))
+	defer repo.Close()
+
+	if err := repo.Restore(b); err != nil {
+		return err
+	}
+
+	fmt.Println("restored")
+	return nil
+}
@@ -1,29 +1,208 @@
 package main
 
 import (
-	"bank-app/internal/model"
+	"bank-app/internal/api"
+	"bank-app/internal/approval"
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/config"
+	"bank-app/internal/fraud"
+	"bank-app/internal/logging"
+	"bank-app/internal/metrics"
+	"bank-app/internal/outbox"
 	"bank-app/internal/service"
 	"bank-app/internal/storage"
+	"bank-app/internal/stream"
+	"bank-app/internal/webhook"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	acc := model.Account{
-		ID:      "123",
-		Owner:   "Stas",
-		Balance: 0,
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		slog.Error("load config", slog.Any("error", err))
+		os.Exit(2)
 	}
 
-	repo := storage.NewFileStorage(
-		"data/accounts.json",
-		"data/transactions.json")
+	logger, err := logging.New(os.Stderr, cfg.Log)
+	if err != nil {
+		slog.Error("configure logging", slog.Any("error", err))
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, logger); err != nil {
+		logger.Error("server stopped", slog.Any("error", err))
+		os.Exit(1)
+	}
+	logger.Info("server stopped")
+}
+
+// backend is what the server needs from storage beyond storage.Storage.
+type backend interface {
+	storage.Storage
+	storage.Outbox
+	api.Diagnostics
+	Close() error
+}
+
+// openStorage picks the backend named in cfg. The memory backend keeps
+// nothing across restarts and is meant for demos and local testing. Data
+// that cannot be read, such as files written by a newer build, is an error
+// here rather than on every request.
+func openStorage(cfg config.Config, logger *slog.Logger, registry *metrics.Registry) (backend, error) {
+	switch cfg.StorageBackend {
+	case config.BackendMemory:
+		return storage.NewMemoryStorage(), nil
+	case config.BackendEventSourced:
+		return storage.OpenEventStore(
+			cfg.Path("events.jsonl"),
+			storage.WithSnapshots(cfg.Path("events.snapshot.json"), cfg.Limits.SnapshotEvery),
+			storage.WithEventLockTimeout(cfg.Limits.LockTimeout.Std()))
+	}
 
-	svc := service.NewService(repo)
+	return storage.OpenFileStorage(
+		cfg.Path("accounts.json"),
+		cfg.Path("transactions.json"),
+		storage.WithOutbox(cfg.Path("outbox.json")),
+		storage.WithLockTimeout(cfg.Limits.LockTimeout.Std()),
+		storage.WithGroupCommit(cfg.Limits.GroupCommitMaxBatch, cfg.Limits.GroupCommitWindow.Std()),
+		storage.WithLogger(logger.With(slog.String("component", "storage"))),
+		storage.WithMetrics(registry))
+}
+
+func run(ctx context.Context, cfg config.Config, logger *slog.Logger) error {
+	registry := metrics.NewRegistry()
 
-	if err := svc.Deposit(acc.ID, 10); err != nil {
-		fmt.Printf("Ошибка Deposit: %v\n", err)
+	repo, err := openStorage(cfg, logger, registry)
+	if err != nil {
+		return fmt.Errorf("open storage: %w", err)
 	}
-	if err := svc.Withdraw(acc.ID, 1); err != nil {
-		fmt.Printf("Ошибка Withdraw: %v\n", err)
+
+	// The service writes through the metered storage so the account gauges
+	// follow its changes; the outbox, probes and Close use the backend
+	// itself.
+	metered, err := storage.NewMeteredStorage(repo, registry)
+	if err != nil {
+		return fmt.Errorf("read storage metrics: %w", err)
 	}
+
+	broker := stream.NewBroker(64)
+
+	policy := auth.NewPolicy(auth.NewPrincipalStore(cfg.Path("principals.json")))
+
+	rules, err := fraud.LoadEngine(cfg.Path("fraud_rules.json"))
+	if err != nil {
+		return fmt.Errorf("load fraud rules: %w", err)
+	}
+
+	svc := service.NewService(metered,
+		service.WithAuditSink(audit.NewFileSink(cfg.Path("audit.jsonl"))),
+		service.WithAuthorizer(policy),
+		service.WithApprovals(approval.NewStore(cfg.Path("pending.json")),
+			cfg.Limits.ApprovalThreshold, cfg.Limits.ApprovalTTL.Std()),
+		service.WithFraudChecks(rules, fraud.NewReviewQueue(cfg.Path("review_queue.json"))),
+		service.WithTransactionListener(broker.Publish),
+		service.WithLogger(logger.With(slog.String("component", "service"))),
+		service.WithMetrics(registry))
+
+	hooks := webhook.NewStore(cfg.Path("webhooks.json"))
+
+	dispatcher := outbox.NewDispatcher(repo, outbox.WithErrorHandler(func(err error) {
+		logger.Warn("outbox dispatch failed", slog.Any("error", err))
+	}))
+	dispatcher.Register("webhooks", webhook.NewNotifier(hooks,
+		webhook.WithLogger(logger.With(slog.String("component", "webhooks")))).Handle)
+
+	dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+	dispatchDone := make(chan struct{})
+	go func() {
+		defer close(dispatchDone)
+		dispatcher.Run(dispatchCtx)
+	}()
+
+	authn := auth.NewAuthenticator(
+		auth.NewKeyStore(cfg.Path("api_keys.json")),
+		[]byte(os.Getenv("BANK_TOKEN_SECRET")))
+
+	// Metrics are scraped without credentials, so they sit outside the API
+	// and its authentication.
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry.Handler())
+	apiOpts := []api.Option{
+		api.WithAuthenticator(authn),
+		api.WithAuthorizer(policy),
+		api.WithWebhooks(hooks),
+		api.WithDiagnostics(repo),
+		api.WithTransactionStream(broker, cfg.Limits.StreamKeepAlive.Std()),
+	}
+	// Only the file backend can take backups.
+	if backups, ok := repo.(api.Backups); ok {
+		apiOpts = append(apiOpts, api.WithBackups(backups))
+	}
+	apiSrv := api.NewServer(svc, apiOpts...)
+	mux.Handle("/", http.MaxBytesHandler(apiSrv, cfg.Limits.MaxBodyBytes))
+
+	// Requests run on a context that is cancelled only once the shutdown
+	// timeout has passed; streams, which never finish on their own, are
+	// ended as soon as shutdown starts so that they do not hold it up.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	srv := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.Limits.ReadHeaderTimeout.Std(),
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(apiSrv.CloseStreams)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("listening",
+			slog.String("addr", cfg.ListenAddr),
+			slog.Bool("tls", cfg.TLS.Enabled()),
+			slog.String("data_dir", cfg.DataDir))
+
+		if cfg.TLS.Enabled() {
+			serveErr <- srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		logger.Info("shutting down", slog.Duration("timeout", cfg.Limits.ShutdownTimeout.Std()))
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Limits.ShutdownTimeout.Std())
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			cancelRequests()
+			srv.Close()
+			errs = append(errs, fmt.Errorf("drain requests: %w", err))
+		}
+	}
+
+	stopDispatch()
+	<-dispatchDone
+
+	if err := repo.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close storage: %w", err))
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,370 @@
+package api
+
+import (
+	"bank-app/internal/approval"
+	"bank-app/internal/auth"
+	"bank-app/internal/fraud"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"bank-app/internal/stream"
+	"bank-app/internal/webhook"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Server struct {
+	svc         service.Service
+	webhooks    *webhook.Store
+	broker      *stream.Broker
+	keepAlive   time.Duration
+	authn       *auth.Authenticator
+	authz       auth.Authorizer
+	diagnostics Diagnostics
+	backups     Backups
+	mux         *http.ServeMux
+	handler     http.Handler
+
+	streamsDone  chan struct{}
+	closeStreams sync.Once
+}
+
+type Option func(*Server)
+
+func WithWebhooks(store *webhook.Store) Option {
+	return func(s *Server) {
+		s.webhooks = store
+	}
+}
+
+// WithTransactionStream enables the Server-Sent Events endpoint fed by
+// broker, sending a comment line every keepAlive while the stream is idle.
+func WithTransactionStream(broker *stream.Broker, keepAlive time.Duration) Option {
+	return func(s *Server) {
+		s.broker = broker
+		s.keepAlive = keepAlive
+	}
+}
+
+// WithAuthenticator requires every request to carry a valid API key or
+// bearer token; the resolved identity is passed on to the service.
+func WithAuthenticator(a *auth.Authenticator) Option {
+	return func(s *Server) {
+		s.authn = a
+	}
+}
+
+// WithAuthorizer guards the administrative endpoints that do not go through
+// the service, such as webhook management.
+func WithAuthorizer(authz auth.Authorizer) Option {
+	return func(s *Server) {
+		s.authz = authz
+	}
+}
+
+func NewServer(svc service.Service, opts ...Option) *Server {
+	s := &Server{
+		svc:         svc,
+		mux:         http.NewServeMux(),
+		streamsDone: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("POST /accounts", s.handleOpenAccount)
+	s.mux.HandleFunc("GET /accounts/{id}/balance", s.handleGetBalance)
+	s.mux.HandleFunc("GET /accounts/{id}/transactions", s.handleTransactions)
+	s.mux.HandleFunc("POST /accounts/{id}/deposit", s.handleDeposit)
+	s.mux.HandleFunc("POST /accounts/{id}/withdraw", s.handleWithdraw)
+	s.mux.HandleFunc("POST /accounts/{id}/transfer", s.handleTransfer)
+	s.mux.HandleFunc("POST /accounts/{id}/freeze", s.handleStatus(s.svc.FreezeAccount))
+	s.mux.HandleFunc("POST /accounts/{id}/unfreeze", s.handleStatus(s.svc.UnfreezeAccount))
+	s.mux.HandleFunc("POST /accounts/{id}/close", s.handleStatus(s.svc.CloseAccount))
+
+	s.mux.HandleFunc("POST /batches", s.handleApplyBatch)
+	s.mux.HandleFunc("GET /transactions", s.handleTransactions)
+
+	s.mux.HandleFunc("GET /approvals", s.handlePendingOperations)
+	s.mux.HandleFunc("POST /approvals/{id}/approve", s.handleApprove)
+	s.mux.HandleFunc("POST /approvals/{id}/reject", s.handleReject)
+
+	s.mux.HandleFunc("GET /reviews", s.handleReviews)
+	s.mux.HandleFunc("POST /reviews/{id}/resolve", s.handleResolveReview)
+
+	if s.webhooks != nil {
+		s.mux.HandleFunc("GET /webhooks", s.adminOnly(s.handleListWebhooks))
+		s.mux.HandleFunc("POST /webhooks", s.adminOnly(s.handleCreateWebhook))
+		s.mux.HandleFunc("DELETE /webhooks/{id}", s.adminOnly(s.handleDeleteWebhook))
+		s.mux.HandleFunc("GET /webhooks/dead-letters", s.adminOnly(s.handleDeadLetters))
+	}
+
+	if s.broker != nil {
+		s.mux.HandleFunc("GET /transactions/stream", s.handleTransactionStream)
+	}
+
+	if s.diagnostics != nil {
+		s.mux.HandleFunc("GET /debug/state", s.adminOnly(s.handleDebugState))
+	}
+
+	if s.backups != nil {
+		s.mux.HandleFunc("GET /admin/backup", s.adminOnly(s.handleBackup))
+	}
+
+	s.handler = s.mux
+	if s.authn != nil {
+		s.handler = s.authn.Middleware(s.mux)
+	}
+
+	// Probes come from the orchestrator, which holds no credentials.
+	if s.diagnostics != nil {
+		public := http.NewServeMux()
+		public.HandleFunc("GET /healthz", s.handleHealthz)
+		public.HandleFunc("GET /readyz", s.handleReadyz)
+		public.Handle("/", s.handler)
+		s.handler = public
+	}
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+type openAccountRequest struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+}
+
+type amountRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+type balanceResponse struct {
+	AccountID string     `json:"account_id"`
+	Balance   float64    `json:"balance"`
+	At        *time.Time `json:"at,omitempty"`
+}
+
+func (s *Server) handleOpenAccount(w http.ResponseWriter, r *http.Request) {
+	var req openAccountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := s.svc.OpenAccount(r.Context(), req.ID, req.Owner); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, balanceResponse{AccountID: req.ID})
+}
+
+// handleGetBalance reports the current balance, or with an at parameter
+// (RFC 3339) the balance at that time.
+func (s *Server) handleGetBalance(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("at") == "" {
+		s.handleBalance(w, r)
+		return
+	}
+
+	at, err := parseTimeParam(r.URL.Query(), "at")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	id := r.PathValue("id")
+	balance, err := s.svc.BalanceAt(r.Context(), id, at)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, balanceResponse{AccountID: id, Balance: balance, At: &at})
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	balance, err := s.svc.CheckBalance(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, balanceResponse{AccountID: id, Balance: balance})
+}
+
+func (s *Server) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	s.handleAmount(w, r, s.svc.Deposit)
+}
+
+func (s *Server) handleWithdraw(w http.ResponseWriter, r *http.Request) {
+	s.handleAmount(w, r, s.svc.Withdraw)
+}
+
+func (s *Server) handleAmount(
+	w http.ResponseWriter, r *http.Request, op func(context.Context, string, float64) error) {
+	var req amountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := op(r.Context(), id, req.Amount); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.handleBalance(w, r)
+}
+
+func (s *Server) handleStatus(
+	op func(context.Context, string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := op(r.Context(), r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authz != nil {
+			if err := s.authz.Authorize(r.Context(), auth.ActionAdmin, ""); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.webhooks.List()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var sub webhook.Subscription
+	if !decodeJSON(w, r, &sub) {
+		return
+	}
+
+	created, err := s.webhooks.Create(sub)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	created.Secret = ""
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := s.webhooks.Delete(r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := s.webhooks.DeadLetters()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, letters)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers 202 Accepted with the pending operation when err only
+// says the operation is waiting for approval.
+func writeError(w http.ResponseWriter, err error) {
+	var pending *service.ApprovalRequiredError
+	if errors.As(err, &pending) {
+		writeJSON(w, http.StatusAccepted, pending.Operation)
+		return
+	}
+
+	writeJSON(w, statusFor(err), errorResponse{Error: err.Error()})
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound),
+		errors.Is(err, webhook.ErrSubscriptionNotFound),
+		errors.Is(err, approval.ErrNotFound),
+		errors.Is(err, fraud.ErrReviewNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrEmptyID),
+		errors.Is(err, service.ErrEmptyOwner),
+		errors.Is(err, service.ErrNonPositiveAmount),
+		errors.Is(err, service.ErrSameAccount),
+		errors.Is(err, service.ErrInvalidBatch),
+		errors.Is(err, storage.ErrInvalidQuery),
+		errors.Is(err, model.ErrInvalidAmount),
+		errors.Is(err, webhook.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, auth.ErrForbidden),
+		errors.Is(err, approval.ErrSelfApproval):
+		return http.StatusForbidden
+	case errors.Is(err, storage.ErrAlreadyExists),
+		errors.Is(err, storage.ErrConcurrentModification),
+		errors.Is(err, model.ErrAccountFrozen),
+		errors.Is(err, model.ErrAccountClosed),
+		errors.Is(err, model.ErrNonZeroBalance),
+		errors.Is(err, approval.ErrNotPending),
+		errors.Is(err, approval.ErrExpired),
+		errors.Is(err, fraud.ErrReviewClosed):
+		return http.StatusConflict
+	case errors.Is(err, model.ErrInsufficientFunds),
+		errors.Is(err, fraud.ErrBlocked):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,169 @@
+package api_test
+
+import (
+	"bank-app/internal/api"
+	"bank-app/internal/auth"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"bank-app/internal/webhook"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *api.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+
+	return api.NewServer(service.NewService(repo),
+		api.WithWebhooks(webhook.NewStore(filepath.Join(dir, "webhooks.json"))))
+}
+
+func do(t *testing.T, h http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, &buf))
+	return rec
+}
+
+func TestServer_AccountOperations(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       any
+		wantStatus int
+	}{
+		{"open", http.MethodPost, "/accounts", map[string]string{"id": "a", "owner": "Anton"}, http.StatusCreated},
+		{"open duplicate", http.MethodPost, "/accounts", map[string]string{"id": "a", "owner": "Anton"}, http.StatusConflict},
+		{"deposit", http.MethodPost, "/accounts/a/deposit", map[string]float64{"amount": 50}, http.StatusOK},
+		{"withdraw", http.MethodPost, "/accounts/a/withdraw", map[string]float64{"amount": 20}, http.StatusOK},
+		{"overdraw", http.MethodPost, "/accounts/a/withdraw", map[string]float64{"amount": 100}, http.StatusUnprocessableEntity},
+		{"negative amount", http.MethodPost, "/accounts/a/deposit", map[string]float64{"amount": -1}, http.StatusBadRequest},
+		{"unknown account", http.MethodGet, "/accounts/zzz/balance", nil, http.StatusNotFound},
+		{"bad body", http.MethodPost, "/accounts/a/deposit", map[string]string{"sum": "1"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rec := do(t, srv, tt.method, tt.path, tt.body)
+		assert.Equal(t, tt.wantStatus, rec.Code, "%s: %s", tt.name, rec.Body.String())
+	}
+
+	rec := do(t, srv, http.MethodGet, "/accounts/a/balance", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"account_id":"a","balance":30}`, rec.Body.String())
+}
+
+func TestServer_Webhooks(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := do(t, srv, http.MethodPost, "/webhooks", map[string]any{
+		"url": "https://partner.example/hook", "secret": "k", "account_ids": []string{"a"},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var created webhook.Subscription
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.Empty(t, created.Secret)
+
+	rec = do(t, srv, http.MethodGet, "/webhooks", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"secret":"k"`)
+
+	rec = do(t, srv, http.MethodDelete, "/webhooks/"+created.ID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = do(t, srv, http.MethodDelete, "/webhooks/"+created.ID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer_RecordsAuthenticatedActor(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "a", Owner: "Anton"}))
+
+	secret := []byte("s")
+	srv := api.NewServer(service.NewService(repo),
+		api.WithAuthenticator(auth.NewAuthenticator(nil, secret)))
+
+	rec := do(t, srv, http.MethodPost, "/accounts/a/deposit", map[string]float64{"amount": 5})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	token, err := auth.SignToken(secret, auth.Claims{Subject: "teller-1", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/accounts/a/deposit", strings.NewReader(`{"amount":5}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	txs, err := repo.LoadTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "teller-1", txs[0].Actor)
+	require.NoError(t, storage.VerifyChain(txs))
+}
+
+func TestServer_RoleChecks(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "a", Owner: "Anton", Balance: 10}))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "b", Owner: "Stas", Balance: 10}))
+
+	principals := auth.NewPrincipalStore(filepath.Join(dir, "principals.json"))
+	require.NoError(t, principals.Put(auth.Principal{ID: "anton", Role: auth.RoleCustomer, Accounts: []string{"a"}}))
+	require.NoError(t, principals.Put(auth.Principal{ID: "root", Role: auth.RoleAdmin}))
+	policy := auth.NewPolicy(principals)
+
+	secret := []byte("s")
+	srv := api.NewServer(service.NewService(repo, service.WithAuthorizer(policy)),
+		api.WithAuthenticator(auth.NewAuthenticator(nil, secret)),
+		api.WithAuthorizer(policy),
+		api.WithWebhooks(webhook.NewStore(filepath.Join(dir, "webhooks.json"))))
+
+	call := func(subject, method, path, body string) int {
+		token, err := auth.SignToken(secret, auth.Claims{Subject: subject, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("anton", http.MethodPost, "/accounts/a/withdraw", `{"amount":1}`))
+	assert.Equal(t, http.StatusForbidden, call("anton", http.MethodPost, "/accounts/b/withdraw", `{"amount":1}`))
+	assert.Equal(t, http.StatusForbidden, call("anton", http.MethodPost, "/accounts/a/freeze", ""))
+	assert.Equal(t, http.StatusForbidden, call("anton", http.MethodGet, "/webhooks", ""))
+	assert.Equal(t, http.StatusOK, call("root", http.MethodGet, "/webhooks", ""))
+	assert.Equal(t, http.StatusNoContent, call("root", http.MethodPost, "/accounts/a/freeze", ""))
+	assert.Equal(t, http.StatusConflict, call("anton", http.MethodPost, "/accounts/a/deposit", `{"amount":1}`))
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+)
+
+type transferRequest struct {
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+type rejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	var req transferRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := s.svc.Transfer(r.Context(), r.PathValue("id"), req.To, req.Amount); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.handleBalance(w, r)
+}
+
+func (s *Server) handlePendingOperations(w http.ResponseWriter, r *http.Request) {
+	ops, err := s.svc.PendingOperations(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ops)
+}
+
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	op, err := s.svc.ApproveOperation(r.Context(), r.PathValue("id"))
+	if err != nil && op.ID == "" {
+		writeError(w, err)
+		return
+	}
+
+	// a failed execution is still a completed decision; the operation
+	// carries the reason
+	writeJSON(w, http.StatusOK, op)
+}
+
+func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
+	var req rejectRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	op, err := s.svc.RejectOperation(r.Context(), r.PathValue("id"), req.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, op)
+}
@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"bank-app/internal/api"
+	"bank-app/internal/approval"
+	"bank-app/internal/auth"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_MakerChecker(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "a", Owner: "Anton", Balance: 50000}))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "b", Owner: "Stas"}))
+
+	principals := auth.NewPrincipalStore(filepath.Join(dir, "principals.json"))
+	require.NoError(t, principals.Put(auth.Principal{ID: "maker", Role: auth.RoleTeller}))
+	require.NoError(t, principals.Put(auth.Principal{ID: "checker", Role: auth.RoleTeller}))
+	require.NoError(t, principals.Put(auth.Principal{ID: "anton", Role: auth.RoleCustomer, Accounts: []string{"a"}}))
+	policy := auth.NewPolicy(principals)
+
+	secret := []byte("s")
+	svc := service.NewService(repo,
+		service.WithAuthorizer(policy),
+		service.WithApprovals(approval.NewStore(filepath.Join(dir, "pending.json")), 1000, time.Hour))
+	srv := api.NewServer(svc, api.WithAuthenticator(auth.NewAuthenticator(nil, secret)))
+
+	call := func(subject, method, path, body string) *httptest.ResponseRecorder {
+		token, err := auth.SignToken(secret, auth.Claims{Subject: subject, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call("maker", http.MethodPost, "/accounts/a/withdraw", `{"amount":100}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = call("maker", http.MethodPost, "/accounts/a/transfer", `{"to":"b","amount":20000}`)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+	var op approval.Operation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &op))
+	assert.Equal(t, approval.StatusPending, op.Status)
+	assert.Equal(t, "maker", op.RequestedBy)
+
+	acc, err := repo.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 49900.0, acc.Balance)
+
+	assert.Equal(t, http.StatusForbidden, call("anton", http.MethodGet, "/approvals", "").Code)
+	assert.Equal(t, http.StatusForbidden, call("maker", http.MethodPost, "/approvals/"+op.ID+"/approve", "").Code)
+
+	rec = call("checker", http.MethodPost, "/approvals/"+op.ID+"/approve", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &op))
+	assert.Equal(t, approval.StatusExecuted, op.Status)
+
+	assert.Equal(t, http.StatusConflict, call("checker", http.MethodPost, "/approvals/"+op.ID+"/approve", "").Code)
+
+	b, err := repo.LoadAccount("b")
+	require.NoError(t, err)
+	assert.Equal(t, 20000.0, b.Balance)
+
+	txs, err := repo.LoadTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 3)
+	assert.Equal(t, model.TransferOutTx, txs[1].Type)
+	assert.Equal(t, "maker", txs[1].Actor)
+	assert.Equal(t, "checker", txs[1].ApprovedBy)
+	assert.Equal(t, txs[1].TransferID, txs[2].TransferID)
+	require.NoError(t, storage.VerifyChain(txs))
+}
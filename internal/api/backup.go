@@ -0,0 +1,39 @@
+package api
+
+import (
+	"bank-app/internal/storage"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type Backups interface {
+	Backup(w io.Writer) (storage.Manifest, error)
+}
+
+// WithBackups enables the admin-only /admin/backup, which returns a backup
+// archive of the data files taken while the server keeps running.
+func WithBackups(b Backups) Option {
+	return func(s *Server) {
+		s.backups = b
+	}
+}
+
+// handleBackup builds the archive in memory first, so that a failure can
+// still be reported with a proper status.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	manifest, err := s.backups.Backup(&buf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bank-%s.tar.gz"`,
+		manifest.CreatedAt.Format("20060102T150405Z")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
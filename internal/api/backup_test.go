@@ -0,0 +1,60 @@
+package api_test
+
+import (
+	"bank-app/internal/api"
+	"bank-app/internal/auth"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Backup(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	require.NoError(t, repo.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+	require.NoError(t, repo.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+
+	principals := auth.NewPrincipalStore(filepath.Join(dir, "principals.json"))
+	require.NoError(t, principals.Put(auth.Principal{ID: "anton", Role: auth.RoleCustomer, Accounts: []string{"a"}}))
+	require.NoError(t, principals.Put(auth.Principal{ID: "root", Role: auth.RoleAdmin}))
+	policy := auth.NewPolicy(principals)
+
+	secret := []byte("s")
+	srv := api.NewServer(service.NewService(repo, service.WithAuthorizer(policy)),
+		api.WithAuthenticator(auth.NewAuthenticator(nil, secret)),
+		api.WithAuthorizer(policy),
+		api.WithBackups(repo))
+
+	get := func(subject string) *httptest.ResponseRecorder {
+		token, err := auth.SignToken(secret, auth.Claims{Subject: subject, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, get("anton").Code)
+
+	rec := get("root")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/gzip", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment")
+
+	b, err := storage.ReadBackup(rec.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 1, b.Manifest.Accounts)
+	assert.Equal(t, 1, b.Manifest.Transactions)
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"bank-app/internal/service"
+	"errors"
+	"net/http"
+)
+
+type batchRequest struct {
+	Mode  service.BatchMode     `json:"mode"`
+	Items []service.Instruction `json:"items"`
+}
+
+// handleApplyBatch answers 200 with per-item results even when some items
+// of a best-effort batch failed, and 422 with the same results when an
+// atomic batch was rejected. The mode defaults to atomic.
+func (s *Server) handleApplyBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = service.BatchAtomic
+	}
+
+	result, err := s.svc.ApplyBatch(r.Context(), req.Mode, req.Items)
+	switch {
+	case errors.Is(err, service.ErrBatchRejected):
+		writeJSON(w, http.StatusUnprocessableEntity, result)
+	case err != nil:
+		writeError(w, err)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
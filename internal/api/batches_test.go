@@ -0,0 +1,47 @@
+package api_test
+
+import (
+	"bank-app/internal/service"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Batches(t *testing.T) {
+	srv := newTestServer(t)
+	for _, id := range []string{"a", "b"} {
+		rec := do(t, srv, http.MethodPost, "/accounts", map[string]string{"id": id, "owner": "Anton"})
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	items := []map[string]any{
+		{"type": "deposit", "account_id": "a", "amount": 100},
+		{"type": "transfer", "account_id": "a", "to_account_id": "b", "amount": 30},
+		{"type": "withdraw", "account_id": "b", "amount": 500},
+	}
+
+	rec := do(t, srv, http.MethodPost, "/batches", map[string]any{"items": items})
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code, "atomic by default")
+
+	var result service.BatchResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, service.BatchAtomic, result.Mode)
+	assert.Equal(t, service.ItemSkipped, result.Items[0].Status)
+	assert.Equal(t, service.ItemFailed, result.Items[2].Status)
+	assert.Contains(t, result.Items[2].Error, "insufficient funds")
+
+	rec = do(t, srv, http.MethodPost, "/batches", map[string]any{"mode": "best_effort", "items": items})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Applied)
+	assert.Equal(t, 1, result.Failed)
+
+	rec = do(t, srv, http.MethodGet, "/accounts/b/balance", nil)
+	assert.JSONEq(t, `{"account_id":"b","balance":30}`, rec.Body.String())
+
+	rec = do(t, srv, http.MethodPost, "/batches", map[string]any{"mode": "someday", "items": items})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bank-app/internal/storage"
+	"net/http"
+)
+
+// Diagnostics is implemented by storage backends that can report on their
+// own health, such as storage.FileStorage.
+type Diagnostics interface {
+	Ready() error
+	State() (storage.State, error)
+}
+
+// WithDiagnostics enables /healthz and /readyz, which are served without
+// authentication, and the admin-only /debug/state report. /healthz only
+// tells that the process serves requests and never touches the storage,
+// so that a slow disk or a held lock does not get the process restarted;
+// /readyz runs the storage checks. Neither tells an anonymous caller why
+// it failed: the storage logs that.
+func WithDiagnostics(d Diagnostics) Option {
+	return func(s *Server) {
+		s.diagnostics = d
+	}
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, nil)
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, s.diagnostics.Ready())
+}
+
+func writeHealth(w http.ResponseWriter, err error) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func (s *Server) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	state, err := s.diagnostics.State()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,98 @@
+package api_test
+
+import (
+	"bank-app/internal/api"
+	"bank-app/internal/auth"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Health(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	repo := storage.NewFileStorage(accPath, filepath.Join(dir, "transactions.json"))
+
+	srv := api.NewServer(service.NewService(repo),
+		api.WithAuthenticator(auth.NewAuthenticator(nil, []byte("s"))),
+		api.WithDiagnostics(repo))
+
+	assert.Equal(t, http.StatusOK, do(t, srv, http.MethodGet, "/healthz", nil).Code, "no credentials needed")
+	assert.Equal(t, http.StatusOK, do(t, srv, http.MethodGet, "/readyz", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(t, srv, http.MethodGet, "/debug/state", nil).Code)
+
+	require.NoError(t, os.WriteFile(accPath, []byte("{broken"), 0644))
+
+	assert.Equal(t, http.StatusOK, do(t, srv, http.MethodGet, "/healthz", nil).Code,
+		"liveness does not read the data files")
+	rec := do(t, srv, http.MethodGet, "/readyz", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status": "unavailable"}`, rec.Body.String(), "the cause is not told")
+
+	require.NoError(t, os.WriteFile(accPath, []byte("[]"), 0644))
+	require.NoError(t, repo.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, do(t, srv, http.MethodGet, "/readyz", nil).Code)
+}
+
+func TestServer_DebugState(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json")))
+	require.NoError(t, repo.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+
+	principals := auth.NewPrincipalStore(filepath.Join(dir, "principals.json"))
+	require.NoError(t, principals.Put(auth.Principal{ID: "anton", Role: auth.RoleCustomer, Accounts: []string{"a"}}))
+	require.NoError(t, principals.Put(auth.Principal{ID: "root", Role: auth.RoleAdmin}))
+	policy := auth.NewPolicy(principals)
+
+	secret := []byte("s")
+	srv := api.NewServer(service.NewService(repo, service.WithAuthorizer(policy)),
+		api.WithAuthenticator(auth.NewAuthenticator(nil, secret)),
+		api.WithAuthorizer(policy),
+		api.WithDiagnostics(repo))
+
+	get := func(subject string) *httptest.ResponseRecorder {
+		token, err := auth.SignToken(secret, auth.Claims{Subject: subject, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/debug/state", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, get("anton").Code)
+
+	deposit := model.NewDepositTransaction("a", 10)
+	require.NoError(t, repo.ApplyTransaction("a", 10, deposit))
+
+	rec := get("root")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var state storage.State
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&state))
+	assert.Equal(t, 1, state.Accounts)
+	assert.Equal(t, 1, state.Transactions)
+	assert.Equal(t, 2, state.PendingEvents)
+	assert.True(t, state.ChainVerified)
+	assert.Empty(t, state.ChainError)
+	assert.True(t, deposit.CreatedAt.Equal(state.LastTransactionAt))
+	require.Len(t, state.Files, 3)
+	for _, f := range state.Files {
+		assert.True(t, f.Exists, f.Path)
+		assert.Positive(t, f.Size, f.Path)
+	}
+}
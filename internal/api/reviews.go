@@ -0,0 +1,36 @@
+package api
+
+import (
+	"bank-app/internal/fraud"
+	"net/http"
+)
+
+type resolveRequest struct {
+	Status fraud.ReviewStatus `json:"status"`
+	Note   string             `json:"note"`
+}
+
+func (s *Server) handleReviews(w http.ResponseWriter, r *http.Request) {
+	items, err := s.svc.ReviewQueue(r.Context(), fraud.ReviewStatus(r.URL.Query().Get("status")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (s *Server) handleResolveReview(w http.ResponseWriter, r *http.Request) {
+	var req resolveRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	item, err := s.svc.ResolveReview(r.Context(), r.PathValue("id"), req.Status, req.Note)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
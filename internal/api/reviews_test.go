@@ -0,0 +1,64 @@
+package api_test
+
+import (
+	"bank-app/internal/api"
+	"bank-app/internal/fraud"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_FraudScreening(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "a", Owner: "Anton", CreatedAt: time.Now()}))
+
+	engine, err := fraud.NewEngine([]fraud.Rule{
+		{Name: "pass-through", Type: fraud.RuleDepositThenWithdraw, Action: fraud.ActionFlag,
+			Window: fraud.Duration(time.Hour), Ratio: 0.9},
+		{Name: "fresh-cash-out", Type: fraud.RuleNewAccountWithdrawal, Action: fraud.ActionBlock,
+			MaxAge: fraud.Duration(time.Hour), MinAmount: 5000},
+	})
+	require.NoError(t, err)
+
+	svc := service.NewService(repo,
+		service.WithFraudChecks(engine, fraud.NewReviewQueue(filepath.Join(dir, "review.json"))))
+	srv := api.NewServer(svc)
+
+	require.Equal(t, http.StatusOK, do(t, srv, http.MethodPost, "/accounts/a/deposit", map[string]float64{"amount": 2000}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity,
+		do(t, srv, http.MethodPost, "/accounts/a/withdraw", map[string]float64{"amount": 6000}).Code)
+	require.Equal(t, http.StatusOK, do(t, srv, http.MethodPost, "/accounts/a/withdraw", map[string]float64{"amount": 100}).Code)
+
+	acc, err := repo.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1900.0, acc.Balance)
+
+	rec := do(t, srv, http.MethodGet, "/reviews?status=open", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var items []fraud.ReviewItem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+	require.Len(t, items, 0)
+
+	require.Equal(t, http.StatusOK, do(t, srv, http.MethodPost, "/accounts/a/withdraw", map[string]float64{"amount": 1850}).Code)
+
+	rec = do(t, srv, http.MethodGet, "/reviews?status=open", nil)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, 1850.0, items[0].Transaction.Amount)
+	assert.Equal(t, "pass-through", items[0].Hits[0].Rule)
+
+	rec = do(t, srv, http.MethodPost, "/reviews/"+items[0].ID+"/resolve", map[string]string{"status": "cleared"})
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CloseStreams ends the open transaction streams and refuses new ones. A
+// stream never finishes on its own, so register this with
+// http.Server.RegisterOnShutdown to let a graceful shutdown drain the other
+// requests without waiting on streams.
+func (s *Server) CloseStreams() {
+	s.closeStreams.Do(func() {
+		close(s.streamsDone)
+	})
+}
+
+// handleTransactionStream streams applied transactions as Server-Sent Events,
+// optionally limited to ?account=<id>. A client reconnecting with
+// Last-Event-ID first receives everything after that transaction from the
+// stored history, then the live feed; an ID the history does not hold is
+// refused with 400 rather than answered with a guess.
+func (s *Server) handleTransactionStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "streaming unsupported"})
+		return
+	}
+
+	select {
+	case <-s.streamsDone:
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "server is shutting down"})
+		return
+	default:
+	}
+
+	accountID := r.URL.Query().Get("account")
+
+	// subscribe before reading history so nothing applied in between is lost
+	live, cancel := s.broker.Subscribe(accountID)
+	defer cancel()
+
+	// a one-transaction page checks that the caller may see this stream
+	// without reading the history, which only a resuming client needs
+	_, err := s.svc.QueryTransactions(r.Context(), storage.TransactionQuery{AccountID: accountID, Limit: 1})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var backlog []model.Transaction
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		history, err := s.svc.Transactions(r.Context(), accountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var found bool
+		if backlog, found = transactionsAfter(history, lastID); !found {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "unknown Last-Event-ID"})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sent := make(map[string]bool, len(backlog))
+	for _, tx := range backlog {
+		if err := writeEvent(w, tx); err != nil {
+			return
+		}
+		sent[tx.ID] = true
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(s.keepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.streamsDone:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case tx, ok := <-live:
+			if !ok {
+				return
+			}
+			if sent[tx.ID] {
+				delete(sent, tx.ID)
+				continue
+			}
+			if err := writeEvent(w, tx); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// transactionsAfter returns the history following lastID, and whether
+// lastID is in it at all.
+func transactionsAfter(history []model.Transaction, lastID string) ([]model.Transaction, bool) {
+	for i := range history {
+		if history[i].ID == lastID {
+			return history[i+1:], true
+		}
+	}
+
+	return nil, false
+}
+
+// writeEvent sends tx in its JSON form, as webhook payloads carry it. The
+// stream never sends accounts, whose field names changed with data format
+// version 2.
+func writeEvent(w http.ResponseWriter, tx model.Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: transaction\ndata: %s\n\n", tx.ID, data)
+	return err
+}
@@ -0,0 +1,154 @@
+package api_test
+
+import (
+	"bank-app/internal/api"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"bank-app/internal/stream"
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	id string
+	tx model.Transaction
+}
+
+func readEvent(t *testing.T, r *bufio.Reader) (sseEvent, bool) {
+	t.Helper()
+
+	var ev sseEvent
+	keepAlive := false
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "":
+			return ev, keepAlive
+		case strings.HasPrefix(line, ": keep-alive"):
+			keepAlive = true
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.tx))
+		}
+	}
+}
+
+func nextTransaction(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	for {
+		if ev, keepAlive := readEvent(t, r); !keepAlive {
+			return ev
+		}
+	}
+}
+
+func TestServer_TransactionStream(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "a", Owner: "Anton"}))
+	require.NoError(t, repo.SaveNewAccount(model.Account{ID: "b", Owner: "Stas"}))
+
+	broker := stream.NewBroker(16)
+	svc := service.NewService(repo, service.WithTransactionListener(broker.Publish))
+
+	srv := httptest.NewServer(api.NewServer(svc, api.WithTransactionStream(broker, 20*time.Millisecond)))
+	defer srv.Close()
+
+	require.NoError(t, svc.Deposit(context.Background(), "a", 1))
+	require.NoError(t, svc.Deposit(context.Background(), "b", 2))
+	require.NoError(t, svc.Deposit(context.Background(), "a", 3))
+
+	history, err := svc.Transactions(context.Background(), "a")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/transactions/stream?account=a", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", history[0].ID)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	r := bufio.NewReader(resp.Body)
+
+	resumed := nextTransaction(t, r)
+	assert.Equal(t, history[1].ID, resumed.id)
+	assert.Equal(t, 3.0, resumed.tx.Amount)
+
+	_, keepAlive := readEvent(t, r)
+	assert.True(t, keepAlive)
+
+	require.NoError(t, svc.Deposit(context.Background(), "b", 4))
+	require.NoError(t, svc.Withdraw(context.Background(), "a", 2))
+
+	live := nextTransaction(t, r)
+	assert.Equal(t, "a", live.tx.AccountID)
+	assert.Equal(t, model.WithdrawTx, live.tx.Type)
+	assert.Equal(t, live.tx.ID, live.id)
+}
+
+func TestServer_CloseStreams(t *testing.T) {
+	dir := t.TempDir()
+	repo := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	broker := stream.NewBroker(16)
+	apiSrv := api.NewServer(service.NewService(repo), api.WithTransactionStream(broker, time.Hour))
+	srv := httptest.NewServer(apiSrv)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/transactions/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	apiSrv.CloseStreams()
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err, "the open stream ends")
+
+	resp, err = http.Get(srv.URL + "/transactions/stream")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestServer_TransactionStreamUnknownLastEventID(t *testing.T) {
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "Anton"})
+	svc := service.NewService(repo)
+	require.NoError(t, svc.Deposit(context.Background(), "a", 1))
+	srv := httptest.NewServer(api.NewServer(svc, api.WithTransactionStream(stream.NewBroker(16), time.Hour)))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/transactions/stream?account=a", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "gone")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "the history is not replayed from the start")
+}
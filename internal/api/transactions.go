@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleTransactions serves a page of GET /transactions, or of
+// GET /accounts/{id}/transactions for one account.
+func (s *Server) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTransactionQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if id := r.PathValue("id"); id != "" {
+		q.AccountID = id
+	}
+
+	page, err := s.svc.QueryTransactions(r.Context(), q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseTransactionQuery reads the filters account_id, type (repeated or
+// comma separated), min_amount, max_amount, from and to (RFC 3339), and
+// the paging parameters limit and cursor.
+func parseTransactionQuery(values url.Values) (storage.TransactionQuery, error) {
+	q := storage.TransactionQuery{
+		AccountID: values.Get("account_id"),
+		Cursor:    values.Get("cursor"),
+	}
+
+	for _, v := range values["type"] {
+		for _, t := range strings.Split(v, ",") {
+			q.Types = append(q.Types, model.TransactionType(t))
+		}
+	}
+
+	var err error
+	if q.MinAmount, err = parseFloatParam(values, "min_amount"); err != nil {
+		return q, err
+	}
+	if q.MaxAmount, err = parseFloatParam(values, "max_amount"); err != nil {
+		return q, err
+	}
+	if q.From, err = parseTimeParam(values, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseTimeParam(values, "to"); err != nil {
+		return q, err
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("%w: limit: %v", storage.ErrInvalidQuery, err)
+		}
+	}
+
+	return q, nil
+}
+
+func parseFloatParam(values url.Values, name string) (float64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", storage.ErrInvalidQuery, name, err)
+	}
+	return f, nil
+}
+
+func parseTimeParam(values url.Values, name string) (time.Time, error) {
+	v := values.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s: %v", storage.ErrInvalidQuery, name, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,91 @@
+package api_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Transactions(t *testing.T) {
+	srv := newTestServer(t)
+	for _, id := range []string{"a", "b"} {
+		rec := do(t, srv, http.MethodPost, "/accounts", map[string]string{"id": id, "owner": "Anton"})
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	for _, amount := range []float64{10, 20, 30} {
+		rec := do(t, srv, http.MethodPost, "/accounts/a/deposit", map[string]float64{"amount": amount})
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+	rec := do(t, srv, http.MethodPost, "/accounts/a/transfer", map[string]any{"to": "b", "amount": 5})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	list := func(path string, params url.Values) (storage.TransactionPage, int) {
+		t.Helper()
+		rec := do(t, srv, http.MethodGet, path+"?"+params.Encode(), nil)
+		var page storage.TransactionPage
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		}
+		return page, rec.Code
+	}
+
+	page, code := list("/accounts/a/transactions", url.Values{"limit": {"2"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Transactions, 2)
+	assert.True(t, page.HasMore)
+
+	page, _ = list("/accounts/a/transactions", url.Values{"limit": {"2"}, "cursor": {page.NextCursor}})
+	require.Len(t, page.Transactions, 2)
+	assert.Equal(t, 30.0, page.Transactions[0].Amount)
+	assert.Equal(t, model.TransferOutTx, page.Transactions[1].Type)
+	assert.False(t, page.HasMore)
+
+	page, _ = list("/transactions", url.Values{"type": {"deposit,transfer_in"}, "min_amount": {"6"}, "max_amount": {"25"}})
+	require.Len(t, page.Transactions, 2)
+	assert.Equal(t, 10.0, page.Transactions[0].Amount)
+	assert.Equal(t, 20.0, page.Transactions[1].Amount)
+
+	page, _ = list("/transactions", url.Values{"account_id": {"b"}, "from": {"2000-01-01T00:00:00Z"}})
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, model.TransferInTx, page.Transactions[0].Type)
+
+	for _, params := range []url.Values{
+		{"from": {"yesterday"}},
+		{"limit": {"many"}},
+		{"min_amount": {"10"}, "max_amount": {"1"}},
+		{"cursor": {"bogus"}},
+	} {
+		_, code := list("/transactions", params)
+		assert.Equal(t, http.StatusBadRequest, code, params.Encode())
+	}
+}
+
+func TestServer_BalanceAt(t *testing.T) {
+	srv := newTestServer(t)
+	rec := do(t, srv, http.MethodPost, "/accounts", map[string]string{"id": "a", "owner": "Anton"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	before := time.Now().UTC().Truncate(time.Second).Add(-time.Second)
+	rec = do(t, srv, http.MethodPost, "/accounts/a/deposit", map[string]float64{"amount": 40})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	at := before.Format(time.RFC3339)
+	rec = do(t, srv, http.MethodGet, "/accounts/a/balance?at="+at, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"account_id":"a","balance":0,"at":"`+at+`"}`, rec.Body.String())
+
+	rec = do(t, srv, http.MethodGet, "/accounts/a/balance", nil)
+	assert.JSONEq(t, `{"account_id":"a","balance":40}`, rec.Body.String())
+
+	rec = do(t, srv, http.MethodGet, "/accounts/a/balance?at=noon", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(t, srv, http.MethodGet, "/accounts/missing/balance?at="+at, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,260 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OperationType string
+
+const (
+	OpWithdraw OperationType = "withdraw"
+	OpTransfer OperationType = "transfer"
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusExecuted Status = "executed"
+	StatusFailed   Status = "failed"
+	StatusRejected Status = "rejected"
+	StatusExpired  Status = "expired"
+)
+
+var (
+	ErrNotFound     = errors.New("pending operation not found")
+	ErrNotPending   = errors.New("operation is not pending")
+	ErrExpired      = errors.New("operation has expired")
+	ErrSelfApproval = errors.New("operation must be decided by another principal")
+)
+
+// Operation is a money movement waiting for a second principal (the
+// checker) to approve what the first one (the maker) requested.
+type Operation struct {
+	ID              string        `json:"id"`
+	Type            OperationType `json:"type"`
+	AccountID       string        `json:"account_id"`
+	TargetAccountID string        `json:"target_account_id,omitempty"`
+	Amount          float64       `json:"amount"`
+	RequestedBy     string        `json:"requested_by"`
+	RequestedAt     time.Time     `json:"requested_at"`
+	ExpiresAt       time.Time     `json:"expires_at"`
+	Status          Status        `json:"status"`
+	DecidedBy       string        `json:"decided_by,omitempty"`
+	DecidedAt       time.Time     `json:"decided_at,omitzero"`
+	Reason          string        `json:"reason,omitempty"`
+}
+
+type Store struct {
+	path string
+	now  func() time.Time
+	mu   sync.Mutex
+}
+
+func NewStore(path string) *Store {
+	return &Store{
+		path: path,
+		now:  time.Now,
+	}
+}
+
+func (s *Store) Create(op Operation, ttl time.Duration) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops, err := s.loadUnsafe()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	now := s.now()
+	op.ID = uuid.New().String()
+	op.RequestedAt = now
+	op.ExpiresAt = now.Add(ttl)
+	op.Status = StatusPending
+	ops = append(ops, op)
+
+	if err := s.writeUnsafe(ops); err != nil {
+		return Operation{}, err
+	}
+
+	return op, nil
+}
+
+func (s *Store) Get(id string) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops, err := s.expireUnsafe()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	i := slices.IndexFunc(ops, func(op Operation) bool { return op.ID == id })
+	if i < 0 {
+		return Operation{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	return ops[i], nil
+}
+
+// List returns the operations in the given status, or all of them when
+// status is empty. Operations past their deadline are expired first.
+func (s *Store) List(status Status) ([]Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops, err := s.expireUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []Operation{}
+	for _, op := range ops {
+		if status == "" || op.Status == status {
+			matched = append(matched, op)
+		}
+	}
+
+	return matched, nil
+}
+
+// Decide moves a pending operation to approved or rejected on behalf of
+// decidedBy. Only one decision can ever succeed for an operation.
+func (s *Store) Decide(id, decidedBy string, status Status, reason string) (Operation, error) {
+	if status != StatusApproved && status != StatusRejected {
+		return Operation{}, fmt.Errorf("invalid decision %q", status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops, err := s.expireUnsafe()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	i := slices.IndexFunc(ops, func(op Operation) bool { return op.ID == id })
+	if i < 0 {
+		return Operation{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	op := &ops[i]
+	switch {
+	case op.Status == StatusExpired:
+		return Operation{}, fmt.Errorf("%w: %s", ErrExpired, id)
+	case op.Status != StatusPending:
+		return Operation{}, fmt.Errorf("%w: %s is %s", ErrNotPending, id, op.Status)
+	case op.RequestedBy == decidedBy:
+		return Operation{}, ErrSelfApproval
+	}
+
+	op.Status = status
+	op.DecidedBy = decidedBy
+	op.DecidedAt = s.now()
+	op.Reason = reason
+
+	if err := s.writeUnsafe(ops); err != nil {
+		return Operation{}, err
+	}
+
+	return *op, nil
+}
+
+// Complete records the outcome of executing an approved operation.
+func (s *Store) Complete(id string, execErr error) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops, err := s.loadUnsafe()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	i := slices.IndexFunc(ops, func(op Operation) bool { return op.ID == id })
+	if i < 0 {
+		return Operation{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if ops[i].Status != StatusApproved {
+		return Operation{}, fmt.Errorf("%w: %s is %s", ErrNotPending, id, ops[i].Status)
+	}
+
+	ops[i].Status = StatusExecuted
+	if execErr != nil {
+		ops[i].Status = StatusFailed
+		ops[i].Reason = execErr.Error()
+	}
+
+	if err := s.writeUnsafe(ops); err != nil {
+		return Operation{}, err
+	}
+
+	return ops[i], nil
+}
+
+func (s *Store) expireUnsafe() ([]Operation, error) {
+	ops, err := s.loadUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	changed := false
+	for i := range ops {
+		if ops[i].Status == StatusPending && !now.Before(ops[i].ExpiresAt) {
+			ops[i].Status = StatusExpired
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := s.writeUnsafe(ops); err != nil {
+			return nil, err
+		}
+	}
+
+	return ops, nil
+}
+
+func (s *Store) loadUnsafe() ([]Operation, error) {
+	ops := []Operation{}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ops, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read pending operations file: %w", err)
+	}
+	if len(data) == 0 {
+		return ops, nil
+	}
+
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("corrupted pending operations file: %w", err)
+	}
+
+	return ops, nil
+}
+
+func (s *Store) writeUnsafe(ops []Operation) error {
+	data, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal pending operations: %w", err)
+	}
+
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write pending operations file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package approval_test
+
+import (
+	"bank-app/internal/approval"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Decide(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		decisions  []string
+		wantErr    error
+		wantStatus approval.Status
+	}{
+		{
+			name:       "approved by checker",
+			ttl:        time.Hour,
+			decisions:  []string{"checker"},
+			wantStatus: approval.StatusApproved,
+		}, {
+			name:      "maker cannot approve",
+			ttl:       time.Hour,
+			decisions: []string{"maker"},
+			wantErr:   approval.ErrSelfApproval,
+		}, {
+			name:      "decided only once",
+			ttl:       time.Hour,
+			decisions: []string{"checker", "other-checker"},
+			wantErr:   approval.ErrNotPending,
+		}, {
+			name:       "expired",
+			ttl:        0,
+			decisions:  []string{"checker"},
+			wantErr:    approval.ErrExpired,
+			wantStatus: approval.StatusExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := approval.NewStore(filepath.Join(t.TempDir(), "pending.json"))
+
+			op, err := store.Create(approval.Operation{
+				Type: approval.OpWithdraw, AccountID: "a", Amount: 50000, RequestedBy: "maker",
+			}, tt.ttl)
+			require.NoError(t, err)
+			assert.Equal(t, approval.StatusPending, op.Status)
+
+			for _, checker := range tt.decisions {
+				_, err = store.Decide(op.ID, checker, approval.StatusApproved, "")
+			}
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			if tt.wantStatus != "" {
+				got, err := store.Get(op.ID)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantStatus, got.Status)
+			}
+		})
+	}
+}
+
+func TestStore_ListAndComplete(t *testing.T) {
+	store := approval.NewStore(filepath.Join(t.TempDir(), "pending.json"))
+
+	first, err := store.Create(approval.Operation{Type: approval.OpWithdraw, AccountID: "a", RequestedBy: "m"}, time.Hour)
+	require.NoError(t, err)
+	_, err = store.Create(approval.Operation{Type: approval.OpTransfer, AccountID: "a", RequestedBy: "m"}, time.Hour)
+	require.NoError(t, err)
+
+	_, err = store.Complete(first.ID, nil)
+	require.ErrorIs(t, err, approval.ErrNotPending)
+
+	_, err = store.Decide(first.ID, "c", approval.StatusApproved, "")
+	require.NoError(t, err)
+	done, err := store.Complete(first.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, approval.StatusExecuted, done.Status)
+
+	pending, err := store.List(approval.StatusPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, approval.OpTransfer, pending[0].Type)
+}
@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomePending Outcome = "pending"
+)
+
+const SystemActor = "system"
+
+const (
+	ActionOpenAccount = "account.open"
+	ActionDeposit     = "account.deposit"
+	ActionWithdraw    = "account.withdraw"
+	ActionFreeze      = "account.freeze"
+	ActionUnfreeze    = "account.unfreeze"
+	ActionClose       = "account.close"
+	ActionTransfer    = "account.transfer"
+	ActionApprove     = "operation.approve"
+	ActionReject      = "operation.reject"
+
+	ActionResolveReview = "review.resolve"
+	ActionApplyBatch    = "batch.apply"
+)
+
+type Event struct {
+	ID        string         `json:"id"`
+	Time      time.Time      `json:"time"`
+	Actor     string         `json:"actor"`
+	Action    string         `json:"action"`
+	AccountID string         `json:"account_id,omitempty"`
+	Params    map[string]any `json:"params,omitempty"`
+	Outcome   Outcome        `json:"outcome"`
+	Error     string         `json:"error,omitempty"`
+}
+
+func NewEvent(actor, action, accountID string, params map[string]any, opErr error) Event {
+	e := Event{
+		ID:        uuid.New().String(),
+		Time:      time.Now(),
+		Actor:     actor,
+		Action:    action,
+		AccountID: accountID,
+		Params:    params,
+		Outcome:   OutcomeSuccess,
+	}
+	if opErr != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = opErr.Error()
+	}
+
+	return e
+}
+
+type Sink interface {
+	Record(e Event) error
+}
+
+type NopSink struct{}
+
+func (NopSink) Record(Event) error { return nil }
+
+// Filter selects events for compliance queries. Zero fields match anything;
+// From is inclusive and To is exclusive.
+type Filter struct {
+	AccountID string
+	From      time.Time
+	To        time.Time
+}
+
+func (f Filter) Match(e Event) bool {
+	if f.AccountID != "" && e.AccountID != f.AccountID {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.Time.Before(f.To) {
+		return false
+	}
+
+	return true
+}
+
+func Query(events []Event, f Filter) []Event {
+	matched := []Event{}
+	for _, e := range events {
+		if f.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	return matched
+}
+
+// FileSink appends events as JSON lines.
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (s *FileSink) Record(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) Events() ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Event{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+
+	events := []Event{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("corrupted audit log line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan audit log: %w", err)
+	}
+
+	return events, nil
+}
+
+func (s *FileSink) Query(f Filter) ([]Event, error) {
+	events, err := s.Events()
+	if err != nil {
+		return nil, err
+	}
+
+	return Query(events, f), nil
+}
@@ -0,0 +1,80 @@
+package audit_test
+
+import (
+	"bank-app/internal/audit"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink_Query(t *testing.T) {
+	sink := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	base := time.Date(2025, 12, 24, 12, 0, 0, 0, time.UTC)
+	events := []audit.Event{
+		audit.NewEvent(audit.SystemActor, audit.ActionOpenAccount, "a", map[string]any{"owner": "Anton"}, nil),
+		audit.NewEvent(audit.SystemActor, audit.ActionDeposit, "a", map[string]any{"amount": 10.0}, nil),
+		audit.NewEvent(audit.SystemActor, audit.ActionWithdraw, "b", map[string]any{"amount": 500.0},
+			errors.New("insufficient funds")),
+		audit.NewEvent(audit.SystemActor, audit.ActionWithdraw, "a", map[string]any{"amount": 1.0}, nil),
+	}
+	for i := range events {
+		events[i].Time = base.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, sink.Record(events[i]))
+	}
+
+	tests := []struct {
+		name    string
+		filter  audit.Filter
+		wantIDs []string
+	}{
+		{
+			name:    "everything",
+			wantIDs: []string{events[0].ID, events[1].ID, events[2].ID, events[3].ID},
+		}, {
+			name:    "by account",
+			filter:  audit.Filter{AccountID: "a"},
+			wantIDs: []string{events[0].ID, events[1].ID, events[3].ID},
+		}, {
+			name:    "time range is half open",
+			filter:  audit.Filter{From: base.Add(time.Hour), To: base.Add(3 * time.Hour)},
+			wantIDs: []string{events[1].ID, events[2].ID},
+		}, {
+			name:    "account and range",
+			filter:  audit.Filter{AccountID: "a", From: base.Add(2 * time.Hour)},
+			wantIDs: []string{events[3].ID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sink.Query(tt.filter)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, e := range got {
+				ids = append(ids, e.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+
+	failed, err := sink.Query(audit.Filter{AccountID: "b"})
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, audit.OutcomeFailure, failed[0].Outcome)
+	assert.Equal(t, "insufficient funds", failed[0].Error)
+	assert.Equal(t, 500.0, failed[0].Params["amount"])
+}
+
+func TestFileSink_EventsMissingFile(t *testing.T) {
+	sink := audit.NewFileSink(filepath.Join(t.TempDir(), "missing.jsonl"))
+
+	events, err := sink.Events()
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey is the stored form of a key: the secret half is kept only as a
+// SHA-256 hash. Keys are handed out as "<id>.<secret>".
+type APIKey struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"subject"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type KeyStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewKeyStore(path string) *KeyStore {
+	return &KeyStore{path: path}
+}
+
+// Create stores a new key for subject and returns the plain key, which is
+// not recoverable afterwards.
+func (ks *KeyStore) Create(subject string) (string, APIKey, error) {
+	if subject == "" {
+		return "", APIKey{}, fmt.Errorf("empty subject")
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+
+	key := APIKey{
+		ID:        id,
+		Subject:   subject,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now(),
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys, err := ks.loadUnsafe()
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	keys = append(keys, key)
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return "", APIKey{}, fmt.Errorf("marshal api keys: %w", err)
+	}
+	if err := os.WriteFile(ks.path, data, 0600); err != nil {
+		return "", APIKey{}, fmt.Errorf("write api keys file: %w", err)
+	}
+
+	return id + "." + secret, key, nil
+}
+
+func (ks *KeyStore) Authenticate(plain string) (Identity, error) {
+	id, secret, ok := strings.Cut(plain, ".")
+	if !ok || id == "" || secret == "" {
+		return Identity{}, ErrInvalidAPIKey
+	}
+
+	ks.mu.Lock()
+	keys, err := ks.loadUnsafe()
+	ks.mu.Unlock()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	want := hashSecret(secret)
+	for _, k := range keys {
+		if k.ID == id && subtle.ConstantTimeCompare([]byte(k.Hash), []byte(want)) == 1 {
+			return Identity{Subject: k.Subject, Method: MethodAPIKey}, nil
+		}
+	}
+
+	return Identity{}, ErrInvalidAPIKey
+}
+
+func (ks *KeyStore) loadUnsafe() ([]APIKey, error) {
+	keys := []APIKey{}
+
+	data, err := os.ReadFile(ks.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read api keys file: %w", err)
+	}
+	if len(data) == 0 {
+		return keys, nil
+	}
+
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("corrupted api keys file: %w", err)
+	}
+
+	return keys, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate random bytes: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,132 @@
+package auth_test
+
+import (
+	"bank-app/internal/auth"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("test-secret")
+
+func TestParseToken(t *testing.T) {
+	now := time.Date(2025, 12, 24, 12, 0, 0, 0, time.UTC)
+
+	valid, err := auth.SignToken(secret, auth.Claims{
+		Subject: "teller-1", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+
+	expired, err := auth.SignToken(secret, auth.Claims{
+		Subject: "teller-1", IssuedAt: now.Add(-2 * time.Hour).Unix(), ExpiresAt: now.Add(-time.Hour).Unix(),
+	})
+	require.NoError(t, err)
+
+	noExpiry, err := auth.SignToken(secret, auth.Claims{Subject: "teller-1", IssuedAt: now.Unix()})
+	require.NoError(t, err)
+
+	parts := strings.Split(valid, ".")
+	forgedPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999}`))
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  []byte
+		wantSub string
+		wantErr bool
+	}{
+		{name: "valid", token: valid, secret: secret, wantSub: "teller-1"},
+		{name: "expired", token: expired, secret: secret, wantErr: true},
+		{name: "no expiry", token: noExpiry, secret: secret, wantErr: true},
+		{name: "wrong secret", token: valid, secret: []byte("other"), wantErr: true},
+		{name: "payload swapped", token: parts[0] + "." + forgedPayload + "." + parts[2], secret: secret, wantErr: true},
+		{name: "alg none", token: noneHeader + "." + parts[1] + ".", secret: secret, wantErr: true},
+		{name: "malformed", token: "abc", secret: secret, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := auth.ParseToken(tt.secret, tt.token, now)
+
+			if tt.wantErr {
+				require.ErrorIs(t, err, auth.ErrInvalidToken)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSub, claims.Subject)
+		})
+	}
+}
+
+func TestKeyStore_Authenticate(t *testing.T) {
+	ks := auth.NewKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+
+	plain, key, err := ks.Create("auditor-1")
+	require.NoError(t, err)
+	assert.NotContains(t, key.Hash, strings.SplitN(plain, ".", 2)[1])
+
+	id, err := ks.Authenticate(plain)
+	require.NoError(t, err)
+	assert.Equal(t, auth.Identity{Subject: "auditor-1", Method: auth.MethodAPIKey}, id)
+
+	_, err = ks.Authenticate(key.ID + ".wrong")
+	require.ErrorIs(t, err, auth.ErrInvalidAPIKey)
+	_, err = ks.Authenticate("garbage")
+	require.ErrorIs(t, err, auth.ErrInvalidAPIKey)
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	ks := auth.NewKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	plain, _, err := ks.Create("teller-1")
+	require.NoError(t, err)
+
+	token, err := auth.SignToken(secret, auth.Claims{Subject: "customer-7", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	var seen auth.Identity
+	h := auth.NewAuthenticator(ks, secret).Middleware(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			seen, _ = auth.FromContext(r.Context())
+		}))
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+		wantID     auth.Identity
+	}{
+		{name: "no credentials", wantStatus: http.StatusUnauthorized},
+		{name: "api key", header: auth.APIKeyHeader, value: plain, wantStatus: http.StatusOK,
+			wantID: auth.Identity{Subject: "teller-1", Method: auth.MethodAPIKey}},
+		{name: "bearer token", header: "Authorization", value: "Bearer " + token, wantStatus: http.StatusOK,
+			wantID: auth.Identity{Subject: "customer-7", Method: auth.MethodToken}},
+		{name: "basic auth", header: "Authorization", value: "Basic dTpw", wantStatus: http.StatusUnauthorized},
+		{name: "bad key", header: auth.APIKeyHeader, value: "x.y", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = auth.Identity{}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantID, seen)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+const (
+	MethodAPIKey = "api_key"
+	MethodToken  = "token"
+)
+
+type Identity struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator accepts either an API key in the X-API-Key header or a
+// bearer token in the Authorization header. Either source may be nil.
+type Authenticator struct {
+	keys        *KeyStore
+	tokenSecret []byte
+	now         func() time.Time
+}
+
+func NewAuthenticator(keys *KeyStore, tokenSecret []byte) *Authenticator {
+	return &Authenticator{
+		keys:        keys,
+		tokenSecret: tokenSecret,
+		now:         time.Now,
+	}
+}
+
+func (a *Authenticator) Authenticate(r *http.Request) (Identity, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		if a.keys == nil {
+			return Identity{}, ErrUnauthenticated
+		}
+		return a.keys.Authenticate(key)
+	}
+
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || len(a.tokenSecret) == 0 {
+			return Identity{}, ErrUnauthenticated
+		}
+		claims, err := ParseToken(a.tokenSecret, token, a.now())
+		if err != nil {
+			return Identity{}, err
+		}
+		return Identity{Subject: claims.Subject, Method: MethodToken}, nil
+	}
+
+	return Identity{}, ErrUnauthenticated
+}
+
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if !errors.Is(err, ErrUnauthenticated) &&
+				!errors.Is(err, ErrInvalidAPIKey) && !errors.Is(err, ErrInvalidToken) {
+				status = http.StatusInternalServerError
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bank"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+type Action string
+
+const (
+	ActionRead     Action = "read"
+	ActionOpen     Action = "open"
+	ActionDeposit  Action = "deposit"
+	ActionWithdraw Action = "withdraw"
+	ActionFreeze   Action = "freeze"
+	ActionClose    Action = "close"
+	ActionApprove  Action = "approve"
+	ActionAdmin    Action = "admin"
+)
+
+type Authorizer interface {
+	Authorize(ctx context.Context, action Action, accountID string) error
+}
+
+// Policy is the role-based Authorizer:
+//   - customers read and move money only on accounts they own;
+//   - tellers open accounts, read and move money on any account, and act
+//     as checkers approving other principals' large operations;
+//   - auditors read anything and change nothing;
+//   - admins may do everything, and are the only ones to freeze or close
+//     accounts or reach administrative endpoints.
+//
+// An empty accountID stands for "all accounts". Calls without an identity
+// come from inside the process (CLI, background jobs) and are allowed.
+type Policy struct {
+	principals *PrincipalStore
+}
+
+func NewPolicy(principals *PrincipalStore) *Policy {
+	return &Policy{principals: principals}
+}
+
+func (p *Policy) Authorize(ctx context.Context, action Action, accountID string) error {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	principal, err := p.principals.Get(id.Subject)
+	if errors.Is(err, ErrPrincipalNotFound) {
+		return fmt.Errorf("%w: unknown principal %s", ErrForbidden, id.Subject)
+	}
+	if err != nil {
+		return err
+	}
+
+	if allowed(principal, action, accountID) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s may not %s account %q", ErrForbidden, principal.ID, action, accountID)
+}
+
+func allowed(p Principal, action Action, accountID string) bool {
+	switch p.Role {
+	case RoleAdmin:
+		return true
+	case RoleTeller:
+		switch action {
+		case ActionRead, ActionOpen, ActionDeposit, ActionWithdraw, ActionApprove:
+			return true
+		}
+	case RoleAuditor:
+		return action == ActionRead
+	case RoleCustomer:
+		switch action {
+		case ActionRead, ActionDeposit, ActionWithdraw:
+			return accountID != "" && p.Owns(accountID)
+		}
+	}
+
+	return false
+}
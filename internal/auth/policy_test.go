@@ -0,0 +1,61 @@
+package auth_test
+
+import (
+	"bank-app/internal/auth"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	store := auth.NewPrincipalStore(filepath.Join(t.TempDir(), "principals.json"))
+	for _, p := range []auth.Principal{
+		{ID: "anton", Role: auth.RoleCustomer},
+		{ID: "teller", Role: auth.RoleTeller},
+		{ID: "auditor", Role: auth.RoleAuditor},
+		{ID: "root", Role: auth.RoleAdmin},
+	} {
+		require.NoError(t, store.Put(p))
+	}
+	require.NoError(t, store.LinkAccount("anton", "acc-anton"))
+
+	policy := auth.NewPolicy(store)
+
+	tests := []struct {
+		subject   string
+		action    auth.Action
+		accountID string
+		allowed   bool
+	}{
+		{"anton", auth.ActionDeposit, "acc-anton", true},
+		{"anton", auth.ActionWithdraw, "acc-anton", true},
+		{"anton", auth.ActionRead, "acc-anton", true},
+		{"anton", auth.ActionWithdraw, "acc-stas", false},
+		{"anton", auth.ActionRead, "", false},
+		{"anton", auth.ActionFreeze, "acc-anton", false},
+		{"teller", auth.ActionOpen, "acc-new", true},
+		{"teller", auth.ActionWithdraw, "acc-stas", true},
+		{"teller", auth.ActionFreeze, "acc-stas", false},
+		{"auditor", auth.ActionRead, "", true},
+		{"auditor", auth.ActionDeposit, "acc-anton", false},
+		{"root", auth.ActionClose, "acc-stas", true},
+		{"root", auth.ActionAdmin, "", true},
+		{"teller", auth.ActionAdmin, "", false},
+		{"stranger", auth.ActionRead, "acc-anton", false},
+	}
+
+	for _, tt := range tests {
+		ctx := auth.WithIdentity(context.Background(), auth.Identity{Subject: tt.subject})
+		err := policy.Authorize(ctx, tt.action, tt.accountID)
+
+		if tt.allowed {
+			require.NoError(t, err, "%s %s %s", tt.subject, tt.action, tt.accountID)
+		} else {
+			require.ErrorIs(t, err, auth.ErrForbidden, "%s %s %s", tt.subject, tt.action, tt.accountID)
+		}
+	}
+
+	require.NoError(t, policy.Authorize(context.Background(), auth.ActionClose, "acc-anton"))
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleTeller   Role = "teller"
+	RoleAuditor  Role = "auditor"
+	RoleAdmin    Role = "admin"
+)
+
+var (
+	ErrPrincipalNotFound = errors.New("principal not found")
+	ErrInvalidRole       = errors.New("invalid role")
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleCustomer, RoleTeller, RoleAuditor, RoleAdmin:
+		return true
+	}
+
+	return false
+}
+
+// Principal is a known caller. ID matches the Subject of an authenticated
+// Identity; Accounts lists the accounts the principal owns.
+type Principal struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Role     Role     `json:"role"`
+	Accounts []string `json:"accounts,omitempty"`
+}
+
+func (p Principal) Owns(accountID string) bool {
+	return slices.Contains(p.Accounts, accountID)
+}
+
+type PrincipalStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewPrincipalStore(path string) *PrincipalStore {
+	return &PrincipalStore{path: path}
+}
+
+func (ps *PrincipalStore) Get(id string) (Principal, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	principals, err := ps.loadUnsafe()
+	if err != nil {
+		return Principal{}, err
+	}
+
+	i := slices.IndexFunc(principals, func(p Principal) bool { return p.ID == id })
+	if i < 0 {
+		return Principal{}, fmt.Errorf("%w: %s", ErrPrincipalNotFound, id)
+	}
+
+	return principals[i], nil
+}
+
+func (ps *PrincipalStore) List() ([]Principal, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.loadUnsafe()
+}
+
+// Put creates or replaces a principal, keeping existing account links when
+// p carries none.
+func (ps *PrincipalStore) Put(p Principal) error {
+	if p.ID == "" {
+		return fmt.Errorf("empty principal ID")
+	}
+	if !p.Role.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, p.Role)
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	principals, err := ps.loadUnsafe()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(principals, func(existing Principal) bool { return existing.ID == p.ID })
+	if i < 0 {
+		principals = append(principals, p)
+	} else {
+		if p.Accounts == nil {
+			p.Accounts = principals[i].Accounts
+		}
+		principals[i] = p
+	}
+
+	return ps.writeUnsafe(principals)
+}
+
+func (ps *PrincipalStore) LinkAccount(principalID, accountID string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	principals, err := ps.loadUnsafe()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(principals, func(p Principal) bool { return p.ID == principalID })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrPrincipalNotFound, principalID)
+	}
+	if principals[i].Owns(accountID) {
+		return nil
+	}
+	principals[i].Accounts = append(principals[i].Accounts, accountID)
+
+	return ps.writeUnsafe(principals)
+}
+
+func (ps *PrincipalStore) loadUnsafe() ([]Principal, error) {
+	principals := []Principal{}
+
+	data, err := os.ReadFile(ps.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return principals, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read principals file: %w", err)
+	}
+	if len(data) == 0 {
+		return principals, nil
+	}
+
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return nil, fmt.Errorf("corrupted principals file: %w", err)
+	}
+
+	return principals, nil
+}
+
+func (ps *PrincipalStore) writeUnsafe(principals []Principal) error {
+	data, err := json.MarshalIndent(principals, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal principals: %w", err)
+	}
+
+	if err := os.WriteFile(ps.path, data, 0644); err != nil {
+		return fmt.Errorf("write principals file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,353 @@
+package config
+
+import (
+	"bank-app/internal/logging"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	BackendFile         = "file"
+	BackendMemory       = "memory"
+	BackendEventSourced = "eventsourced"
+)
+
+var ErrInvalid = errors.New("invalid config")
+
+type Config struct {
+	ListenAddr     string         `json:"listen_addr" yaml:"listen_addr"`
+	DataDir        string         `json:"data_dir" yaml:"data_dir"`
+	StorageBackend string         `json:"storage_backend" yaml:"storage_backend"`
+	Log            logging.Config `json:"log" yaml:"log"`
+	Limits         Limits         `json:"limits" yaml:"limits"`
+	TLS            TLS            `json:"tls" yaml:"tls"`
+}
+
+type Limits struct {
+	MaxBodyBytes      int64    `json:"max_body_bytes" yaml:"max_body_bytes"`
+	ApprovalThreshold float64  `json:"approval_threshold" yaml:"approval_threshold"`
+	ApprovalTTL       Duration `json:"approval_ttl" yaml:"approval_ttl"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	StreamKeepAlive   Duration `json:"stream_keep_alive" yaml:"stream_keep_alive"`
+	ShutdownTimeout   Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	LockTimeout       Duration `json:"lock_timeout" yaml:"lock_timeout"`
+
+	// GroupCommitMaxBatch caps how many concurrent writes share one commit
+	// of the file backend; below two every write commits alone. A zero
+	// GroupCommitWindow batches only writes that queued up behind a commit
+	// in progress.
+	GroupCommitMaxBatch int      `json:"group_commit_max_batch" yaml:"group_commit_max_batch"`
+	GroupCommitWindow   Duration `json:"group_commit_window" yaml:"group_commit_window"`
+
+	// SnapshotEvery is how many events the eventsourced backend appends
+	// between snapshots; zero saves one only on shutdown.
+	SnapshotEvery int `json:"snapshot_every" yaml:"snapshot_every"`
+}
+
+// TLS is enabled when both files are set.
+type TLS struct {
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+func Default() Config {
+	return Config{
+		ListenAddr:     ":8080",
+		DataDir:        "data",
+		StorageBackend: BackendFile,
+		Log:            logging.Config{Level: "info", Format: logging.FormatText},
+		Limits: Limits{
+			MaxBodyBytes:      1 << 20,
+			ApprovalThreshold: 10000,
+			ApprovalTTL:       Duration(24 * time.Hour),
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			StreamKeepAlive:   Duration(15 * time.Second),
+			ShutdownTimeout:   Duration(30 * time.Second),
+			LockTimeout:       Duration(10 * time.Second),
+
+			GroupCommitMaxBatch: 32,
+			SnapshotEvery:       1000,
+		},
+	}
+}
+
+// Path returns the location of a data file inside DataDir.
+func (c Config) Path(name string) string {
+	return filepath.Join(c.DataDir, name)
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		invalid("listen_addr %q: %v", c.ListenAddr, err)
+	}
+	if c.DataDir == "" {
+		invalid("data_dir is empty")
+	}
+	switch c.StorageBackend {
+	case BackendFile, BackendMemory, BackendEventSourced:
+	default:
+		invalid("unknown storage_backend %q", c.StorageBackend)
+	}
+	if _, err := logging.New(io.Discard, c.Log); err != nil {
+		invalid("log: %v", err)
+	}
+
+	if c.Limits.MaxBodyBytes <= 0 {
+		invalid("limits.max_body_bytes must be positive")
+	}
+	if c.Limits.ApprovalThreshold <= 0 {
+		invalid("limits.approval_threshold must be positive")
+	}
+	if c.Limits.GroupCommitMaxBatch < 0 {
+		invalid("limits.group_commit_max_batch must not be negative")
+	}
+	if c.Limits.GroupCommitWindow < 0 {
+		invalid("limits.group_commit_window must not be negative")
+	}
+	if c.Limits.SnapshotEvery < 0 {
+		invalid("limits.snapshot_every must not be negative")
+	}
+	for name, d := range map[string]Duration{
+		"approval_ttl":        c.Limits.ApprovalTTL,
+		"read_header_timeout": c.Limits.ReadHeaderTimeout,
+		"stream_keep_alive":   c.Limits.StreamKeepAlive,
+		"shutdown_timeout":    c.Limits.ShutdownTimeout,
+		"lock_timeout":        c.Limits.LockTimeout,
+	} {
+		if d <= 0 {
+			invalid("limits.%s must be positive", name)
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid("tls needs both cert_file and key_file")
+	}
+	for _, path := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			invalid("tls: %v", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalid, errors.Join(errs...))
+	}
+	return nil
+}
+
+// setting is one option that can be overridden from the environment and
+// from the command line.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"listen", "BANK_LISTEN_ADDR", "address to listen on", func(c *Config, v string) error {
+		c.ListenAddr = v
+		return nil
+	}},
+	{"data-dir", "BANK_DATA_DIR", "directory holding the data files", func(c *Config, v string) error {
+		c.DataDir = v
+		return nil
+	}},
+	{"storage", "BANK_STORAGE_BACKEND", "storage backend: file, memory or eventsourced", func(c *Config, v string) error {
+		c.StorageBackend = v
+		return nil
+	}},
+	{"log-level", "BANK_LOG_LEVEL", "debug, info, warn or error", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"log-format", "BANK_LOG_FORMAT", "text or json", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+	{"max-body-bytes", "BANK_MAX_BODY_BYTES", "largest accepted request body", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		c.Limits.MaxBodyBytes = n
+		return err
+	}},
+	{"approval-threshold", "BANK_APPROVAL_THRESHOLD", "amount that needs a second approver", func(c *Config, v string) error {
+		n, err := strconv.ParseFloat(v, 64)
+		c.Limits.ApprovalThreshold = n
+		return err
+	}},
+	{"approval-ttl", "BANK_APPROVAL_TTL", "how long an operation waits for approval", durationSetter(func(c *Config) *Duration {
+		return &c.Limits.ApprovalTTL
+	})},
+	{"read-header-timeout", "BANK_READ_HEADER_TIMEOUT", "how long a client may take to send request headers", durationSetter(func(c *Config) *Duration {
+		return &c.Limits.ReadHeaderTimeout
+	})},
+	{"stream-keep-alive", "BANK_STREAM_KEEP_ALIVE", "interval of keep-alive comments on idle streams", durationSetter(func(c *Config) *Duration {
+		return &c.Limits.StreamKeepAlive
+	})},
+	{"shutdown-timeout", "BANK_SHUTDOWN_TIMEOUT", "how long to drain requests on exit", durationSetter(func(c *Config) *Duration {
+		return &c.Limits.ShutdownTimeout
+	})},
+	{"lock-timeout", "BANK_LOCK_TIMEOUT", "how long to wait for the storage lock", durationSetter(func(c *Config) *Duration {
+		return &c.Limits.LockTimeout
+	})},
+	{"group-commit-max-batch", "BANK_GROUP_COMMIT_MAX_BATCH", "most writes sharing one commit of the file backend", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Limits.GroupCommitMaxBatch = n
+		return err
+	}},
+	{"group-commit-window", "BANK_GROUP_COMMIT_WINDOW", "how long a commit waits for more writes to share it", durationSetter(func(c *Config) *Duration {
+		return &c.Limits.GroupCommitWindow
+	})},
+	{"snapshot-every", "BANK_SNAPSHOT_EVERY", "events between snapshots of the eventsourced backend", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Limits.SnapshotEvery = n
+		return err
+	}},
+	{"tls-cert", "BANK_TLS_CERT", "TLS certificate file", func(c *Config, v string) error {
+		c.TLS.CertFile = v
+		return nil
+	}},
+	{"tls-key", "BANK_TLS_KEY", "TLS private key file", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+		return nil
+	}},
+}
+
+func durationSetter(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		*field(c) = Duration(d)
+		return err
+	}
+}
+
+// Load builds the configuration from defaults, then the file named by
+// -config or BANK_CONFIG, then BANK_* environment variables, then flags,
+// and validates the result.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	fset := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fset.String("config", getenv("BANK_CONFIG"), "JSON or YAML config file")
+
+	var fromFlags []func(*Config) error
+	for _, s := range settings {
+		fset.Func(s.flag, s.usage+" (env "+s.env+")", func(v string) error {
+			fromFlags = append(fromFlags, func(c *Config) error {
+				return s.set(c, v)
+			})
+			return nil
+		})
+	}
+	if err := fset.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *path != "" {
+		if err := loadFile(*path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		v := getenv(s.env)
+		if v == "" {
+			continue
+		}
+		if err := s.set(&cfg, v); err != nil {
+			return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalid, s.env, err)
+		}
+	}
+
+	for i, apply := range fromFlags {
+		if err := apply(&cfg); err != nil {
+			return Config{}, fmt.Errorf("%w: flag #%d: %v", ErrInvalid, i+1, err)
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, path, err)
+	}
+
+	return nil
+}
+
+// Duration reads "15m"-style strings from JSON and YAML.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %w", err)
+	}
+
+	return d.set(s)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %w", err)
+	}
+
+	return d.set(s)
+}
+
+func (d *Duration) set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
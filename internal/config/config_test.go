@@ -0,0 +1,140 @@
+package config_test
+
+import (
+	"bank-app/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := config.Load(nil, env(nil))
+	require.NoError(t, err)
+
+	assert.Equal(t, config.Default(), cfg)
+	assert.Equal(t, filepath.Join("data", "accounts.json"), cfg.Path("accounts.json"))
+	assert.False(t, cfg.TLS.Enabled())
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	yamlPath := writeFile(t, "bank.yaml", `
+listen_addr: ":9000"
+data_dir: /var/lib/bank
+log:
+  level: debug
+limits:
+  approval_ttl: 2h
+  shutdown_timeout: 5s
+`)
+
+	cfg, err := config.Load(
+		[]string{"-config", yamlPath, "-listen", "127.0.0.1:7000", "-stream-keep-alive", "5s"},
+		env(map[string]string{
+			"BANK_LISTEN_ADDR":         ":8000",
+			"BANK_LOG_FORMAT":          "json",
+			"BANK_SHUTDOWN_TIMEOUT":    "1m",
+			"BANK_READ_HEADER_TIMEOUT": "3s",
+		}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "127.0.0.1:7000", cfg.ListenAddr, "flag wins over env and file")
+	assert.Equal(t, "/var/lib/bank", cfg.DataDir, "file wins over defaults")
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, "json", cfg.Log.Format, "env wins over defaults")
+	assert.Equal(t, 2*time.Hour, cfg.Limits.ApprovalTTL.Std())
+	assert.Equal(t, time.Minute, cfg.Limits.ShutdownTimeout.Std(), "env wins over file")
+	assert.Equal(t, 3*time.Second, cfg.Limits.ReadHeaderTimeout.Std())
+	assert.Equal(t, 5*time.Second, cfg.Limits.StreamKeepAlive.Std())
+	assert.Equal(t, config.Default().Limits.MaxBodyBytes, cfg.Limits.MaxBodyBytes)
+}
+
+func TestLoad_JSONFileFromEnv(t *testing.T) {
+	path := writeFile(t, "bank.json", `{"data_dir": "/srv/bank", "limits": {"approval_threshold": 500}}`)
+
+	cfg, err := config.Load(nil, env(map[string]string{"BANK_CONFIG": path}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "/srv/bank", cfg.DataDir)
+	assert.Equal(t, 500.0, cfg.Limits.ApprovalThreshold)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		args []string
+		env  map[string]string
+	}{
+		{name: "unknown file field", file: "unknown: 1\n"},
+		{name: "bad duration in file", file: "limits:\n  approval_ttl: soon\n"},
+		{name: "bad listen address", args: []string{"-listen", "8080"}},
+		{name: "unknown backend", args: []string{"-storage", "postgres"}},
+		{name: "bad log level", env: map[string]string{"BANK_LOG_LEVEL": "loud"}},
+		{name: "bad number in env", env: map[string]string{"BANK_MAX_BODY_BYTES": "lots"}},
+		{name: "negative limit", args: []string{"-approval-threshold", "-1"}},
+		{name: "negative group commit window", file: "limits:\n  group_commit_window: -1s\n"},
+		{name: "negative snapshot interval", file: "limits:\n  snapshot_every: -1\n"},
+		{name: "bad snapshot interval in env", env: map[string]string{"BANK_SNAPSHOT_EVERY": "often"}},
+		{name: "bad lock timeout", args: []string{"-lock-timeout", "long"}},
+		{name: "tls cert without key", args: []string{"-tls-cert", "cert.pem"}},
+		{name: "missing tls files", args: []string{"-tls-cert", "nope.pem", "-tls-key", "nope.key"}},
+		{name: "unknown flag", args: []string{"-verbose"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "bank.yaml", tt.file)}, args...)
+			}
+
+			_, err := config.Load(args, env(tt.env))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoad_MemoryBackend(t *testing.T) {
+	cfg, err := config.Load([]string{"-storage", "memory"}, env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, config.BackendMemory, cfg.StorageBackend)
+}
+
+func TestLoad_EventSourcedBackend(t *testing.T) {
+	cfg, err := config.Load([]string{"-storage", "eventsourced"}, env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, config.BackendEventSourced, cfg.StorageBackend)
+	assert.Equal(t, 1000, cfg.Limits.SnapshotEvery)
+}
+
+func TestLoad_StorageLimits(t *testing.T) {
+	cfg, err := config.Load(
+		[]string{"-lock-timeout", "2s", "-group-commit-max-batch", "64"},
+		env(map[string]string{
+			"BANK_GROUP_COMMIT_WINDOW":    "3ms",
+			"BANK_GROUP_COMMIT_MAX_BATCH": "8",
+			"BANK_SNAPSHOT_EVERY":         "250",
+		}))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2*time.Second, cfg.Limits.LockTimeout.Std())
+	assert.Equal(t, 64, cfg.Limits.GroupCommitMaxBatch, "flag wins over env")
+	assert.Equal(t, 3*time.Millisecond, cfg.Limits.GroupCommitWindow.Std())
+	assert.Equal(t, 250, cfg.Limits.SnapshotEvery)
+}
@@ -0,0 +1,152 @@
+package fraud
+
+import (
+	"bank-app/internal/model"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Input struct {
+	Account     model.Account
+	Transaction model.Transaction
+	// History holds earlier transactions of the same account, oldest first.
+	History []model.Transaction
+}
+
+type Hit struct {
+	Rule   string `json:"rule"`
+	Action Action `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// Decision carries the strictest action of all rules that fired.
+type Decision struct {
+	Action Action `json:"action"`
+	Hits   []Hit  `json:"hits,omitempty"`
+}
+
+type BlockedError struct {
+	Decision Decision
+}
+
+func (e *BlockedError) Error() string {
+	reasons := make([]string, 0, len(e.Decision.Hits))
+	for _, h := range e.Decision.Hits {
+		reasons = append(reasons, h.Rule+": "+h.Reason)
+	}
+
+	return fmt.Sprintf("%s (%s)", ErrBlocked, strings.Join(reasons, "; "))
+}
+
+func (e *BlockedError) Unwrap() error {
+	return ErrBlocked
+}
+
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(rules []Rule) (*Engine, error) {
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Engine{rules: rules}, nil
+}
+
+func (e *Engine) Evaluate(in Input) Decision {
+	decision := Decision{Action: ActionAllow}
+
+	for _, r := range e.rules {
+		reason, hit := evaluate(r, in)
+		if !hit {
+			continue
+		}
+
+		decision.Hits = append(decision.Hits, Hit{Rule: r.Name, Action: r.Action, Reason: reason})
+		if r.Action.severity() > decision.Action.severity() {
+			decision.Action = r.Action
+		}
+	}
+
+	return decision
+}
+
+func evaluate(r Rule, in Input) (string, bool) {
+	tx := in.Transaction
+
+	switch r.Type {
+	case RuleVelocity:
+		since := tx.CreatedAt.Add(-time.Duration(r.Window))
+		count := 1
+		for _, h := range in.History {
+			if h.CreatedAt.After(since) {
+				count++
+			}
+		}
+		if count > r.MaxCount {
+			return fmt.Sprintf("%d transactions within %s", count, time.Duration(r.Window)), true
+		}
+
+	case RuleAmountDeviation:
+		if len(in.History) < r.MinHistory || len(in.History) == 0 {
+			return "", false
+		}
+		total := 0.0
+		for _, h := range in.History {
+			total += h.Amount
+		}
+		mean := total / float64(len(in.History))
+		if tx.Amount > r.Factor*mean {
+			return fmt.Sprintf("amount %.2f is over %.1fx the average %.2f", tx.Amount, r.Factor, mean), true
+		}
+
+	case RuleDepositThenWithdraw:
+		if !outgoing(tx) {
+			return "", false
+		}
+		since := tx.CreatedAt.Add(-time.Duration(r.Window))
+		incoming := 0.0
+		for _, h := range in.History {
+			if !outgoing(h) && h.CreatedAt.After(since) {
+				incoming += h.Amount
+			}
+		}
+		if incoming > 0 && tx.Amount >= r.Ratio*incoming {
+			return fmt.Sprintf("%.2f out after %.2f in within %s",
+				tx.Amount, incoming, time.Duration(r.Window)), true
+		}
+
+	case RuleNewAccountWithdrawal:
+		if !outgoing(tx) || tx.Amount < r.MinAmount {
+			return "", false
+		}
+		opened, known := openedAt(in)
+		if known && tx.CreatedAt.Sub(opened) < time.Duration(r.MaxAge) {
+			return fmt.Sprintf("%.2f out of an account opened %s ago",
+				tx.Amount, tx.CreatedAt.Sub(opened).Round(time.Second)), true
+		}
+	}
+
+	return "", false
+}
+
+func outgoing(tx model.Transaction) bool {
+	return tx.Type == model.WithdrawTx || tx.Type == model.TransferOutTx
+}
+
+// openedAt falls back to the first transaction for accounts stored before
+// they carried a creation time.
+func openedAt(in Input) (time.Time, bool) {
+	if !in.Account.CreatedAt.IsZero() {
+		return in.Account.CreatedAt, true
+	}
+	if len(in.History) > 0 {
+		return in.History[0].CreatedAt, true
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,178 @@
+package fraud_test
+
+import (
+	"bank-app/internal/fraud"
+	"bank-app/internal/model"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2025, 12, 24, 12, 0, 0, 0, time.UTC)
+
+func txAt(typ model.TransactionType, amount float64, ago time.Duration) model.Transaction {
+	return model.Transaction{
+		ID:        "tx",
+		AccountID: "a",
+		Type:      typ,
+		Amount:    amount,
+		CreatedAt: now.Add(-ago),
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine, err := fraud.NewEngine([]fraud.Rule{
+		{Name: "burst", Type: fraud.RuleVelocity, Action: fraud.ActionBlock,
+			Window: fraud.Duration(time.Minute), MaxCount: 3},
+		{Name: "unusual", Type: fraud.RuleAmountDeviation, Action: fraud.ActionFlag,
+			Factor: 5, MinHistory: 3},
+		{Name: "pass-through", Type: fraud.RuleDepositThenWithdraw, Action: fraud.ActionFlag,
+			Window: fraud.Duration(time.Hour), Ratio: 0.9},
+		{Name: "fresh-cash-out", Type: fraud.RuleNewAccountWithdrawal, Action: fraud.ActionBlock,
+			MaxAge: fraud.Duration(24 * time.Hour), MinAmount: 1000},
+	})
+	require.NoError(t, err)
+
+	old := model.Account{ID: "a", CreatedAt: now.Add(-365 * 24 * time.Hour)}
+
+	tests := []struct {
+		name       string
+		account    model.Account
+		history    []model.Transaction
+		tx         model.Transaction
+		wantAction fraud.Action
+		wantRules  []string
+	}{
+		{
+			name:    "ordinary",
+			account: old,
+			history: []model.Transaction{
+				txAt(model.DepositTx, 100, 48*time.Hour),
+				txAt(model.DepositTx, 100, 24*time.Hour),
+				txAt(model.WithdrawTx, 50, 2*time.Hour),
+			},
+			tx:         txAt(model.WithdrawTx, 60, 0),
+			wantAction: fraud.ActionAllow,
+		}, {
+			name:    "velocity",
+			account: old,
+			history: []model.Transaction{
+				txAt(model.DepositTx, 1, 50*time.Second),
+				txAt(model.DepositTx, 1, 30*time.Second),
+				txAt(model.DepositTx, 1, 10*time.Second),
+			},
+			tx:         txAt(model.DepositTx, 1, 0),
+			wantAction: fraud.ActionBlock,
+			wantRules:  []string{"burst"},
+		}, {
+			name:    "unusual amount",
+			account: old,
+			history: []model.Transaction{
+				txAt(model.DepositTx, 10, 72*time.Hour),
+				txAt(model.DepositTx, 10, 48*time.Hour),
+				txAt(model.DepositTx, 10, 24*time.Hour),
+			},
+			tx:         txAt(model.DepositTx, 500, 0),
+			wantAction: fraud.ActionFlag,
+			wantRules:  []string{"unusual"},
+		}, {
+			name:    "deposit then withdraw",
+			account: old,
+			history: []model.Transaction{
+				txAt(model.DepositTx, 800, 10*time.Minute),
+			},
+			tx:         txAt(model.TransferOutTx, 790, 0),
+			wantAction: fraud.ActionFlag,
+			wantRules:  []string{"pass-through"},
+		}, {
+			name:       "new account large withdrawal",
+			account:    model.Account{ID: "a", CreatedAt: now.Add(-time.Hour)},
+			tx:         txAt(model.WithdrawTx, 2000, 0),
+			wantAction: fraud.ActionBlock,
+			wantRules:  []string{"fresh-cash-out"},
+		}, {
+			name:    "legacy account falls back to first transaction",
+			account: model.Account{ID: "a"},
+			history: []model.Transaction{
+				txAt(model.DepositTx, 5000, 3*time.Hour),
+			},
+			tx:         txAt(model.WithdrawTx, 1000, 0),
+			wantAction: fraud.ActionBlock,
+			wantRules:  []string{"fresh-cash-out"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := engine.Evaluate(fraud.Input{Account: tt.account, Transaction: tt.tx, History: tt.history})
+
+			assert.Equal(t, tt.wantAction, d.Action)
+
+			rules := []string{}
+			for _, h := range d.Hits {
+				rules = append(rules, h.Rule)
+			}
+			if tt.wantRules == nil {
+				tt.wantRules = []string{}
+			}
+			assert.Equal(t, tt.wantRules, rules)
+		})
+	}
+}
+
+func TestLoadEngine(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "rules.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{"rules":[
+		{"name":"burst","type":"velocity","action":"block","window":"1m","max_count":5}
+	]}`), 0644))
+	_, err := fraud.LoadEngine(valid)
+	require.NoError(t, err)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	data, err := json.Marshal(fraud.Config{Rules: []fraud.Rule{
+		{Name: "burst", Type: fraud.RuleVelocity, Action: fraud.ActionAllow},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(invalid, data, 0644))
+	_, err = fraud.LoadEngine(invalid)
+	require.Error(t, err)
+
+	engine, err := fraud.LoadEngine(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err, "a missing file is an empty rule set")
+	d := engine.Evaluate(fraud.Input{Transaction: txAt(model.WithdrawTx, 1e9, 0)})
+	assert.Equal(t, fraud.ActionAllow, d.Action)
+
+	unreadable := filepath.Join(dir, "unreadable.json")
+	require.NoError(t, os.Mkdir(unreadable, 0755))
+	_, err = fraud.LoadEngine(unreadable)
+	require.Error(t, err)
+}
+
+func TestReviewQueue(t *testing.T) {
+	q := fraud.NewReviewQueue(filepath.Join(t.TempDir(), "review.json"))
+
+	item, err := q.Add(txAt(model.WithdrawTx, 790, 0), []fraud.Hit{{Rule: "pass-through", Action: fraud.ActionFlag}})
+	require.NoError(t, err)
+
+	open, err := q.List(fraud.ReviewOpen)
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+
+	resolved, err := q.Resolve(item.ID, "auditor-1", fraud.ReviewCleared, "salary")
+	require.NoError(t, err)
+	assert.Equal(t, "auditor-1", resolved.ReviewedBy)
+
+	_, err = q.Resolve(item.ID, "auditor-1", fraud.ReviewConfirmed, "")
+	require.ErrorIs(t, err, fraud.ErrReviewClosed)
+
+	open, err = q.List(fraud.ReviewOpen)
+	require.NoError(t, err)
+	assert.Empty(t, open)
+}
@@ -0,0 +1,161 @@
+package fraud
+
+import (
+	"bank-app/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewOpen      ReviewStatus = "open"
+	ReviewCleared   ReviewStatus = "cleared"
+	ReviewConfirmed ReviewStatus = "confirmed"
+)
+
+var (
+	ErrReviewNotFound = errors.New("review item not found")
+	ErrReviewClosed   = errors.New("review item already resolved")
+)
+
+type ReviewItem struct {
+	ID          string            `json:"id"`
+	Transaction model.Transaction `json:"transaction"`
+	Hits        []Hit             `json:"hits"`
+	Status      ReviewStatus      `json:"status"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ReviewedBy  string            `json:"reviewed_by,omitempty"`
+	ReviewedAt  time.Time         `json:"reviewed_at,omitzero"`
+	Note        string            `json:"note,omitempty"`
+}
+
+// ReviewQueue keeps flagged transactions until someone clears them as
+// legitimate or confirms them as fraud.
+type ReviewQueue struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewReviewQueue(path string) *ReviewQueue {
+	return &ReviewQueue{path: path}
+}
+
+func (q *ReviewQueue) Add(tx model.Transaction, hits []Hit) (ReviewItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.loadUnsafe()
+	if err != nil {
+		return ReviewItem{}, err
+	}
+
+	item := ReviewItem{
+		ID:          uuid.New().String(),
+		Transaction: tx,
+		Hits:        hits,
+		Status:      ReviewOpen,
+		CreatedAt:   time.Now(),
+	}
+	items = append(items, item)
+
+	if err := q.writeUnsafe(items); err != nil {
+		return ReviewItem{}, err
+	}
+
+	return item, nil
+}
+
+// List returns items in status, or all of them when status is empty.
+func (q *ReviewQueue) List(status ReviewStatus) ([]ReviewItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.loadUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []ReviewItem{}
+	for _, item := range items {
+		if status == "" || item.Status == status {
+			matched = append(matched, item)
+		}
+	}
+
+	return matched, nil
+}
+
+func (q *ReviewQueue) Resolve(id, reviewer string, status ReviewStatus, note string) (ReviewItem, error) {
+	if status != ReviewCleared && status != ReviewConfirmed {
+		return ReviewItem{}, fmt.Errorf("invalid review status %q", status)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items, err := q.loadUnsafe()
+	if err != nil {
+		return ReviewItem{}, err
+	}
+
+	i := slices.IndexFunc(items, func(item ReviewItem) bool { return item.ID == id })
+	if i < 0 {
+		return ReviewItem{}, fmt.Errorf("%w: %s", ErrReviewNotFound, id)
+	}
+	if items[i].Status != ReviewOpen {
+		return ReviewItem{}, fmt.Errorf("%w: %s", ErrReviewClosed, id)
+	}
+
+	items[i].Status = status
+	items[i].ReviewedBy = reviewer
+	items[i].ReviewedAt = time.Now()
+	items[i].Note = note
+
+	if err := q.writeUnsafe(items); err != nil {
+		return ReviewItem{}, err
+	}
+
+	return items[i], nil
+}
+
+func (q *ReviewQueue) loadUnsafe() ([]ReviewItem, error) {
+	items := []ReviewItem{}
+
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read review queue: %w", err)
+	}
+	if len(data) == 0 {
+		return items, nil
+	}
+
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("corrupted review queue: %w", err)
+	}
+
+	return items, nil
+}
+
+func (q *ReviewQueue) writeUnsafe(items []ReviewItem) error {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal review queue: %w", err)
+	}
+
+	if err := os.WriteFile(q.path, data, 0644); err != nil {
+		return fmt.Errorf("write review queue: %w", err)
+	}
+
+	return nil
+}
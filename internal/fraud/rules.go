@@ -0,0 +1,136 @@
+package fraud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var ErrBlocked = errors.New("blocked by fraud rules")
+
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionFlag  Action = "flag"
+	ActionBlock Action = "block"
+)
+
+func (a Action) severity() int {
+	switch a {
+	case ActionFlag:
+		return 1
+	case ActionBlock:
+		return 2
+	}
+
+	return 0
+}
+
+type RuleType string
+
+const (
+	// RuleVelocity fires when the account would see more than MaxCount
+	// transactions within Window.
+	RuleVelocity RuleType = "velocity"
+	// RuleAmountDeviation fires when the amount exceeds Factor times the
+	// account's average, once it has at least MinHistory transactions.
+	RuleAmountDeviation RuleType = "amount_deviation"
+	// RuleDepositThenWithdraw fires when money leaving the account is at
+	// least Ratio of what came in within Window.
+	RuleDepositThenWithdraw RuleType = "deposit_then_withdraw"
+	// RuleNewAccountWithdrawal fires when an account younger than MaxAge
+	// sends out MinAmount or more.
+	RuleNewAccountWithdrawal RuleType = "new_account_withdrawal"
+)
+
+// Duration reads "15m"-style strings from the rules file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Rule struct {
+	Name       string   `json:"name"`
+	Type       RuleType `json:"type"`
+	Action     Action   `json:"action"`
+	Window     Duration `json:"window,omitempty"`
+	MaxCount   int      `json:"max_count,omitempty"`
+	Factor     float64  `json:"factor,omitempty"`
+	MinHistory int      `json:"min_history,omitempty"`
+	Ratio      float64  `json:"ratio,omitempty"`
+	MaxAge     Duration `json:"max_age,omitempty"`
+	MinAmount  float64  `json:"min_amount,omitempty"`
+}
+
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without name")
+	}
+	if r.Action != ActionFlag && r.Action != ActionBlock {
+		return fmt.Errorf("rule %s: action must be flag or block", r.Name)
+	}
+
+	switch r.Type {
+	case RuleVelocity:
+		if r.Window <= 0 || r.MaxCount <= 0 {
+			return fmt.Errorf("rule %s: velocity needs window and max_count", r.Name)
+		}
+	case RuleAmountDeviation:
+		if r.Factor <= 1 {
+			return fmt.Errorf("rule %s: amount_deviation needs factor > 1", r.Name)
+		}
+	case RuleDepositThenWithdraw:
+		if r.Window <= 0 || r.Ratio <= 0 {
+			return fmt.Errorf("rule %s: deposit_then_withdraw needs window and ratio", r.Name)
+		}
+	case RuleNewAccountWithdrawal:
+		if r.MaxAge <= 0 || r.MinAmount <= 0 {
+			return fmt.Errorf("rule %s: new_account_withdrawal needs max_age and min_amount", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %s: unknown type %q", r.Name, r.Type)
+	}
+
+	return nil
+}
+
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadEngine reads the rules in path. Without the file there are no rules,
+// and every transaction is allowed.
+func LoadEngine(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewEngine(nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read fraud rules: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("corrupted fraud rules file: %w", err)
+	}
+
+	return NewEngine(cfg.Rules)
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Masked replaces the value of every sensitive attribute.
+const Masked = "***"
+
+// sensitiveKeys are masked wherever they appear, including inside groups.
+var sensitiveKeys = map[string]bool{
+	"owner":         true,
+	"secret":        true,
+	"token":         true,
+	"api_key":       true,
+	"authorization": true,
+	"password":      true,
+}
+
+type Config struct {
+	Level  string `json:"level" yaml:"level"`
+	Format string `json:"format" yaml:"format"`
+}
+
+// New builds a logger writing to w. An empty level means info and an empty
+// format means text.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: maskAttr,
+	}
+
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+
+	return level, nil
+}
+
+// Discard returns a logger that drops everything, the default for
+// components that were not given one.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+func maskAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Masked)
+	}
+
+	return a
+}
@@ -0,0 +1,72 @@
+package logging_test
+
+import (
+	"bank-app/internal/logging"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     logging.Config
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "json debug", cfg: logging.Config{Level: "debug", Format: "json"}},
+		{name: "text warn", cfg: logging.Config{Level: "WARN", Format: "text"}},
+		{name: "unknown level", cfg: logging.Config{Level: "loud"}, wantErr: true},
+		{name: "unknown format", cfg: logging.Config{Format: "xml"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, err := logging.New(&bytes.Buffer{}, tt.cfg)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, logger)
+		})
+	}
+}
+
+func TestNew_Level(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "warn"})
+	require.NoError(t, err)
+
+	logger.Info("dropped")
+	assert.Empty(t, buf.String())
+
+	logger.Warn("kept")
+	assert.Contains(t, buf.String(), "kept")
+}
+
+func TestNew_MasksSensitiveFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Format: "json"})
+	require.NoError(t, err)
+
+	logger.Info("open",
+		slog.String("account_id", "acc-1"),
+		slog.String("owner", "Anton"),
+		slog.Group("request", slog.String("Authorization", "Bearer abc")),
+		slog.String("api_key", "k1.s3cr3t"))
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+
+	assert.Equal(t, "acc-1", line["account_id"])
+	assert.Equal(t, logging.Masked, line["owner"])
+	assert.Equal(t, logging.Masked, line["api_key"])
+	assert.Equal(t, map[string]any{"Authorization": logging.Masked}, line["request"])
+	assert.NotContains(t, buf.String(), "Anton")
+	assert.NotContains(t, buf.String(), "s3cr3t")
+}
@@ -0,0 +1,109 @@
+package metrics_test
+
+import (
+	"bank-app/internal/metrics"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func render(t *testing.T, reg *metrics.Registry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	_, err := reg.WriteTo(&buf)
+	require.NoError(t, err)
+
+	return buf.String()
+}
+
+func TestRegistry_Counter(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.Counter("bank_deposits_total", "Deposits by outcome.", "outcome")
+
+	c.Inc("success")
+	c.Inc("success")
+	c.Add(3, "failure")
+
+	assert.Equal(t, 2.0, c.Value("success"))
+	assert.Equal(t, `# HELP bank_deposits_total Deposits by outcome.
+# TYPE bank_deposits_total counter
+bank_deposits_total{outcome="failure"} 3
+bank_deposits_total{outcome="success"} 2
+`, render(t, reg))
+
+	assert.Panics(t, func() { c.Add(-1, "success") })
+	assert.Panics(t, func() { c.Inc() })
+}
+
+func TestRegistry_Gauge(t *testing.T) {
+	reg := metrics.NewRegistry()
+	g := reg.Gauge("queue_depth", "Items waiting.")
+	g.Set(5)
+	g.Add(-2)
+
+	reg.GaugeFunc("accounts", "Accounts.", func() (float64, error) { return 7, nil })
+	reg.GaugeFunc("broken", "Always fails.", func() (float64, error) { return 0, errors.New("boom") })
+
+	assert.Equal(t, `# HELP queue_depth Items waiting.
+# TYPE queue_depth gauge
+queue_depth 3
+# HELP accounts Accounts.
+# TYPE accounts gauge
+accounts 7
+`, render(t, reg))
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+	reg := metrics.NewRegistry()
+	h := reg.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+
+	h.Observe(0.05, "load")
+	h.Observe(0.5, "load")
+	h.Observe(2, "load")
+
+	assert.Equal(t, uint64(3), h.Count("load"))
+	assert.Equal(t, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="load",le="0.1"} 1
+latency_seconds_bucket{op="load",le="1"} 2
+latency_seconds_bucket{op="load",le="+Inf"} 3
+latency_seconds_sum{op="load"} 2.55
+latency_seconds_count{op="load"} 3
+`, render(t, reg))
+}
+
+func TestRegistry_EscapesLabels(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Counter("errors_total", "Errors,\nby class.", "class").Inc("a \"quoted\" \\ value")
+
+	assert.Contains(t, render(t, reg), `# HELP errors_total Errors,\nby class.`)
+	assert.Contains(t, render(t, reg), `errors_total{class="a \"quoted\" \\ value"} 1`)
+}
+
+func TestRegistry_RejectsInvalidRegistrations(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Counter("ops_total", "Ops.")
+
+	assert.Panics(t, func() { reg.Counter("ops_total", "Again.") })
+	assert.Panics(t, func() { reg.Counter("bad-name", "Dash.") })
+	assert.Panics(t, func() { reg.Histogram("h", "Reserved label.", nil, "le") })
+	assert.Panics(t, func() { reg.Histogram("h2", "Unsorted.", []float64{1, 0.5}) })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Counter("ops_total", "Ops.").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	assert.Contains(t, rec.Body.String(), "ops_total 1\n")
+}
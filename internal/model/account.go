@@ -1,16 +1,43 @@
 package model
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
+
+type AccountStatus string
+
+const (
+	StatusActive AccountStatus = "active"
+	StatusFrozen AccountStatus = "frozen"
+	StatusClosed AccountStatus = "closed"
+)
 
+// Account has snake_case JSON names since data format version 2; before,
+// it was written with the Go field names ("ID", "CreatedAt"). The names
+// reach subscribers through the events that embed an account,
+// account_opened and the status changes, so a consumer of the outbox or of
+// an exported event log must read the new ones.
 type Account struct {
-	ID      string
-	Owner   string
-	Balance float64
+	ID      string        `json:"id"`
+	Owner   string        `json:"owner"`
+	Balance float64       `json:"balance"`
+	Status  AccountStatus `json:"status"`
+
+	// Version counts the changes made to the account, so that a writer can
+	// tell whether it still holds the latest state.
+	Version int64 `json:"version"`
+
+	CreatedAt time.Time `json:"created_at"`
 }
 
 var (
 	ErrInvalidAmount     = errors.New("invalid amount")
 	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrAccountFrozen     = errors.New("account is frozen")
+	ErrAccountClosed     = errors.New("account is closed")
+	ErrNonZeroBalance    = errors.New("account balance is not zero")
+	ErrInvalidStatus     = errors.New("invalid account status")
 )
 
 func NewAccount(id string, owner string, balance float64) *Account {
@@ -18,10 +45,17 @@ func NewAccount(id string, owner string, balance float64) *Account {
 		ID:      id,
 		Owner:   owner,
 		Balance: balance,
+		Status:  StatusActive,
+
+		CreatedAt: time.Now(),
 	}
 }
 
 func (a *Account) Apply(amount float64) error {
+	if err := a.checkOpen(); err != nil {
+		return err
+	}
+
 	if amount == 0 {
 		return ErrInvalidAmount
 	}
@@ -31,5 +65,41 @@ func (a *Account) Apply(amount float64) error {
 	}
 
 	a.Balance += amount
+	a.Version++
+	return nil
+}
+
+// SetStatus moves the account to status. Closed is final, and only an
+// account with a zero balance can be closed.
+func (a *Account) SetStatus(status AccountStatus) error {
+	if a.Status == StatusClosed {
+		return ErrAccountClosed
+	}
+
+	switch status {
+	case StatusActive, StatusFrozen:
+	case StatusClosed:
+		if a.Balance != 0 {
+			return ErrNonZeroBalance
+		}
+	default:
+		return ErrInvalidStatus
+	}
+
+	a.Status = status
+	a.Version++
+	return nil
+}
+
+// checkOpen treats an empty status, as found in accounts stored before
+// statuses existed, as active.
+func (a *Account) checkOpen() error {
+	switch a.Status {
+	case StatusFrozen:
+		return ErrAccountFrozen
+	case StatusClosed:
+		return ErrAccountClosed
+	}
+
 	return nil
 }
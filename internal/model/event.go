@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	AccountOpened   EventType = "account_opened"
+	MoneyDeposited  EventType = "money_deposited"
+	MoneyWithdrawn  EventType = "money_withdrawn"
+	AccountFrozen   EventType = "account_frozen"
+	AccountUnfrozen EventType = "account_unfrozen"
+	AccountClosed   EventType = "account_closed"
+)
+
+type Event struct {
+	ID          string       `json:"id"`
+	Seq         int64        `json:"seq"`
+	Type        EventType    `json:"type"`
+	AccountID   string       `json:"account_id"`
+	OccurredAt  time.Time    `json:"occurred_at"`
+	Account     *Account     `json:"account,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+}
+
+func NewAccountOpenedEvent(acc Account) Event {
+	return Event{
+		ID:         uuid.New().String(),
+		Type:       AccountOpened,
+		AccountID:  acc.ID,
+		OccurredAt: time.Now(),
+		Account:    &acc,
+	}
+}
+
+func NewAccountStatusEvent(acc Account) Event {
+	eventType := AccountUnfrozen
+	switch acc.Status {
+	case StatusFrozen:
+		eventType = AccountFrozen
+	case StatusClosed:
+		eventType = AccountClosed
+	}
+
+	return Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		AccountID:  acc.ID,
+		OccurredAt: time.Now(),
+		Account:    &acc,
+	}
+}
+
+func NewTransactionEvent(tx Transaction) Event {
+	eventType := MoneyDeposited
+	if tx.Type == WithdrawTx || tx.Type == TransferOutTx {
+		eventType = MoneyWithdrawn
+	}
+
+	return Event{
+		ID:          uuid.New().String(),
+		Type:        eventType,
+		AccountID:   tx.AccountID,
+		OccurredAt:  tx.CreatedAt,
+		Transaction: &tx,
+	}
+}
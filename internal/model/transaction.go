@@ -9,8 +9,10 @@ import (
 type TransactionType string
 
 const (
-	DepositTx  TransactionType = "deposit"
-	WithdrawTx TransactionType = "withdraw"
+	DepositTx     TransactionType = "deposit"
+	WithdrawTx    TransactionType = "withdraw"
+	TransferOutTx TransactionType = "transfer_out"
+	TransferInTx  TransactionType = "transfer_in"
 )
 
 type Transaction struct {
@@ -19,6 +21,25 @@ type Transaction struct {
 	Type      TransactionType `json:"type"`
 	Amount    float64         `json:"amount"`
 	CreatedAt time.Time       `json:"created_at"`
+	Actor     string          `json:"actor,omitempty"`
+
+	TransferID     string `json:"transfer_id,omitempty"`
+	CounterpartyID string `json:"counterparty_id,omitempty"`
+	ApprovedBy     string `json:"approved_by,omitempty"`
+	BatchID        string `json:"batch_id,omitempty"`
+
+	PrevHash        string `json:"prev_hash,omitempty"`
+	AccountPrevHash string `json:"account_prev_hash,omitempty"`
+	Hash            string `json:"hash,omitempty"`
+}
+
+// Delta is the change tx makes to the balance of its account.
+func (tx Transaction) Delta() float64 {
+	if tx.Type == WithdrawTx || tx.Type == TransferOutTx {
+		return -tx.Amount
+	}
+
+	return tx.Amount
 }
 
 func generateTransationID() string {
@@ -44,3 +65,31 @@ func NewWithdrawTransaction(accountID string, amount float64) Transaction {
 		CreatedAt: time.Now(),
 	}
 }
+
+// NewTransferTransactions returns the two legs of a transfer: the debit of
+// from and the credit of to, linked by a shared TransferID.
+func NewTransferTransactions(from, to string, amount float64) (Transaction, Transaction) {
+	transferID := generateTransationID()
+	now := time.Now()
+
+	out := Transaction{
+		ID:             generateTransationID(),
+		AccountID:      from,
+		Type:           TransferOutTx,
+		Amount:         amount,
+		CreatedAt:      now,
+		TransferID:     transferID,
+		CounterpartyID: to,
+	}
+	in := Transaction{
+		ID:             generateTransationID(),
+		AccountID:      to,
+		Type:           TransferInTx,
+		Amount:         amount,
+		CreatedAt:      now,
+		TransferID:     transferID,
+		CounterpartyID: from,
+	}
+
+	return out, in
+}
@@ -0,0 +1,209 @@
+package outbox
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Handler func(ctx context.Context, e model.Event) error
+
+// Dispatcher delivers outbox events at least once to every registered
+// handler. Events of one account are delivered in commit order: while an
+// event is waiting for a retry, later events of the same account wait too.
+type Dispatcher struct {
+	source storage.Outbox
+
+	interval    time.Duration
+	batchSize   int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+	onError     func(error)
+
+	mu       sync.Mutex
+	names    []string
+	handlers map[string]Handler
+	retries  map[string]*retryState
+}
+
+type retryState struct {
+	attempts  int
+	nextTry   time.Time
+	delivered map[string]bool
+}
+
+type Option func(*Dispatcher)
+
+func WithInterval(d time.Duration) Option {
+	return func(disp *Dispatcher) {
+		disp.interval = d
+	}
+}
+
+func WithBatchSize(n int) Option {
+	return func(disp *Dispatcher) {
+		disp.batchSize = n
+	}
+}
+
+func WithBackoff(base, max time.Duration) Option {
+	return func(disp *Dispatcher) {
+		disp.baseBackoff = base
+		disp.maxBackoff = max
+	}
+}
+
+func WithErrorHandler(fn func(error)) Option {
+	return func(disp *Dispatcher) {
+		disp.onError = fn
+	}
+}
+
+func NewDispatcher(source storage.Outbox, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		source:      source,
+		interval:    time.Second,
+		batchSize:   100,
+		baseBackoff: 500 * time.Millisecond,
+		maxBackoff:  time.Minute,
+		now:         time.Now,
+		onError:     func(error) {},
+		handlers:    make(map[string]Handler),
+		retries:     make(map[string]*retryState),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+func (d *Dispatcher) Register(name string, h Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.handlers[name]; !ok {
+		d.names = append(d.names, name)
+	}
+	d.handlers[name] = h
+}
+
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchPending(ctx); err != nil && ctx.Err() == nil {
+			d.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending makes one pass over the outbox and returns the number of
+// events that were delivered to all handlers. A pass tries at most
+// batchSize events. The events of blocked accounts stay at the head of the
+// outbox, so the pass pages past them rather than let them starve the
+// other accounts.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	blocked := make(map[string]bool)
+	seen := make(map[string]bool)
+	delivered, tried := 0, 0
+
+	for limit := d.batchSize; ; {
+		events, err := d.source.PendingEvents(limit)
+		if err != nil {
+			return delivered, fmt.Errorf("load pending events: %w", err)
+		}
+
+		for _, e := range events {
+			if ctx.Err() != nil {
+				return delivered, ctx.Err()
+			}
+			if seen[e.ID] {
+				continue
+			}
+			seen[e.ID] = true
+			if blocked[e.AccountID] {
+				continue
+			}
+
+			state := d.retries[e.ID]
+			if state != nil && d.now().Before(state.nextTry) {
+				blocked[e.AccountID] = true
+				continue
+			}
+
+			tried++
+			if d.deliverLocked(ctx, e) {
+				if err := d.source.MarkDispatched(e.ID); err != nil {
+					return delivered, fmt.Errorf("mark event %s dispatched: %w", e.ID, err)
+				}
+				delete(d.retries, e.ID)
+				delivered++
+			} else {
+				blocked[e.AccountID] = true
+			}
+			if d.batchSize > 0 && tried >= d.batchSize {
+				return delivered, nil
+			}
+		}
+
+		// The next page starts after the events left in the outbox.
+		if limit <= 0 || len(events) < limit {
+			return delivered, nil
+		}
+		limit = len(seen) - delivered + d.batchSize
+	}
+}
+
+func (d *Dispatcher) deliverLocked(ctx context.Context, e model.Event) bool {
+	state := d.retries[e.ID]
+	if state == nil {
+		state = &retryState{delivered: make(map[string]bool)}
+		d.retries[e.ID] = state
+	}
+
+	ok := true
+	for _, name := range d.names {
+		if state.delivered[name] {
+			continue
+		}
+		if err := d.handlers[name](ctx, e); err != nil {
+			ok = false
+			continue
+		}
+		state.delivered[name] = true
+	}
+
+	if !ok {
+		state.attempts++
+		state.nextTry = d.now().Add(d.backoff(state.attempts))
+	}
+
+	return ok
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.baseBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+
+	return delay
+}
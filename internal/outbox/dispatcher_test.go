@@ -0,0 +1,121 @@
+package outbox_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/outbox"
+	"bank-app/internal/storage"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOutboxStorage(t *testing.T) *storage.FileStorage {
+	t.Helper()
+
+	dir := t.TempDir()
+	return storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json")))
+}
+
+func TestDispatcher_RetriesInAccountOrder(t *testing.T) {
+	fs := newOutboxStorage(t)
+
+	require.NoError(t, fs.SaveNewAccount(model.Account{ID: "a", Owner: "Anton"}))
+	require.NoError(t, fs.SaveNewAccount(model.Account{ID: "b", Owner: "Stas"}))
+	require.NoError(t, fs.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	require.NoError(t, fs.ApplyTransaction("b", 20, model.NewDepositTransaction("b", 20)))
+
+	var got []string
+	failOnce := true
+
+	d := outbox.NewDispatcher(fs, outbox.WithBackoff(0, 0))
+	d.Register("recorder", func(ctx context.Context, e model.Event) error {
+		if e.AccountID == "a" && e.Type == model.AccountOpened && failOnce {
+			failOnce = false
+			return errors.New("receiver down")
+		}
+		got = append(got, e.AccountID+":"+string(e.Type))
+		return nil
+	})
+
+	n, err := d.DispatchPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"b:account_opened", "b:money_deposited"}, got)
+
+	n, err = d.DispatchPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{
+		"b:account_opened", "b:money_deposited",
+		"a:account_opened", "a:money_deposited",
+	}, got)
+
+	pending, err := fs.PendingEvents(0)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestDispatcher_RedeliversOnlyToFailedHandler(t *testing.T) {
+	fs := newOutboxStorage(t)
+	require.NoError(t, fs.SaveNewAccount(model.Account{ID: "a", Owner: "Anton"}))
+
+	calls := map[string]int{}
+	failOnce := true
+
+	d := outbox.NewDispatcher(fs, outbox.WithBackoff(0, 0))
+	d.Register("ok", func(ctx context.Context, e model.Event) error {
+		calls["ok"]++
+		return nil
+	})
+	d.Register("flaky", func(ctx context.Context, e model.Event) error {
+		calls["flaky"]++
+		if failOnce {
+			failOnce = false
+			return errors.New("timeout")
+		}
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := d.DispatchPending(context.Background())
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, map[string]int{"ok": 1, "flaky": 2}, calls)
+}
+
+func TestDispatcher_PagesPastBlockedAccounts(t *testing.T) {
+	fs := newOutboxStorage(t)
+	require.NoError(t, fs.SaveNewAccount(model.Account{ID: "a", Owner: "Anton"}))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+	}
+	require.NoError(t, fs.SaveNewAccount(model.Account{ID: "b", Owner: "Stas"}))
+
+	var got []string
+	d := outbox.NewDispatcher(fs, outbox.WithBatchSize(2), outbox.WithBackoff(time.Hour, time.Hour))
+	d.Register("recorder", func(ctx context.Context, e model.Event) error {
+		if e.AccountID == "a" {
+			return errors.New("receiver down")
+		}
+		got = append(got, e.AccountID+":"+string(e.Type))
+		return nil
+	})
+
+	n, err := d.DispatchPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "the events of b come after a whole batch of a")
+	assert.Equal(t, []string{"b:account_opened"}, got)
+
+	pending, err := fs.PendingEvents(0)
+	require.NoError(t, err)
+	assert.Len(t, pending, 5, "the events of a wait for their retry")
+}
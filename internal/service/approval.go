@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bank-app/internal/approval"
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrApprovalRequired = errors.New("approval required")
+
+// ApprovalRequiredError is returned instead of executing an operation above
+// the approval threshold; the operation has been stored as pending.
+type ApprovalRequiredError struct {
+	Operation approval.Operation
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return fmt.Sprintf("operation %s awaits approval", e.Operation.ID)
+}
+
+func (e *ApprovalRequiredError) Unwrap() error {
+	return ErrApprovalRequired
+}
+
+type approvalPolicy struct {
+	store     *approval.Store
+	threshold float64
+	ttl       time.Duration
+
+	// mu runs one approval at a time, so that an operation found approved
+	// but not completed is one whose approval was cut short, not one
+	// executing right now.
+	mu sync.Mutex
+}
+
+// WithApprovals routes withdrawals and transfers above threshold through
+// the maker-checker workflow: they wait in store until a different principal
+// approves them, or expire after ttl.
+func WithApprovals(store *approval.Store, threshold float64, ttl time.Duration) Option {
+	return func(s *service) {
+		s.approvals = &approvalPolicy{
+			store:     store,
+			threshold: threshold,
+			ttl:       ttl,
+		}
+	}
+}
+
+func (s *service) needsApproval(amount float64) bool {
+	return s.approvals != nil && amount > s.approvals.threshold
+}
+
+func (s *service) requestApproval(ctx context.Context, op approval.Operation) error {
+	op.RequestedBy = actor(ctx)
+
+	created, err := s.approvals.store.Create(op, s.approvals.ttl)
+	if err != nil {
+		return err
+	}
+
+	return &ApprovalRequiredError{Operation: created}
+}
+
+func (s *service) PendingOperations(ctx context.Context) ([]approval.Operation, error) {
+	if s.approvals == nil {
+		return []approval.Operation{}, nil
+	}
+	if err := s.authorize(ctx, auth.ActionApprove, ""); err != nil {
+		return nil, err
+	}
+
+	return s.approvals.store.List(approval.StatusPending)
+}
+
+// ApproveOperation lets a checker approve a pending operation, which then
+// runs through the same storage path as an immediate one. The returned
+// operation is executed, or failed with the reason.
+//
+// Approving, executing and recording the outcome are separate writes. An
+// operation left approved by a crash or a failed write in between is
+// finished by approving it again: it is executed only if its transactions
+// are not in storage yet.
+func (s *service) ApproveOperation(
+	ctx context.Context, operationID string) (op approval.Operation, err error) {
+	c := s.begin(ctx, audit.ActionApprove, "", map[string]any{"operation_id": operationID})
+	defer func() {
+		c.accountID, c.amount = op.AccountID, op.Amount
+		s.end(c, err)
+	}()
+
+	if err := s.checkApprover(ctx); err != nil {
+		return approval.Operation{}, err
+	}
+
+	s.approvals.mu.Lock()
+	defer s.approvals.mu.Unlock()
+
+	op, err = s.approvals.store.Decide(operationID, actor(ctx), approval.StatusApproved, "")
+	resume := false
+	if errors.Is(err, approval.ErrNotPending) {
+		op, resume, err = s.resumable(ctx, operationID, err)
+	}
+	if err != nil {
+		return approval.Operation{}, err
+	}
+
+	done := false
+	if resume {
+		if done, err = s.executed(op); err != nil {
+			return op, err
+		}
+	}
+	var execErr error
+	if !done {
+		execErr = s.execute(ctx, op)
+		s.countExecution(op.Type, execErr)
+	}
+
+	op, err = s.approvals.store.Complete(op.ID, execErr)
+	if err != nil {
+		return op, err
+	}
+
+	return op, execErr
+}
+
+// resumable returns the operation if it was approved but its outcome never
+// recorded, and notPending otherwise.
+func (s *service) resumable(ctx context.Context, operationID string,
+	notPending error) (approval.Operation, bool, error) {
+	op, err := s.approvals.store.Get(operationID)
+	if err != nil {
+		return approval.Operation{}, false, err
+	}
+	if op.Status != approval.StatusApproved {
+		return approval.Operation{}, false, notPending
+	}
+	if op.RequestedBy == actor(ctx) {
+		return approval.Operation{}, false, approval.ErrSelfApproval
+	}
+
+	return op, true, nil
+}
+
+// executed tells whether the transactions of op are in storage already.
+func (s *service) executed(op approval.Operation) (bool, error) {
+	txs, err := s.repo.LoadTransactions()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.ContainsFunc(txs, func(tx model.Transaction) bool {
+		return tx.ID == op.ID || (op.Type == approval.OpTransfer && tx.TransferID == op.ID)
+	}), nil
+}
+
+func (s *service) RejectOperation(
+	ctx context.Context, operationID, reason string) (op approval.Operation, err error) {
+	c := s.begin(ctx, audit.ActionReject, "",
+		map[string]any{"operation_id": operationID, "reason": reason})
+	defer func() {
+		c.accountID, c.amount = op.AccountID, op.Amount
+		s.end(c, err)
+	}()
+
+	if err := s.checkApprover(ctx); err != nil {
+		return approval.Operation{}, err
+	}
+
+	return s.approvals.store.Decide(operationID, actor(ctx), approval.StatusRejected, reason)
+}
+
+func (s *service) checkApprover(ctx context.Context) error {
+	if s.approvals == nil {
+		return fmt.Errorf("%w: approvals are not enabled", approval.ErrNotFound)
+	}
+
+	return s.authorize(ctx, auth.ActionApprove, "")
+}
+
+// execute runs an approved operation. Its transactions are named after it,
+// the withdrawal by ID and the transfer by TransferID, so that executed can
+// find them.
+func (s *service) execute(ctx context.Context, op approval.Operation) error {
+	switch op.Type {
+	case approval.OpWithdraw:
+		tx := model.NewWithdrawTransaction(op.AccountID, op.Amount)
+		tx.ID = op.ID
+		tx.Actor = op.RequestedBy
+		tx.ApprovedBy = op.DecidedBy
+		return s.apply(ctx, op.AccountID, -op.Amount, tx)
+	case approval.OpTransfer:
+		out, in := model.NewTransferTransactions(op.AccountID, op.TargetAccountID, op.Amount)
+		for _, tx := range []*model.Transaction{&out, &in} {
+			tx.TransferID = op.ID
+			tx.Actor = op.RequestedBy
+			tx.ApprovedBy = op.DecidedBy
+		}
+		return s.transfer(ctx, op.AccountID, op.TargetAccountID, op.Amount, out, in)
+	default:
+		return fmt.Errorf("unknown operation type %q", op.Type)
+	}
+}
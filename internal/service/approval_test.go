@@ -0,0 +1,156 @@
+package service_test
+
+import (
+	"bank-app/internal/approval"
+	"bank-app/internal/auth"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func as(subject string) context.Context {
+	return auth.WithIdentity(context.Background(), auth.Identity{Subject: subject})
+}
+
+func newApprovalService(t *testing.T, repo storage.Storage) service.Service {
+	t.Helper()
+
+	store := approval.NewStore(filepath.Join(t.TempDir(), "pending.json"))
+	return service.NewService(repo, service.WithApprovals(store, 1000, time.Hour))
+}
+
+func TestService_ApprovalFlow(t *testing.T) {
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Balance: 5000},
+		model.Account{ID: "b", Owner: "stas"})
+	svc := newApprovalService(t, repo)
+
+	require.NoError(t, svc.Withdraw(as("maker"), "a", 1000), "at the threshold runs at once")
+
+	err := svc.Transfer(as("maker"), "a", "b", 2500)
+	require.ErrorIs(t, err, service.ErrApprovalRequired)
+
+	var pending *service.ApprovalRequiredError
+	require.ErrorAs(t, err, &pending)
+	assert.Equal(t, approval.StatusPending, pending.Operation.Status)
+	assert.Equal(t, 1, repo.Calls(storage.OpApplyTransaction))
+	assert.Zero(t, repo.Calls(storage.OpTransfer), "nothing moves before approval")
+
+	ops, err := svc.PendingOperations(as("checker"))
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+
+	_, err = svc.ApproveOperation(as("maker"), pending.Operation.ID)
+	require.ErrorIs(t, err, approval.ErrSelfApproval)
+
+	op, err := svc.ApproveOperation(as("checker"), pending.Operation.ID)
+	require.NoError(t, err)
+	assert.Equal(t, approval.StatusExecuted, op.Status)
+
+	balance, err := svc.CheckBalance(context.Background(), "b")
+	require.NoError(t, err)
+	assert.Equal(t, 2500.0, balance)
+
+	txs, err := svc.Transactions(context.Background(), "b")
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, "maker", txs[0].Actor)
+	assert.Equal(t, "checker", txs[0].ApprovedBy)
+
+	_, err = svc.ApproveOperation(as("checker"), pending.Operation.ID)
+	require.ErrorIs(t, err, approval.ErrNotPending)
+}
+
+func TestService_ApprovedOperationCanStillFail(t *testing.T) {
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 5000})
+	svc := newApprovalService(t, repo)
+
+	var pending *service.ApprovalRequiredError
+	require.ErrorAs(t, svc.Withdraw(as("maker"), "a", 4000), &pending)
+
+	require.NoError(t, svc.Withdraw(as("maker"), "a", 900))
+	require.NoError(t, svc.Withdraw(as("maker"), "a", 900))
+
+	op, err := svc.ApproveOperation(as("checker"), pending.Operation.ID)
+	require.ErrorIs(t, err, model.ErrInsufficientFunds)
+	assert.Equal(t, approval.StatusFailed, op.Status)
+}
+
+func TestService_ApproveFinishesInterruptedApproval(t *testing.T) {
+	tests := []struct {
+		name     string
+		executed bool
+	}{
+		{name: "approved, not executed"},
+		{name: "executed, outcome not recorded", executed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 5000})
+			store := approval.NewStore(filepath.Join(t.TempDir(), "pending.json"))
+			svc := service.NewService(repo, service.WithApprovals(store, 1000, time.Hour))
+
+			var pending *service.ApprovalRequiredError
+			require.ErrorAs(t, svc.Withdraw(as("maker"), "a", 4000), &pending)
+
+			// The approval stopped after the decision was written, or after
+			// the withdrawal too.
+			_, err := store.Decide(pending.Operation.ID, "checker", approval.StatusApproved, "")
+			require.NoError(t, err)
+			if tt.executed {
+				tx := model.NewWithdrawTransaction("a", 4000)
+				tx.ID = pending.Operation.ID
+				require.NoError(t, repo.ApplyTransaction("a", -4000, tx))
+			}
+
+			_, err = svc.ApproveOperation(as("maker"), pending.Operation.ID)
+			require.ErrorIs(t, err, approval.ErrSelfApproval)
+
+			op, err := svc.ApproveOperation(as("checker"), pending.Operation.ID)
+			require.NoError(t, err)
+			assert.Equal(t, approval.StatusExecuted, op.Status)
+
+			balance, err := svc.CheckBalance(context.Background(), "a")
+			require.NoError(t, err)
+			assert.Equal(t, 1000.0, balance, "the withdrawal ran exactly once")
+
+			_, err = svc.ApproveOperation(as("checker"), pending.Operation.ID)
+			require.ErrorIs(t, err, approval.ErrNotPending)
+		})
+	}
+}
+
+func TestService_RejectOperation(t *testing.T) {
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 5000})
+	svc := newApprovalService(t, repo)
+
+	var pending *service.ApprovalRequiredError
+	require.ErrorAs(t, svc.Withdraw(as("maker"), "a", 4000), &pending)
+
+	op, err := svc.RejectOperation(as("checker"), pending.Operation.ID, "looks odd")
+	require.NoError(t, err)
+	assert.Equal(t, approval.StatusRejected, op.Status)
+	assert.Equal(t, "looks odd", op.Reason)
+
+	balance, err := svc.CheckBalance(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, 5000.0, balance)
+}
+
+func TestService_ApprovalsDisabled(t *testing.T) {
+	svc := service.NewService(storage.NewMemoryStorage())
+
+	ops, err := svc.PendingOperations(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+
+	_, err = svc.ApproveOperation(context.Background(), "op")
+	require.ErrorIs(t, err, approval.ErrNotFound)
+}
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/fraud"
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// ErrBatchRejected is returned for an atomic batch that was not applied
+// because some of its items failed.
+var ErrBatchRejected = storage.ErrBatchRejected
+
+// MaxBatchItems bounds a batch, which is committed in a single write.
+const MaxBatchItems = 10000
+
+type BatchMode string
+
+const (
+	// BatchAtomic applies every item or none of them.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort applies the items that can be applied and reports
+	// the others.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+type InstructionType string
+
+const (
+	InstructionDeposit  InstructionType = "deposit"
+	InstructionWithdraw InstructionType = "withdraw"
+	InstructionTransfer InstructionType = "transfer"
+)
+
+// Instruction is one item of a batch. ToAccountID is only used by transfers.
+type Instruction struct {
+	Type        InstructionType `json:"type"`
+	AccountID   string          `json:"account_id"`
+	ToAccountID string          `json:"to_account_id,omitempty"`
+	Amount      float64         `json:"amount"`
+}
+
+type ItemStatus string
+
+const (
+	ItemApplied ItemStatus = "applied"
+	ItemFailed  ItemStatus = "failed"
+	// ItemSkipped marks a valid item of an atomic batch that was not
+	// applied because of another item.
+	ItemSkipped ItemStatus = "skipped"
+)
+
+type ItemResult struct {
+	Index          int        `json:"index"`
+	Status         ItemStatus `json:"status"`
+	TransactionIDs []string   `json:"transaction_ids,omitempty"`
+	Error          string     `json:"error,omitempty"`
+
+	// Err is the error behind Error, for callers that need to inspect it.
+	Err error `json:"-"`
+}
+
+type BatchResult struct {
+	BatchID string       `json:"batch_id"`
+	Mode    BatchMode    `json:"mode"`
+	Applied int          `json:"applied"`
+	Failed  int          `json:"failed"`
+	Items   []ItemResult `json:"items"`
+}
+
+func (r *BatchResult) fail(i int, err error) {
+	r.Items[i].Status = ItemFailed
+	r.Items[i].Err = err
+	r.Items[i].Error = err.Error()
+	r.Failed++
+}
+
+// rejection describes the first failed item of a rejected atomic batch.
+func (r *BatchResult) rejection() error {
+	for _, item := range r.Items {
+		if item.Status == ItemFailed {
+			return fmt.Errorf("%w: %d of %d items failed, first at item %d: %s",
+				ErrBatchRejected, r.Failed, len(r.Items), item.Index, item.Error)
+		}
+	}
+
+	return ErrBatchRejected
+}
+
+// ApplyBatch applies many deposits, withdrawals and transfers in a single
+// storage commit, and stamps every resulting transaction with the batch
+// ID. Items are checked like the single operations, except that amounts
+// above the approval threshold are refused instead of queued, and fraud
+// rules see the items before each one as if they were applied already.
+// Every item is audited on its own, under its account. Like the single
+// operations, a batch whose accounts change between the fraud checks and
+// the commit is retried.
+//
+// An atomic batch with failing items returns ErrBatchRejected together
+// with the result, which tells which items failed.
+func (s *service) ApplyBatch(ctx context.Context, mode BatchMode,
+	instructions []Instruction) (result BatchResult, err error) {
+	result = BatchResult{
+		BatchID: uuid.New().String(),
+		Mode:    mode,
+		Items:   make([]ItemResult, len(instructions)),
+	}
+
+	if err := checkBatch(mode, instructions); err != nil {
+		s.end(s.begin(ctx, audit.ActionApplyBatch, "", map[string]any{
+			"batch_id": result.BatchID,
+			"mode":     mode,
+			"items":    len(instructions),
+		}), err)
+		return result, err
+	}
+	defer s.auditItems(ctx, instructions, &result)
+
+	postings := make([][]storage.Posting, len(instructions))
+	for i, in := range instructions {
+		result.Items[i].Index = i
+		if postings[i], err = s.prepare(ctx, result.BatchID, in); err != nil {
+			result.fail(i, err)
+		}
+	}
+
+	// The fraud checks depend on the accounts as they were read, so the
+	// batch is screened again if one of them changes before the commit.
+	prepared := result
+	err = s.retry(ctx, "", func() error {
+		result = prepared
+		result.Items = slices.Clone(prepared.Items)
+		return s.applyBatch(&result, postings)
+	})
+	return result, err
+}
+
+// applyBatch screens and commits the prepared items, those with postings.
+func (s *service) applyBatch(result *BatchResult, prepared [][]storage.Posting) error {
+	screener, err := s.newBatchScreener()
+	if err != nil {
+		for i, postings := range prepared {
+			if postings != nil {
+				result.fail(i, err)
+			}
+		}
+		return err
+	}
+
+	batch := storage.Batch{Atomic: result.Mode == BatchAtomic}
+	var (
+		indexes   []int
+		decisions [][]fraud.Decision
+	)
+	for i, postings := range prepared {
+		if postings == nil {
+			continue
+		}
+
+		screened := make([]fraud.Decision, len(postings))
+		for j := range postings {
+			if screened[j], err = screener.screen(postings[j].Transaction); err != nil {
+				break
+			}
+			postings[j].Version, postings[j].CheckVersion = screener.version(postings[j].AccountID)
+		}
+		if err != nil {
+			result.fail(i, err)
+			continue
+		}
+		for _, p := range postings {
+			screener.stage(p.Transaction)
+		}
+
+		batch.Items = append(batch.Items, postings)
+		indexes = append(indexes, i)
+		decisions = append(decisions, screened)
+	}
+
+	if len(batch.Items) == 0 || (batch.Atomic && result.Failed > 0) {
+		return s.finishRejected(result, indexes)
+	}
+
+	errs, err := s.repo.ApplyBatch(batch)
+	if err != nil && !errors.Is(err, storage.ErrBatchRejected) {
+		for _, i := range indexes {
+			result.fail(i, err)
+		}
+		return err
+	}
+
+	var applied []model.Transaction
+	for k, i := range indexes {
+		switch {
+		case errs[k] != nil:
+			result.fail(i, errs[k])
+		case err != nil:
+			result.Items[i].Status = ItemSkipped
+		default:
+			result.Items[i].Status = ItemApplied
+			result.Applied++
+
+			for j, p := range batch.Items[k] {
+				result.Items[i].TransactionIDs = append(result.Items[i].TransactionIDs, p.Transaction.ID)
+				s.flag(p.Transaction, decisions[k][j])
+				applied = append(applied, p.Transaction)
+			}
+		}
+	}
+	s.notify(applied...)
+
+	if err != nil {
+		return result.rejection()
+	}
+	return nil
+}
+
+func checkBatch(mode BatchMode, instructions []Instruction) error {
+	switch {
+	case mode != BatchAtomic && mode != BatchBestEffort:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidBatch, mode)
+	case len(instructions) == 0:
+		return fmt.Errorf("%w: no items", ErrInvalidBatch)
+	case len(instructions) > MaxBatchItems:
+		return fmt.Errorf("%w: %d items, at most %d allowed",
+			ErrInvalidBatch, len(instructions), MaxBatchItems)
+	}
+
+	return nil
+}
+
+// auditItems records the outcome of every item of a batch as if it had
+// been submitted on its own, with the batch ID among the parameters.
+func (s *service) auditItems(ctx context.Context, instructions []Instruction, result *BatchResult) {
+	for i, in := range instructions {
+		params := map[string]any{"batch_id": result.BatchID, "index": i, "amount": in.Amount}
+		if in.Type == InstructionTransfer {
+			params["to"] = in.ToAccountID
+		}
+		c := s.begin(ctx, in.action(), in.AccountID, params)
+
+		item := result.Items[i]
+		if len(item.TransactionIDs) > 0 {
+			c.transactionID = item.TransactionIDs[0]
+		}
+		var err error
+		switch item.Status {
+		case ItemFailed:
+			err = item.Err
+		case ItemSkipped:
+			err = ErrBatchRejected
+		}
+		s.end(c, err)
+	}
+}
+
+// finishRejected ends a batch that never reached storage: in atomic mode
+// the valid items are skipped, and if nothing was valid there is nothing
+// to apply either way.
+func (s *service) finishRejected(result *BatchResult, valid []int) error {
+	for _, i := range valid {
+		result.Items[i].Status = ItemSkipped
+	}
+	if result.Mode == BatchBestEffort && len(valid) == 0 {
+		return nil
+	}
+
+	return result.rejection()
+}
+
+// prepare checks in the way the matching single operation would and
+// returns its postings.
+func (s *service) prepare(ctx context.Context, batchID string, in Instruction) ([]storage.Posting, error) {
+	if in.AccountID == "" || (in.Type == InstructionTransfer && in.ToAccountID == "") {
+		return nil, ErrEmptyID
+	}
+
+	var postings []storage.Posting
+	switch in.Type {
+	case InstructionDeposit:
+		if err := s.authorize(ctx, auth.ActionDeposit, in.AccountID); err != nil {
+			return nil, err
+		}
+		if in.Amount <= 0 {
+			return nil, ErrNonPositiveAmount
+		}
+
+		postings = []storage.Posting{{AccountID: in.AccountID, Amount: in.Amount,
+			Transaction: model.NewDepositTransaction(in.AccountID, in.Amount)}}
+	case InstructionWithdraw, InstructionTransfer:
+		if err := s.authorize(ctx, auth.ActionWithdraw, in.AccountID); err != nil {
+			return nil, err
+		}
+		if in.Type == InstructionTransfer && in.AccountID == in.ToAccountID {
+			return nil, ErrSameAccount
+		}
+		if in.Amount <= 0 {
+			return nil, ErrNonPositiveAmount
+		}
+		if s.needsApproval(in.Amount) {
+			return nil, fmt.Errorf("%w: %v is above the approval threshold, submit it on its own",
+				ErrApprovalRequired, in.Amount)
+		}
+
+		if in.Type == InstructionWithdraw {
+			postings = []storage.Posting{{AccountID: in.AccountID, Amount: -in.Amount,
+				Transaction: model.NewWithdrawTransaction(in.AccountID, in.Amount)}}
+			break
+		}
+		out, inTx := model.NewTransferTransactions(in.AccountID, in.ToAccountID, in.Amount)
+		postings = []storage.Posting{
+			{AccountID: in.AccountID, Amount: -in.Amount, Transaction: out},
+			{AccountID: in.ToAccountID, Amount: in.Amount, Transaction: inTx},
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown instruction type %q", ErrInvalidBatch, in.Type)
+	}
+
+	for i := range postings {
+		postings[i].Transaction.Actor = actor(ctx)
+		postings[i].Transaction.BatchID = batchID
+	}
+	return postings, nil
+}
+
+func (in Instruction) action() string {
+	switch in.Type {
+	case InstructionDeposit:
+		return audit.ActionDeposit
+	case InstructionWithdraw:
+		return audit.ActionWithdraw
+	case InstructionTransfer:
+		return audit.ActionTransfer
+	default:
+		return audit.ActionApplyBatch
+	}
+}
+
+// batchScreener runs the fraud checks for the transactions of a batch. It
+// loads the log and each account only once, and stage makes an accepted
+// transaction part of what the later ones are checked against, so that
+// splitting an amount across items does not get around the rules.
+type batchScreener struct {
+	s        *service
+	history  map[string][]model.Transaction
+	accounts map[string]*model.Account
+}
+
+func (s *service) newBatchScreener() (*batchScreener, error) {
+	b := &batchScreener{s: s, accounts: make(map[string]*model.Account)}
+	if s.fraud == nil {
+		return b, nil
+	}
+
+	txs, err := s.repo.LoadTransactions()
+	if err != nil {
+		return nil, err
+	}
+	b.history = make(map[string][]model.Transaction)
+	for _, tx := range txs {
+		b.history[tx.AccountID] = append(b.history[tx.AccountID], tx)
+	}
+
+	return b, nil
+}
+
+func (b *batchScreener) screen(tx model.Transaction) (fraud.Decision, error) {
+	if b.s.fraud == nil {
+		return fraud.Decision{Action: fraud.ActionAllow}, nil
+	}
+
+	acc, ok := b.accounts[tx.AccountID]
+	if !ok {
+		loaded, err := b.s.repo.LoadAccount(tx.AccountID)
+		if err != nil {
+			return fraud.Decision{Action: fraud.ActionAllow}, err
+		}
+		b.accounts[tx.AccountID], acc = loaded, loaded
+	}
+
+	return b.s.evaluate(*acc, tx, b.history[tx.AccountID])
+}
+
+// version returns the version of the account as screened, if it was read.
+func (b *batchScreener) version(accountID string) (int64, bool) {
+	acc, ok := b.accounts[accountID]
+	if !ok {
+		return 0, false
+	}
+
+	return acc.Version, true
+}
+
+func (b *batchScreener) stage(tx model.Transaction) {
+	if b.s.fraud == nil {
+		return
+	}
+
+	b.history[tx.AccountID] = append(b.history[tx.AccountID], tx)
+	if acc, ok := b.accounts[tx.AccountID]; ok {
+		acc.Balance += tx.Delta()
+	}
+}
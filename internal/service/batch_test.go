@@ -0,0 +1,274 @@
+package service_test
+
+import (
+	"bank-app/internal/audit"
+	"bank-app/internal/fraud"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ApplyBatchBestEffort(t *testing.T) {
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "employer", Owner: "acme", Balance: 1000},
+		model.Account{ID: "a", Owner: "anton"},
+		model.Account{ID: "b", Owner: "stas"})
+
+	var notified []model.Transaction
+	svc := service.NewService(repo, service.WithTransactionListener(func(tx model.Transaction) {
+		notified = append(notified, tx)
+	}))
+
+	result, err := svc.ApplyBatch(context.Background(), service.BatchBestEffort, []service.Instruction{
+		{Type: service.InstructionTransfer, AccountID: "employer", ToAccountID: "a", Amount: 400},
+		{Type: service.InstructionTransfer, AccountID: "employer", ToAccountID: "b", Amount: 400},
+		{Type: service.InstructionTransfer, AccountID: "employer", ToAccountID: "missing", Amount: 100},
+		{Type: service.InstructionWithdraw, AccountID: "employer", Amount: 500},
+		{Type: service.InstructionDeposit, AccountID: "a", Amount: -1},
+		{Type: "refund", AccountID: "a", Amount: 1},
+		{Type: service.InstructionDeposit, AccountID: "b", Amount: 50},
+	})
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, result.BatchID)
+	assert.Equal(t, 3, result.Applied)
+	assert.Equal(t, 4, result.Failed)
+
+	statuses := make([]service.ItemStatus, len(result.Items))
+	for i, item := range result.Items {
+		assert.Equal(t, i, item.Index)
+		statuses[i] = item.Status
+	}
+	assert.Equal(t, []service.ItemStatus{
+		service.ItemApplied, service.ItemApplied, service.ItemFailed, service.ItemFailed,
+		service.ItemFailed, service.ItemFailed, service.ItemApplied,
+	}, statuses)
+	assert.ErrorIs(t, result.Items[2].Err, storage.ErrNotFound)
+	assert.ErrorIs(t, result.Items[3].Err, model.ErrInsufficientFunds)
+	assert.ErrorIs(t, result.Items[4].Err, service.ErrNonPositiveAmount)
+	assert.ErrorIs(t, result.Items[5].Err, service.ErrInvalidBatch)
+	assert.Len(t, result.Items[0].TransactionIDs, 2)
+
+	assert.Equal(t, 1, repo.Calls(storage.OpApplyBatch), "one commit for the whole batch")
+	assert.Zero(t, repo.Calls(storage.OpApplyTransaction))
+
+	txs, err := repo.LoadTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 5)
+	require.Len(t, notified, 5)
+	for i, tx := range txs {
+		assert.Equal(t, result.BatchID, tx.BatchID)
+		assert.Equal(t, "system", tx.Actor)
+		assert.Equal(t, tx.ID, notified[i].ID)
+	}
+
+	for id, want := range map[string]float64{"employer": 200, "a": 400, "b": 450} {
+		balance, err := svc.CheckBalance(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, want, balance, id)
+	}
+}
+
+func TestService_ApplyBatchAtomic(t *testing.T) {
+	tests := []struct {
+		name         string
+		instructions []service.Instruction
+		wantStatuses []service.ItemStatus
+	}{
+		{
+			name: "rejected by storage",
+			instructions: []service.Instruction{
+				{Type: service.InstructionDeposit, AccountID: "a", Amount: 10},
+				{Type: service.InstructionWithdraw, AccountID: "a", Amount: 200},
+			},
+			wantStatuses: []service.ItemStatus{service.ItemSkipped, service.ItemFailed},
+		}, {
+			name: "rejected before storage",
+			instructions: []service.Instruction{
+				{Type: service.InstructionDeposit, AccountID: "a", Amount: 10},
+				{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "a", Amount: 1},
+			},
+			wantStatuses: []service.ItemStatus{service.ItemSkipped, service.ItemFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 100})
+			svc := service.NewService(repo)
+
+			result, err := svc.ApplyBatch(context.Background(), service.BatchAtomic, tt.instructions)
+			require.ErrorIs(t, err, service.ErrBatchRejected)
+			assert.Zero(t, result.Applied)
+
+			for i, want := range tt.wantStatuses {
+				assert.Equal(t, want, result.Items[i].Status, i)
+			}
+
+			txs, err := repo.LoadTransactions()
+			require.NoError(t, err)
+			assert.Empty(t, txs)
+		})
+	}
+}
+
+func TestService_ApplyBatchInvalid(t *testing.T) {
+	deposit := service.Instruction{Type: service.InstructionDeposit, AccountID: "a", Amount: 1}
+	tests := []struct {
+		name         string
+		mode         service.BatchMode
+		instructions []service.Instruction
+	}{
+		{"unknown mode", "eventually", []service.Instruction{deposit}},
+		{"no items", service.BatchAtomic, nil},
+		{"too many items", service.BatchBestEffort, make([]service.Instruction, service.MaxBatchItems+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton"})
+			svc := service.NewService(repo)
+
+			_, err := svc.ApplyBatch(context.Background(), tt.mode, tt.instructions)
+			require.ErrorIs(t, err, service.ErrInvalidBatch)
+			assert.Zero(t, repo.Calls(storage.OpApplyBatch))
+		})
+	}
+}
+
+func TestService_ApplyBatchRefusesAmountsNeedingApproval(t *testing.T) {
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Balance: 5000},
+		model.Account{ID: "b", Owner: "stas"})
+	svc := newApprovalService(t, repo)
+
+	result, err := svc.ApplyBatch(as("teller"), service.BatchBestEffort, []service.Instruction{
+		{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "b", Amount: 1000},
+		{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "b", Amount: 2500},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, service.ItemApplied, result.Items[0].Status)
+	assert.ErrorIs(t, result.Items[1].Err, service.ErrApprovalRequired)
+
+	ops, err := svc.PendingOperations(as("checker"))
+	require.NoError(t, err)
+	assert.Empty(t, ops, "batch items are never queued for approval")
+}
+
+func TestService_ApplyBatchScreensItemsAgainstEarlierOnes(t *testing.T) {
+	engine, err := fraud.NewEngine([]fraud.Rule{{
+		Name: "burst", Type: fraud.RuleVelocity, Action: fraud.ActionBlock,
+		Window: fraud.Duration(time.Minute), MaxCount: 2,
+	}})
+	require.NoError(t, err)
+
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Balance: 100},
+		model.Account{ID: "b", Owner: "stas"})
+	svc := service.NewService(repo,
+		service.WithFraudChecks(engine, fraud.NewReviewQueue(filepath.Join(t.TempDir(), "review_queue.json"))))
+
+	result, err := svc.ApplyBatch(context.Background(), service.BatchBestEffort, []service.Instruction{
+		{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "b", Amount: 10},
+		{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "b", Amount: 10},
+		{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "b", Amount: 10},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.Applied)
+	assert.Equal(t, service.ItemFailed, result.Items[2].Status)
+	assert.ErrorIs(t, result.Items[2].Err, fraud.ErrBlocked, "the first two items count towards the third")
+
+	acc, err := repo.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 80.0, acc.Balance)
+}
+
+func TestService_ApplyBatchAuditsEveryItem(t *testing.T) {
+	sink := &recordingSink{}
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Balance: 100},
+		model.Account{ID: "b", Owner: "stas"})
+	svc := service.NewService(repo, service.WithAuditSink(sink))
+
+	result, err := svc.ApplyBatch(as("teller"), service.BatchBestEffort, []service.Instruction{
+		{Type: service.InstructionDeposit, AccountID: "b", Amount: 5},
+		{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "b", Amount: 30},
+		{Type: service.InstructionWithdraw, AccountID: "a", Amount: 500},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, sink.events, 3)
+	tests := []struct {
+		action    string
+		accountID string
+		outcome   audit.Outcome
+	}{
+		{action: audit.ActionDeposit, accountID: "b", outcome: audit.OutcomeSuccess},
+		{action: audit.ActionTransfer, accountID: "a", outcome: audit.OutcomeSuccess},
+		{action: audit.ActionWithdraw, accountID: "a", outcome: audit.OutcomeFailure},
+	}
+	for i, tt := range tests {
+		e := sink.events[i]
+		assert.Equal(t, tt.action, e.Action)
+		assert.Equal(t, tt.accountID, e.AccountID)
+		assert.Equal(t, tt.outcome, e.Outcome)
+		assert.Equal(t, "teller", e.Actor)
+		assert.Equal(t, result.BatchID, e.Params["batch_id"])
+		assert.Equal(t, i, e.Params["index"])
+	}
+	assert.Equal(t, "b", sink.events[1].Params["to"])
+}
+
+// racingRepo has another writer deposit to account a right before the
+// first batch reaches storage.
+type racingRepo struct {
+	*storage.MemoryStorage
+	raced bool
+}
+
+func (r *racingRepo) ApplyBatch(batch storage.Batch) ([]error, error) {
+	if !r.raced {
+		r.raced = true
+		if err := r.ApplyTransaction("a", 5, model.NewDepositTransaction("a", 5)); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.MemoryStorage.ApplyBatch(batch)
+}
+
+func TestService_ApplyBatchScreensAgainAfterConcurrentChange(t *testing.T) {
+	engine, err := fraud.NewEngine([]fraud.Rule{{
+		Name: "burst", Type: fraud.RuleVelocity, Action: fraud.ActionBlock,
+		Window: fraud.Duration(time.Minute), MaxCount: 10,
+	}})
+	require.NoError(t, err)
+
+	memory := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Balance: 100},
+		model.Account{ID: "b", Owner: "stas"})
+	repo := &racingRepo{MemoryStorage: memory}
+	svc := service.NewService(repo,
+		service.WithFraudChecks(engine, fraud.NewReviewQueue(filepath.Join(t.TempDir(), "review_queue.json"))))
+
+	result, err := svc.ApplyBatch(context.Background(), service.BatchBestEffort, []service.Instruction{
+		{Type: service.InstructionWithdraw, AccountID: "a", Amount: 10},
+		{Type: service.InstructionTransfer, AccountID: "a", ToAccountID: "b", Amount: 10},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Applied)
+	assert.Equal(t, 0, result.Failed)
+	assert.Equal(t, 2, memory.Calls(storage.OpApplyBatch), "the stale batch is screened and sent again")
+
+	acc, err := repo.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 85.0, acc.Balance)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/fraud"
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"context"
+	"log/slog"
+)
+
+type fraudChecks struct {
+	engine *fraud.Engine
+	queue  *fraud.ReviewQueue
+}
+
+// WithFraudChecks screens every transaction with engine before it reaches
+// storage: blocked ones are refused, flagged ones go through and are put
+// on queue for review.
+func WithFraudChecks(engine *fraud.Engine, queue *fraud.ReviewQueue) Option {
+	return func(s *service) {
+		s.fraud = &fraudChecks{
+			engine: engine,
+			queue:  queue,
+		}
+	}
+}
+
+func (s *service) screen(acc model.Account, tx model.Transaction) (fraud.Decision, error) {
+	allow := fraud.Decision{Action: fraud.ActionAllow}
+	if s.fraud == nil {
+		return allow, nil
+	}
+
+	history, err := s.repo.QueryTransactions(storage.TransactionQuery{AccountID: tx.AccountID})
+	if err != nil {
+		return allow, err
+	}
+
+	return s.evaluate(acc, tx, history.Transactions)
+}
+
+// evaluate screens tx against history, the earlier transactions of acc.
+func (s *service) evaluate(acc model.Account, tx model.Transaction, history []model.Transaction) (fraud.Decision, error) {
+	decision := s.fraud.engine.Evaluate(fraud.Input{
+		Account:     acc,
+		Transaction: tx,
+		History:     history,
+	})
+	if decision.Action == fraud.ActionBlock {
+		return decision, &fraud.BlockedError{Decision: decision}
+	}
+
+	return decision, nil
+}
+
+// flag queues an applied transaction for review. Like audit records, a
+// failure here must not turn a committed transaction into an error.
+func (s *service) flag(tx model.Transaction, decision fraud.Decision) {
+	if decision.Action != fraud.ActionFlag {
+		return
+	}
+
+	if _, err := s.fraud.queue.Add(tx, decision.Hits); err != nil {
+		s.logger.Error("queue flagged transaction for review failed",
+			slog.String("account_id", tx.AccountID),
+			slog.String("transaction_id", tx.ID),
+			slog.Any("error", err))
+	}
+}
+
+func (s *service) ReviewQueue(ctx context.Context, status fraud.ReviewStatus) ([]fraud.ReviewItem, error) {
+	if s.fraud == nil {
+		return []fraud.ReviewItem{}, nil
+	}
+	if err := s.authorize(ctx, auth.ActionRead, ""); err != nil {
+		return nil, err
+	}
+
+	return s.fraud.queue.List(status)
+}
+
+func (s *service) ResolveReview(ctx context.Context, itemID string,
+	status fraud.ReviewStatus, note string) (item fraud.ReviewItem, err error) {
+	c := s.begin(ctx, audit.ActionResolveReview, "",
+		map[string]any{"review_id": itemID, "status": status})
+	defer func() {
+		c.accountID, c.transactionID = item.Transaction.AccountID, item.Transaction.ID
+		s.end(c, err)
+	}()
+
+	if s.fraud == nil {
+		return fraud.ReviewItem{}, fraud.ErrReviewNotFound
+	}
+	if err := s.authorize(ctx, auth.ActionApprove, ""); err != nil {
+		return fraud.ReviewItem{}, err
+	}
+
+	return s.fraud.queue.Resolve(itemID, actor(ctx), status, note)
+}
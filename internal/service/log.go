@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bank-app/internal/approval"
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/fraud"
+	"bank-app/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// WithLogger logs every state-changing operation together with its
+// outcome and latency.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *service) {
+		s.logger = logger
+	}
+}
+
+// errorClass extends storage.ErrorClass with the errors raised by the
+// service itself.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrEmptyID), errors.Is(err, ErrEmptyOwner),
+		errors.Is(err, ErrNonPositiveAmount), errors.Is(err, ErrSameAccount),
+		errors.Is(err, ErrInvalidBatch):
+		return "validation"
+	case errors.Is(err, auth.ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, ErrApprovalRequired):
+		return "approval_required"
+	case errors.Is(err, fraud.ErrBlocked):
+		return "blocked"
+	case errors.Is(err, approval.ErrNotFound), errors.Is(err, fraud.ErrReviewNotFound):
+		return "not_found"
+	case errors.Is(err, approval.ErrNotPending), errors.Is(err, approval.ErrExpired),
+		errors.Is(err, approval.ErrSelfApproval), errors.Is(err, fraud.ErrReviewClosed):
+		return "conflict"
+	default:
+		return storage.ErrorClass(err)
+	}
+}
+
+// call collects what is known about a call as it runs, so that the
+// audit record and the log line are written once when it returns.
+type call struct {
+	ctx           context.Context
+	action        string
+	accountID     string
+	transactionID string
+	amount        float64
+	params        map[string]any
+	start         time.Time
+}
+
+func (s *service) begin(ctx context.Context, action, accountID string, params map[string]any) *call {
+	c := &call{
+		ctx:       ctx,
+		action:    action,
+		accountID: accountID,
+		params:    params,
+		start:     time.Now(),
+	}
+	if amount, ok := params["amount"].(float64); ok {
+		c.amount = amount
+	}
+
+	return c
+}
+
+// end never fails the operation: by the time it runs the balance change
+// is already durable, and reporting an error would invite a retry.
+func (s *service) end(c *call, opErr error) {
+	e := audit.NewEvent(actor(c.ctx), c.action, c.accountID, c.params, opErr)
+	if errors.Is(opErr, ErrApprovalRequired) {
+		e.Outcome = audit.OutcomePending
+	}
+
+	attrs := []slog.Attr{
+		slog.String("action", c.action),
+		slog.String("actor", e.Actor),
+		slog.String("account_id", c.accountID),
+	}
+	if c.transactionID != "" {
+		attrs = append(attrs, slog.String("transaction_id", c.transactionID))
+	}
+	if c.amount != 0 {
+		attrs = append(attrs, slog.Float64("amount", c.amount))
+	}
+	attrs = append(attrs,
+		slog.String("outcome", string(e.Outcome)),
+		slog.Duration("latency", time.Since(c.start)))
+
+	level := slog.LevelInfo
+	if opErr != nil && e.Outcome != audit.OutcomePending {
+		level = slog.LevelWarn
+		if errorClass(opErr) == "internal" {
+			level = slog.LevelError
+		}
+		attrs = append(attrs, slog.String("error_class", errorClass(opErr)), slog.Any("error", opErr))
+	}
+	s.logger.LogAttrs(c.ctx, level, c.action, attrs...)
+	s.count(c.action, e.Outcome)
+
+	if err := s.audit.Record(e); err != nil {
+		s.logger.ErrorContext(c.ctx, "audit record failed",
+			slog.String("action", c.action),
+			slog.String("account_id", c.accountID),
+			slog.Any("error", err))
+	}
+}
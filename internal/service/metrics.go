@@ -0,0 +1,43 @@
+package service
+
+import (
+	"bank-app/internal/approval"
+	"bank-app/internal/audit"
+	"bank-app/internal/metrics"
+)
+
+// WithMetrics counts deposits, withdrawals and transfers by outcome.
+// Operations held for approval count as pending when requested and again
+// as success or failure once executed.
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(s *service) {
+		s.counters = map[string]*metrics.Counter{
+			audit.ActionDeposit: reg.Counter("bank_deposits_total",
+				"Deposits by outcome.", "outcome"),
+			audit.ActionWithdraw: reg.Counter("bank_withdrawals_total",
+				"Withdrawals by outcome.", "outcome"),
+			audit.ActionTransfer: reg.Counter("bank_transfers_total",
+				"Transfers by outcome.", "outcome"),
+		}
+	}
+}
+
+func (s *service) count(action string, outcome audit.Outcome) {
+	if c, ok := s.counters[action]; ok {
+		c.Inc(string(outcome))
+	}
+}
+
+func (s *service) countExecution(opType approval.OperationType, execErr error) {
+	outcome := audit.OutcomeSuccess
+	if execErr != nil {
+		outcome = audit.OutcomeFailure
+	}
+
+	switch opType {
+	case approval.OpWithdraw:
+		s.count(audit.ActionWithdraw, outcome)
+	case approval.OpTransfer:
+		s.count(audit.ActionTransfer, outcome)
+	}
+}
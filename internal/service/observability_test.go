@@ -0,0 +1,159 @@
+package service_test
+
+import (
+	"bank-app/internal/approval"
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/metrics"
+	"bank-app/internal/model"
+	"bank-app/internal/service"
+	"bank-app/internal/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	events []audit.Event
+	err    error
+}
+
+func (s *recordingSink) Record(e audit.Event) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func TestService_AuditTrail(t *testing.T) {
+	sink := &recordingSink{}
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 10})
+	store := approval.NewStore(filepath.Join(t.TempDir(), "pending.json"))
+	svc := service.NewService(repo,
+		service.WithAuditSink(sink),
+		service.WithApprovals(store, 1000, time.Hour))
+
+	require.NoError(t, svc.Deposit(as("teller"), "a", 5))
+	require.ErrorIs(t, svc.Withdraw(context.Background(), "a", 50), model.ErrInsufficientFunds)
+	require.ErrorIs(t, svc.Withdraw(as("teller"), "a", 5000), service.ErrApprovalRequired)
+
+	require.Len(t, sink.events, 3)
+
+	assert.Equal(t, "teller", sink.events[0].Actor)
+	assert.Equal(t, audit.ActionDeposit, sink.events[0].Action)
+	assert.Equal(t, audit.OutcomeSuccess, sink.events[0].Outcome)
+	assert.Equal(t, map[string]any{"amount": 5.0}, sink.events[0].Params)
+
+	assert.Equal(t, audit.SystemActor, sink.events[1].Actor)
+	assert.Equal(t, audit.OutcomeFailure, sink.events[1].Outcome)
+	assert.Equal(t, model.ErrInsufficientFunds.Error(), sink.events[1].Error)
+
+	assert.Equal(t, audit.OutcomePending, sink.events[2].Outcome)
+}
+
+func TestService_AuditFailureDoesNotFailOperation(t *testing.T) {
+	var logs bytes.Buffer
+	sink := &recordingSink{err: errors.New("audit disk full")}
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton"})
+	svc := service.NewService(repo,
+		service.WithAuditSink(sink),
+		service.WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+
+	require.NoError(t, svc.Deposit(context.Background(), "a", 5))
+
+	balance, err := svc.CheckBalance(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, balance)
+	assert.Contains(t, logs.String(), "audit disk full")
+}
+
+func TestService_Logging(t *testing.T) {
+	var logs bytes.Buffer
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 10})
+	svc := service.NewService(repo,
+		service.WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+
+	require.NoError(t, svc.Deposit(as("teller"), "a", 5))
+	require.Error(t, svc.Withdraw(as("teller"), "a", 500))
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var ok, failed map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &ok))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &failed))
+
+	assert.Equal(t, "INFO", ok["level"])
+	assert.Equal(t, audit.ActionDeposit, ok["action"])
+	assert.Equal(t, "a", ok["account_id"])
+	assert.Equal(t, 5.0, ok["amount"])
+	assert.NotEmpty(t, ok["transaction_id"])
+	assert.Contains(t, ok, "latency")
+	assert.NotContains(t, ok, "error_class")
+
+	assert.Equal(t, "WARN", failed["level"])
+	assert.Equal(t, "insufficient_funds", failed["error_class"])
+	assert.Equal(t, "failure", failed["outcome"])
+}
+
+func TestService_Metrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 10})
+	store := approval.NewStore(filepath.Join(t.TempDir(), "pending.json"))
+	svc := service.NewService(repo,
+		service.WithMetrics(reg),
+		service.WithApprovals(store, 1000, time.Hour))
+
+	require.NoError(t, svc.Deposit(context.Background(), "a", 5000))
+	require.NoError(t, svc.Deposit(context.Background(), "a", 5))
+	require.Error(t, svc.Deposit(context.Background(), "a", -1))
+	require.NoError(t, svc.Withdraw(context.Background(), "a", 5))
+
+	var pending *service.ApprovalRequiredError
+	require.ErrorAs(t, svc.Withdraw(as("maker"), "a", 2000), &pending)
+	_, err := svc.ApproveOperation(as("checker"), pending.Operation.ID)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = reg.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.Contains(t, out, `bank_deposits_total{outcome="success"} 2`)
+	assert.Contains(t, out, `bank_deposits_total{outcome="failure"} 1`)
+	assert.Contains(t, out, `bank_withdrawals_total{outcome="success"} 2`)
+	assert.Contains(t, out, `bank_withdrawals_total{outcome="pending"} 1`)
+}
+
+func TestService_Authorization(t *testing.T) {
+	principals := auth.NewPrincipalStore(filepath.Join(t.TempDir(), "principals.json"))
+	require.NoError(t, principals.Put(auth.Principal{ID: "anton", Role: auth.RoleCustomer, Accounts: []string{"a"}}))
+	require.NoError(t, principals.Put(auth.Principal{ID: "teller", Role: auth.RoleTeller}))
+
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Balance: 100},
+		model.Account{ID: "b", Owner: "stas", Balance: 100})
+	svc := service.NewService(repo, service.WithAuthorizer(auth.NewPolicy(principals)))
+
+	require.NoError(t, svc.Withdraw(as("anton"), "a", 10))
+	require.ErrorIs(t, svc.Withdraw(as("anton"), "b", 10), auth.ErrForbidden)
+	require.ErrorIs(t, svc.Transfer(as("anton"), "b", "a", 10), auth.ErrForbidden)
+	require.ErrorIs(t, svc.FreezeAccount(as("anton"), "a"), auth.ErrForbidden)
+	require.ErrorIs(t, svc.Deposit(as("stranger"), "a", 10), auth.ErrForbidden)
+
+	_, err := svc.Transactions(as("anton"), "")
+	require.ErrorIs(t, err, auth.ErrForbidden, "customers cannot list every account")
+
+	require.NoError(t, svc.Deposit(as("teller"), "b", 10))
+	require.ErrorIs(t, svc.FreezeAccount(as("teller"), "b"), auth.ErrForbidden)
+	require.NoError(t, svc.Deposit(context.Background(), "a", 1), "in-process calls carry no identity")
+
+	assert.Equal(t, 3, repo.Calls(storage.OpApplyTransaction))
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"bank-app/internal/storage"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// RetryPolicy bounds how often an operation is retried after another
+// writer changed the account between our read and our write. Attempt n
+// waits n*Backoff before it starts.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond}
+
+// WithRetryPolicy replaces DefaultRetryPolicy. MaxAttempts below one is
+// treated as one, that is no retries.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(s *service) {
+		s.retries = p
+	}
+}
+
+// retry runs fn until it stops failing with ErrConcurrentModification or
+// the attempts run out. Any other error ends it at once, and so does ctx
+// while it waits between attempts.
+func (s *service) retry(ctx context.Context, accountID string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !errors.Is(err, storage.ErrConcurrentModification) || attempt >= s.retries.MaxAttempts {
+			return err
+		}
+
+		s.logger.Debug("retrying after concurrent modification",
+			slog.String("account_id", accountID),
+			slog.Int("attempt", attempt),
+			slog.Any("error", err))
+
+		timer := time.NewTimer(time.Duration(attempt) * s.retries.Backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
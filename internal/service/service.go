@@ -1,53 +1,380 @@
 package service
 
 import (
+	"bank-app/internal/approval"
+	"bank-app/internal/audit"
+	"bank-app/internal/auth"
+	"bank-app/internal/fraud"
+	"bank-app/internal/logging"
+	"bank-app/internal/metrics"
 	"bank-app/internal/model"
 	"bank-app/internal/storage"
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrEmptyID           = errors.New("empty ID field")
+	ErrEmptyOwner        = errors.New("empty owner field")
+	ErrNonPositiveAmount = errors.New("amount should be greater than zero")
+	ErrSameAccount       = errors.New("cannot transfer to the same account")
+)
+
+// Page sizes of QueryTransactions.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
 )
 
 type Service interface {
-	Deposit(accountID string, amount float64) error
-	Withdraw(accountID string, amount float64) error
+	OpenAccount(ctx context.Context, accountID string, owner string) error
+	Deposit(ctx context.Context, accountID string, amount float64) error
+	Withdraw(ctx context.Context, accountID string, amount float64) error
+	CheckBalance(ctx context.Context, accountID string) (float64, error)
+	BalanceAt(ctx context.Context, accountID string, at time.Time) (float64, error)
+	Transactions(ctx context.Context, accountID string) ([]model.Transaction, error)
+	QueryTransactions(ctx context.Context, q storage.TransactionQuery) (storage.TransactionPage, error)
+	FreezeAccount(ctx context.Context, accountID string) error
+	UnfreezeAccount(ctx context.Context, accountID string) error
+	CloseAccount(ctx context.Context, accountID string) error
+	Transfer(ctx context.Context, fromID, toID string, amount float64) error
+	ApplyBatch(ctx context.Context, mode BatchMode, instructions []Instruction) (BatchResult, error)
+
+	PendingOperations(ctx context.Context) ([]approval.Operation, error)
+	ApproveOperation(ctx context.Context, operationID string) (approval.Operation, error)
+	RejectOperation(ctx context.Context, operationID, reason string) (approval.Operation, error)
+
+	ReviewQueue(ctx context.Context, status fraud.ReviewStatus) ([]fraud.ReviewItem, error)
+	ResolveReview(ctx context.Context, itemID string, status fraud.ReviewStatus, note string) (fraud.ReviewItem, error)
+}
+
+type Option func(*service)
+
+func WithAuditSink(sink audit.Sink) Option {
+	return func(s *service) {
+		s.audit = sink
+	}
+}
+
+// WithTransactionListener registers fn to be called with every transaction
+// after it has been applied successfully.
+func WithTransactionListener(fn func(model.Transaction)) Option {
+	return func(s *service) {
+		s.listeners = append(s.listeners, fn)
+	}
+}
+
+// WithAuthorizer checks every operation against authz. Without it all
+// callers are allowed.
+func WithAuthorizer(authz auth.Authorizer) Option {
+	return func(s *service) {
+		s.authz = authz
+	}
 }
 
 type service struct {
-	repo storage.Storage
+	repo      storage.Storage
+	audit     audit.Sink
+	authz     auth.Authorizer
+	listeners []func(model.Transaction)
+	approvals *approvalPolicy
+	fraud     *fraudChecks
+	logger    *slog.Logger
+	counters  map[string]*metrics.Counter
+	retries   RetryPolicy
 }
 
-func NewService(repo storage.Storage) Service {
-	return &service{
-		repo: repo,
+func NewService(repo storage.Storage, opts ...Option) Service {
+	s := &service{
+		repo:    repo,
+		audit:   audit.NopSink{},
+		logger:  logging.Discard(),
+		retries: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
+func (s *service) OpenAccount(ctx context.Context, accountID string, owner string) (err error) {
+	c := s.begin(ctx, audit.ActionOpenAccount, accountID, map[string]any{"owner": owner})
+	defer func() { s.end(c, err) }()
 
+	if accountID == "" {
+		return ErrEmptyID
+	}
+	if err := s.authorize(ctx, auth.ActionOpen, accountID); err != nil {
+		return err
+	}
+	if owner == "" {
+		return ErrEmptyOwner
+	}
+
+	return s.repo.SaveNewAccount(*model.NewAccount(accountID, owner, 0))
+}
+
+func (s *service) Deposit(ctx context.Context, accountID string, amount float64) (err error) {
+	c := s.begin(ctx, audit.ActionDeposit, accountID, map[string]any{"amount": amount})
+	defer func() { s.end(c, err) }()
 
-func (s *service) Deposit(accountID string, amount float64) error {
 	if accountID == "" {
-		return fmt.Errorf("empty ID field")
+		return ErrEmptyID
+	}
+	if err := s.authorize(ctx, auth.ActionDeposit, accountID); err != nil {
+		return err
 	}
 	if amount <= 0 {
-		return fmt.Errorf("amount should be greater than zero")
+		return ErrNonPositiveAmount
 	}
 
 	tx := model.NewDepositTransaction(accountID, amount)
-	return s.repo.ApplyTransaction(accountID, amount, tx)
+	tx.Actor = actor(ctx)
+	c.transactionID = tx.ID
+	return s.apply(ctx, accountID, amount, tx)
 }
 
-func (s *service) Withdraw(accountID string, amount float64) error {
+func (s *service) Withdraw(ctx context.Context, accountID string, amount float64) (err error) {
+	c := s.begin(ctx, audit.ActionWithdraw, accountID, map[string]any{"amount": amount})
+	defer func() { s.end(c, err) }()
+
 	if accountID == "" {
-		return fmt.Errorf("empty ID field")
+		return ErrEmptyID
+	}
+	if err := s.authorize(ctx, auth.ActionWithdraw, accountID); err != nil {
+		return err
 	}
 	if amount <= 0 {
-		return fmt.Errorf("amount should be greater than zero Withdraw")
+		return ErrNonPositiveAmount
+	}
+
+	if s.needsApproval(amount) {
+		return s.requestApproval(ctx, approval.Operation{
+			Type:      approval.OpWithdraw,
+			AccountID: accountID,
+			Amount:    amount,
+		})
 	}
 
 	tx := model.NewWithdrawTransaction(accountID, amount)
-	return s.repo.ApplyTransaction(accountID, -amount, tx)
+	tx.Actor = actor(ctx)
+	c.transactionID = tx.ID
+	return s.apply(ctx, accountID, -amount, tx)
+}
+
+func (s *service) Transfer(ctx context.Context, fromID, toID string, amount float64) (err error) {
+	c := s.begin(ctx, audit.ActionTransfer, fromID, map[string]any{"to": toID, "amount": amount})
+	defer func() { s.end(c, err) }()
+
+	if fromID == "" || toID == "" {
+		return ErrEmptyID
+	}
+	if err := s.authorize(ctx, auth.ActionWithdraw, fromID); err != nil {
+		return err
+	}
+	if fromID == toID {
+		return ErrSameAccount
+	}
+	if amount <= 0 {
+		return ErrNonPositiveAmount
+	}
+
+	if s.needsApproval(amount) {
+		return s.requestApproval(ctx, approval.Operation{
+			Type:            approval.OpTransfer,
+			AccountID:       fromID,
+			TargetAccountID: toID,
+			Amount:          amount,
+		})
+	}
+
+	out, in := model.NewTransferTransactions(fromID, toID, amount)
+	out.Actor = actor(ctx)
+	in.Actor = out.Actor
+	c.transactionID = out.ID
+	return s.transfer(ctx, fromID, toID, amount, out, in)
 }
 
-// func (s *service) GetTransactions(accountID string) ([]model.Transaction, error) {
+func (s *service) CheckBalance(ctx context.Context, accountID string) (float64, error) {
+	if accountID == "" {
+		return 0, ErrEmptyID
+	}
+	if err := s.authorize(ctx, auth.ActionRead, accountID); err != nil {
+		return 0, err
+	}
+
+	acc, err := s.repo.LoadAccount(accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	return acc.Balance, nil
+}
+
+// BalanceAt returns the balance accountID had at the given time, computed
+// from its opening balance and its transaction history.
+func (s *service) BalanceAt(ctx context.Context, accountID string, at time.Time) (float64, error) {
+	if accountID == "" {
+		return 0, ErrEmptyID
+	}
+	if err := s.authorize(ctx, auth.ActionRead, accountID); err != nil {
+		return 0, err
+	}
 
-// 	return
-// }
+	return s.repo.BalanceAt(accountID, at)
+}
+
+// Transactions lists the history of accountID in log order. An empty
+// accountID lists the whole log.
+func (s *service) Transactions(ctx context.Context, accountID string) ([]model.Transaction, error) {
+	if err := s.authorize(ctx, auth.ActionRead, accountID); err != nil {
+		return nil, err
+	}
+
+	page, err := s.repo.QueryTransactions(storage.TransactionQuery{AccountID: accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Transactions, nil
+}
+
+// QueryTransactions returns a page of the transactions matching q. Pages
+// hold DefaultPageSize transactions unless q asks for fewer, and never
+// more than MaxPageSize.
+func (s *service) QueryTransactions(ctx context.Context, q storage.TransactionQuery) (storage.TransactionPage, error) {
+	if err := s.authorize(ctx, auth.ActionRead, q.AccountID); err != nil {
+		return storage.TransactionPage{}, err
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	q.Limit = min(q.Limit, MaxPageSize)
+
+	return s.repo.QueryTransactions(q)
+}
+
+func (s *service) FreezeAccount(ctx context.Context, accountID string) error {
+	return s.changeStatus(ctx, audit.ActionFreeze, auth.ActionFreeze, accountID, model.StatusFrozen)
+}
+
+func (s *service) UnfreezeAccount(ctx context.Context, accountID string) error {
+	return s.changeStatus(ctx, audit.ActionUnfreeze, auth.ActionFreeze, accountID, model.StatusActive)
+}
+
+func (s *service) CloseAccount(ctx context.Context, accountID string) error {
+	return s.changeStatus(ctx, audit.ActionClose, auth.ActionClose, accountID, model.StatusClosed)
+}
+
+func (s *service) changeStatus(ctx context.Context, auditAction string,
+	action auth.Action, accountID string, status model.AccountStatus) (err error) {
+	c := s.begin(ctx, auditAction, accountID, nil)
+	defer func() { s.end(c, err) }()
+
+	if accountID == "" {
+		return ErrEmptyID
+	}
+	if err := s.authorize(ctx, action, accountID); err != nil {
+		return err
+	}
+
+	return s.repo.UpdateAccountStatus(accountID, status)
+}
+
+func (s *service) authorize(ctx context.Context, action auth.Action, accountID string) error {
+	if s.authz == nil {
+		return nil
+	}
+
+	return s.authz.Authorize(ctx, action, accountID)
+}
+
+// apply commits tx. With fraud checks on, the decision depends on the
+// account as it was read, so tx is only committed if the account has not
+// changed since, retrying on a lost race. Without them nothing was read
+// that could go stale, and the storage checks the balance on its own.
+func (s *service) apply(ctx context.Context, accountID string, amount float64, tx model.Transaction) error {
+	var decision fraud.Decision
+	err := s.retry(ctx, accountID, func() error {
+		if s.fraud == nil {
+			return s.repo.ApplyTransaction(accountID, amount, tx)
+		}
+
+		acc, err := s.repo.LoadAccount(accountID)
+		if err != nil {
+			return err
+		}
+
+		decision, err = s.screen(*acc, tx)
+		if err != nil {
+			return err
+		}
+
+		return s.repo.CompareAndApply(accountID, acc.Version, amount, tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.flag(tx, decision)
+	s.notify(tx)
+	return nil
+}
+
+// transfer is apply for both sides of a transfer.
+func (s *service) transfer(ctx context.Context, fromID, toID string, amount float64, out, in model.Transaction) error {
+	var outDecision, inDecision fraud.Decision
+	err := s.retry(ctx, fromID, func() error {
+		if s.fraud == nil {
+			return s.repo.Transfer(fromID, toID, amount, out, in)
+		}
+
+		from, err := s.repo.LoadAccount(fromID)
+		if err != nil {
+			return err
+		}
+		to, err := s.repo.LoadAccount(toID)
+		if err != nil {
+			return err
+		}
+
+		if outDecision, err = s.screen(*from, out); err != nil {
+			return err
+		}
+		if inDecision, err = s.screen(*to, in); err != nil {
+			return err
+		}
+
+		return s.repo.CompareAndTransfer(fromID, toID, from.Version, to.Version, amount, out, in)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.flag(out, outDecision)
+	s.flag(in, inDecision)
+	s.notify(out, in)
+	return nil
+}
+
+func (s *service) notify(txs ...model.Transaction) {
+	for _, tx := range txs {
+		for _, fn := range s.listeners {
+			fn(tx)
+		}
+	}
+}
+
+// actor names the authenticated caller, or the system for calls made
+// outside any request.
+func actor(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok {
+		return id.Subject
+	}
+
+	return audit.SystemActor
+}
@@ -3,267 +3,197 @@ package service_test
 import (
 	"bank-app/internal/model"
 	"bank-app/internal/service"
-	"fmt"
+	"bank-app/internal/storage"
+	"context"
+	"errors"
+	"sync"
 	"testing"
-)
-
-type mockStorage struct {
-	mockStorageAccs map[string]*model.Account
-
-	FailedLoad   bool
-	FailedUpdate bool
-
-	UpdateBalanceCounter int
-}
-
-func NewMockStorage() *mockStorage {
-	return &mockStorage{
-		mockStorageAccs: make(map[string]*model.Account),
-	}
-}
-
-func (ms *mockStorage) Load(accountID string) (*model.Account, error) {
-	if ms.FailedLoad {
-		return nil, fmt.Errorf("load failed by flag")
-	}
-
-	if acc, exist := ms.mockStorageAccs[accountID]; exist {
-		return acc, nil
-	}
-
-	return nil, fmt.Errorf("account %s not found", accountID)
-}
-
-func (ms *mockStorage) UpdateBalance(accountID string, amount float64) error {
-	ms.UpdateBalanceCounter++
-
-	if ms.FailedUpdate {
-		return fmt.Errorf("update failed by flag")
-	}
-
-	if acc, exist := ms.mockStorageAccs[accountID]; exist {
-		acc.Balance = amount
-		return nil
-	}
+	"time"
 
-	return fmt.Errorf("account %s not found", accountID)
-}
-
-func (ms *mockStorage) Save(acc model.Account) error {
-	ms.mockStorageAccs[acc.ID] = &acc
-	return nil
-}
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
-func (ms *mockStorage) GetBalance(accountID string) float64 {
-	return ms.mockStorageAccs[accountID].Balance
-}
+var errFlag = errors.New("failed by flag")
 
 func TestService_Deposit(t *testing.T) {
 	tests := []struct {
-		name               string
-		accountID          string
-		amount             float64
-		setupMock          func(*mockStorage)
-		wantErr            bool
-		wantBalance        float64
-		wantBalanceCounter int
-		msgErr             string
+		name        string
+		accountID   string
+		amount      float64
+		setup       func(*storage.MemoryStorage)
+		wantErr     error
+		msgErr      string
+		wantBalance float64
+		wantApplied int
 	}{
 		{
 			name:      "без ошибок",
 			accountID: "acc1",
 			amount:    100.0,
-			setupMock: func(ms *mockStorage) {
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 1})
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 1}))
 			},
-			wantErr:            false,
-			wantBalance:        101.0,
-			wantBalanceCounter: 1,
+			wantBalance: 101.0,
+			wantApplied: 1,
 		}, {
 			name:      "empty ID",
 			accountID: "",
 			amount:    100,
-			setupMock: func(ms *mockStorage) {},
-			wantErr:   true,
+			wantErr:   service.ErrEmptyID,
 			msgErr:    "empty ID field",
 		}, {
 			name:      "amount <=0",
 			accountID: "acc1",
 			amount:    -5,
-			setupMock: func(ms *mockStorage) {
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 2})
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 2}))
 			},
-			wantErr: true,
+			wantErr: service.ErrNonPositiveAmount,
 			msgErr:  "amount should be greater than zero",
 		}, {
-			name:      "account not found",
-			accountID: "XxX",
-			amount:    10,
-			setupMock: func(ms *mockStorage) {},
-			wantErr:   true,
-			msgErr:    "account XxX not found",
+			name:        "account not found",
+			accountID:   "XxX",
+			amount:      10,
+			wantErr:     storage.ErrNotFound,
+			msgErr:      "account XxX not found",
+			wantApplied: 1,
 		}, {
-			name:      "load flag err",
+			name:      "apply flag err",
 			accountID: "acc1",
 			amount:    100,
-			setupMock: func(ms *mockStorage) {
-				ms.Reset()
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 100})
-				ms.FailedLoad = true
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 100}))
+				ms.FailNext(1, errFlag, storage.OpApplyTransaction)
 			},
-			wantErr: true,
-			msgErr:  "load failed by flag",
-		}, {
-			name:      "update balance flag err",
-			accountID: "acc1",
-			amount:    100,
-			setupMock: func(ms *mockStorage) {
-				ms.Reset()
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 100})
-				ms.FailedUpdate = true
-			},
-			wantErr:            true,
-			wantBalanceCounter: 1,
-			msgErr:             "update failed by flag",
+			wantErr:     errFlag,
+			wantApplied: 1,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockRepo := NewMockStorage()
-			if tt.setupMock != nil {
-				tt.setupMock(mockRepo)
+			repo := storage.NewMemoryStorage()
+			if tt.setup != nil {
+				tt.setup(repo)
 			}
 
-			svc := service.NewService(mockRepo)
+			svc := service.NewService(repo)
 
-			err := svc.Deposit(tt.accountID, tt.amount)
+			err := svc.Deposit(context.Background(), tt.accountID, tt.amount)
+			assert.Equal(t, tt.wantApplied, repo.Calls(storage.OpApplyTransaction))
 
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("Deposit() expected err, got nil")
-				} else if tt.msgErr != "" && err.Error() != tt.msgErr {
-					t.Errorf("Deposit() error = %v, want %v", err.Error(), tt.msgErr)
-				}
-			} else {
-				if err != nil {
-					t.Errorf("Deposit() unexpected err: %v", err)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				if tt.msgErr != "" {
+					assert.EqualError(t, err, tt.msgErr)
 				}
+				return
 			}
+			require.NoError(t, err)
 
-			if !tt.wantErr && err == nil {
-				acc, _ := mockRepo.Load(tt.accountID)
-				if acc.Balance != tt.wantBalance {
-					t.Errorf("Deposit() balance = %f, exepcted = %f",
-						acc.Balance, tt.wantBalance)
-				}
-			}
-			if mockRepo.UpdateBalanceCounter != tt.wantBalanceCounter {
-				t.Errorf("Deposit() UpdateBalanceCounter have: %v , want: %v",
-					mockRepo.UpdateBalanceCounter, tt.wantBalanceCounter)
-			}
+			acc, err := repo.LoadAccount(tt.accountID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBalance, acc.Balance)
 		})
 	}
 }
 
 func TestService_Withdraw(t *testing.T) {
 	tests := []struct {
-		name               string
-		accountID          string
-		amount             float64
-		setupMock          func(ms *mockStorage)
-		wantBalance        float64
-		wantErr            bool
-		wantBalanceCounter int
-		msgErr             string
+		name        string
+		accountID   string
+		amount      float64
+		setup       func(*storage.MemoryStorage)
+		wantErr     error
+		msgErr      string
+		wantBalance float64
+		wantApplied int
 	}{
 		{
 			name:      "good try",
 			accountID: "acc1",
 			amount:    10,
-			setupMock: func(ms *mockStorage) {
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 100})
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 100}))
 			},
-			wantBalance:        90,
-			wantErr:            false,
-			wantBalanceCounter: 1,
+			wantBalance: 90,
+			wantApplied: 1,
 		}, {
 			name:      "empty ID",
 			accountID: "",
 			amount:    0,
-			wantErr:   true,
+			wantErr:   service.ErrEmptyID,
 			msgErr:    "empty ID field",
 		}, {
 			name:      "amount should be greater than zero",
 			accountID: "cxc",
-			wantErr:   true,
+			wantErr:   service.ErrNonPositiveAmount,
 			msgErr:    "amount should be greater than zero",
 		}, {
 			name:      "account not found",
 			accountID: "XXX",
 			amount:    10,
-			setupMock: func(ms *mockStorage) {
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 100})
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 100}))
 			},
-			wantErr: true,
-			msgErr:  "account XXX not found",
+			wantErr:     storage.ErrNotFound,
+			msgErr:      "account XXX not found",
+			wantApplied: 1,
 		}, {
 			name:      "cannot withdraw amount greater than balance",
 			accountID: "acc1",
 			amount:    100,
-			setupMock: func(ms *mockStorage) {
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 99})
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 99}))
+			},
+			wantErr:     model.ErrInsufficientFunds,
+			wantApplied: 1,
+		}, {
+			name:      "frozen account",
+			accountID: "acc1",
+			amount:    10,
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 100}))
+				require.NoError(t, ms.UpdateAccountStatus("acc1", model.StatusFrozen))
 			},
-			wantErr:            true,
-			msgErr:             "cannot withdraw amount greater than balance",
-			wantBalanceCounter: 0,
+			wantErr:     model.ErrAccountFrozen,
+			wantApplied: 1,
 		}, {
-			name:      "update flag error",
+			name:      "apply flag error",
 			accountID: "acc1",
 			amount:    100,
-			setupMock: func(ms *mockStorage) {
-				ms.Reset()
-				ms.Save(model.Account{ID: "acc1", Owner: "anton", Balance: 100})
-				ms.FailedUpdate = true
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "acc1", Owner: "anton", Balance: 100}))
+				ms.FailNext(1, errFlag, storage.OpApplyTransaction)
 			},
-			wantErr:            true,
-			msgErr:             "update failed by flag",
-			wantBalanceCounter: 1,
+			wantErr:     errFlag,
+			wantApplied: 1,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockRepo := NewMockStorage()
-			if tt.setupMock != nil {
-				tt.setupMock(mockRepo)
+			repo := storage.NewMemoryStorage()
+			if tt.setup != nil {
+				tt.setup(repo)
 			}
 
-			svc := service.NewService(mockRepo)
+			svc := service.NewService(repo)
 
-			err := svc.Withdraw(tt.accountID, tt.amount)
+			err := svc.Withdraw(context.Background(), tt.accountID, tt.amount)
+			assert.Equal(t, tt.wantApplied, repo.Calls(storage.OpApplyTransaction))
 
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("Withdraw() expected err, got nil")
-				} else if tt.msgErr != "" && err.Error() != tt.msgErr {
-					t.Errorf("Withdraw() have err: %v, want: %v", err, tt.msgErr)
-				}
-			} else {
-				if err != nil {	
-					t.Errorf("Withdraw() unexpected error: %v", err)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				if tt.msgErr != "" {
+					assert.EqualError(t, err, tt.msgErr)
 				}
+				return
 			}
+			require.NoError(t, err)
 
-			if tt.wantBalanceCounter != mockRepo.UpdateBalanceCounter {
-				t.Errorf("want conunt: %d, have %d", tt.wantBalanceCounter, mockRepo.UpdateBalanceCounter)
-			}
-
-			if !tt.wantErr && err == nil {
-				acc, _ := mockRepo.Load(tt.accountID)
-				if acc.Balance != tt.wantBalance {
-					t.Errorf("balance %f - amount %f != %f wantBalance",
-						acc.Balance, tt.amount, tt.wantBalance)
-				}
-			}
+			acc, err := repo.LoadAccount(tt.accountID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBalance, acc.Balance)
 		})
 	}
 }
@@ -272,74 +202,354 @@ func TestService_CheckBalance(t *testing.T) {
 	tests := []struct {
 		name        string
 		accountID   string
+		setup       func(*storage.MemoryStorage)
 		wantBalance float64
-		setupMock   func(ms *mockStorage)
-		wantErr     bool
+		wantErr     error
 		msgErr      string
 	}{
 		{
-			name:        "good try",
-			accountID:   "abc123",
-			wantBalance: 100,
-			setupMock: func(ms *mockStorage) {
-				ms.Save(model.Account{ID: "abc123", Owner: "anton", Balance: 100})
+			name:      "good try",
+			accountID: "abc123",
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "abc123", Owner: "anton", Balance: 100}))
 			},
-			wantErr: false,
+			wantBalance: 100,
 		}, {
 			name:      "empty ID field",
 			accountID: "",
-			wantErr:   true,
+			wantErr:   service.ErrEmptyID,
 			msgErr:    "empty ID field",
 		}, {
 			name:      "flag load err",
 			accountID: "abc123",
-			setupMock: func(ms *mockStorage) {
-				ms.Reset()
-				ms.Save(model.Account{ID: "abc123", Owner: "anton", Balance: 100})
-				ms.FailedLoad = true
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.SaveNewAccount(model.Account{ID: "abc123", Owner: "anton", Balance: 100}))
+				ms.FailNext(1, errFlag, storage.OpLoadAccount)
 			},
-			wantErr: true,
-			msgErr:  "load failed by flag",
+			wantErr: errFlag,
 		}, {
 			name:      "account not found",
 			accountID: "non-existent",
-			wantErr:   true,
+			wantErr:   storage.ErrNotFound,
 			msgErr:    "account non-existent not found",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockRepo := NewMockStorage()
-			if tt.setupMock != nil {
-				tt.setupMock(mockRepo)
+			repo := storage.NewMemoryStorage()
+			if tt.setup != nil {
+				tt.setup(repo)
 			}
 
-			svc := service.NewService(mockRepo)
+			svc := service.NewService(repo)
 
-			gotBalance, err := svc.CheckBalance(tt.accountID)
+			gotBalance, err := svc.CheckBalance(context.Background(), tt.accountID)
 
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("CheckBalance want: %v, have: nil", tt.msgErr)
-				} else if tt.msgErr != "" && err.Error() != tt.msgErr {
-					t.Errorf("CheckBalance want: %v, have: %v", tt.msgErr, err)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				if tt.msgErr != "" {
+					assert.EqualError(t, err, tt.msgErr)
 				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBalance, gotBalance)
+		})
+	}
+}
+
+func TestService_Transfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		fromID   string
+		toID     string
+		amount   float64
+		setup    func(*storage.MemoryStorage)
+		wantErr  error
+		wantFrom float64
+		wantTo   float64
+	}{
+		{
+			name:     "ok",
+			fromID:   "a",
+			toID:     "b",
+			amount:   30,
+			wantFrom: 70,
+			wantTo:   30,
+		}, {
+			name:    "same account",
+			fromID:  "a",
+			toID:    "a",
+			amount:  30,
+			wantErr: service.ErrSameAccount,
+		}, {
+			name:    "insufficient funds",
+			fromID:  "a",
+			toID:    "b",
+			amount:  101,
+			wantErr: model.ErrInsufficientFunds,
+		}, {
+			name:   "closed target",
+			fromID: "a",
+			toID:   "b",
+			amount: 30,
+			setup: func(ms *storage.MemoryStorage) {
+				require.NoError(t, ms.UpdateAccountStatus("b", model.StatusClosed))
+			},
+			wantErr: model.ErrAccountClosed,
+		}, {
+			name:   "storage failure",
+			fromID: "a",
+			toID:   "b",
+			amount: 30,
+			setup: func(ms *storage.MemoryStorage) {
+				ms.FailNext(1, errFlag, storage.OpTransfer)
+			},
+			wantErr: errFlag,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryStorage(
+				model.Account{ID: "a", Owner: "anton", Balance: 100},
+				model.Account{ID: "b", Owner: "stas"})
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+
+			var notified []model.Transaction
+			svc := service.NewService(repo, service.WithTransactionListener(func(tx model.Transaction) {
+				notified = append(notified, tx)
+			}))
+
+			err := svc.Transfer(context.Background(), tt.fromID, tt.toID, tt.amount)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, notified)
+				return
+			}
+			require.NoError(t, err)
+
+			from, err := svc.CheckBalance(context.Background(), tt.fromID)
+			require.NoError(t, err)
+			to, err := svc.CheckBalance(context.Background(), tt.toID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFrom, from)
+			assert.Equal(t, tt.wantTo, to)
+
+			require.Len(t, notified, 2)
+			assert.Equal(t, model.TransferOutTx, notified[0].Type)
+			assert.Equal(t, model.TransferInTx, notified[1].Type)
+		})
+	}
+}
+
+func TestService_AccountLifecycle(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.NewMemoryStorage()
+	svc := service.NewService(repo)
+
+	require.ErrorIs(t, svc.OpenAccount(ctx, "a", ""), service.ErrEmptyOwner)
+	require.NoError(t, svc.OpenAccount(ctx, "a", "anton"))
+	require.ErrorIs(t, svc.OpenAccount(ctx, "a", "anton"), storage.ErrAlreadyExists)
+
+	require.NoError(t, svc.Deposit(ctx, "a", 10))
+	require.NoError(t, svc.FreezeAccount(ctx, "a"))
+	require.ErrorIs(t, svc.Deposit(ctx, "a", 10), model.ErrAccountFrozen)
+	require.NoError(t, svc.UnfreezeAccount(ctx, "a"))
+
+	require.ErrorIs(t, svc.CloseAccount(ctx, "a"), model.ErrNonZeroBalance)
+	require.NoError(t, svc.Withdraw(ctx, "a", 10))
+	require.NoError(t, svc.CloseAccount(ctx, "a"))
+	require.ErrorIs(t, svc.Deposit(ctx, "a", 10), model.ErrAccountClosed)
+
+	txs, err := svc.Transactions(ctx, "a")
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	assert.Equal(t, model.DepositTx, txs[0].Type)
+	assert.Equal(t, model.WithdrawTx, txs[1].Type)
+	require.NoError(t, repo.Verify())
+}
+
+func TestService_RetriesConcurrentModification(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      *service.RetryPolicy
+		conflicts   int
+		wantErr     error
+		wantCalls   int
+		wantBalance float64
+	}{
+		{
+			name:        "retried until it wins",
+			conflicts:   2,
+			wantCalls:   3,
+			wantBalance: 110,
+		}, {
+			name:        "gives up after max attempts",
+			conflicts:   3,
+			wantErr:     storage.ErrConcurrentModification,
+			wantCalls:   3,
+			wantBalance: 100,
+		}, {
+			name:        "retries disabled",
+			policy:      &service.RetryPolicy{MaxAttempts: 1},
+			conflicts:   1,
+			wantErr:     storage.ErrConcurrentModification,
+			wantCalls:   1,
+			wantBalance: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton", Balance: 100})
+			repo.FailNext(tt.conflicts, storage.ErrConcurrentModification, storage.OpApplyTransaction)
+
+			opts := []service.Option{service.WithRetryPolicy(service.RetryPolicy{MaxAttempts: 3})}
+			if tt.policy != nil {
+				opts = append(opts, service.WithRetryPolicy(*tt.policy))
+			}
+			svc := service.NewService(repo, opts...)
+
+			err := svc.Deposit(context.Background(), "a", 10)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
 			} else {
-				if err != nil {
-					t.Errorf("CheckBalance() unexpected err: %v", err)
-				}
-				if gotBalance != tt.wantBalance {
-					t.Errorf("CheckBalance() balance = %f, want %f", gotBalance, tt.wantBalance)
-				}
+				require.NoError(t, err)
 			}
+			assert.Equal(t, tt.wantCalls, repo.Calls(storage.OpApplyTransaction))
+
+			balance, err := svc.CheckBalance(context.Background(), "a")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBalance, balance)
 		})
 	}
 }
 
-func (ms *mockStorage) Reset() {
-	ms.FailedLoad = false
-	ms.FailedUpdate = false
-	ms.UpdateBalanceCounter = 0
-	ms.mockStorageAccs = make(map[string]*model.Account)
+func TestService_ConcurrentDepositsDoNotConflict(t *testing.T) {
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton"})
+	svc := service.NewService(repo, service.WithRetryPolicy(service.RetryPolicy{MaxAttempts: 1}))
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, svc.Deposit(context.Background(), "a", 1),
+				"nothing read can go stale without fraud checks")
+		}()
+	}
+	wg.Wait()
+
+	balance, err := svc.CheckBalance(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, balance)
+}
+
+func TestService_RetryStopsWithContext(t *testing.T) {
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton"})
+	repo.FailNext(1, storage.ErrConcurrentModification, storage.OpApplyTransaction)
+	svc := service.NewService(repo, service.WithRetryPolicy(service.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := svc.Deposit(ctx, "a", 10)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, storage.ErrConcurrentModification)
+	assert.Equal(t, 1, repo.Calls(storage.OpApplyTransaction))
+}
+
+func TestService_TransferRetriesConcurrentModification(t *testing.T) {
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Balance: 100},
+		model.Account{ID: "b", Owner: "stas"})
+	repo.FailNext(1, storage.ErrConcurrentModification, storage.OpTransfer)
+
+	svc := service.NewService(repo)
+	require.NoError(t, svc.Transfer(context.Background(), "a", "b", 30))
+	assert.Equal(t, 2, repo.Calls(storage.OpTransfer))
+
+	txs, err := repo.LoadTransactions()
+	require.NoError(t, err)
+	assert.Len(t, txs, 2, "the conflicting attempt must not leave transactions behind")
+}
+
+func TestService_QueryTransactions(t *testing.T) {
+	repo := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "anton"})
+	for range service.MaxPageSize + 1 {
+		require.NoError(t, repo.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+	}
+	svc := service.NewService(repo)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"default", 0, service.DefaultPageSize},
+		{"requested", 3, 3},
+		{"capped", service.MaxPageSize + 1, service.MaxPageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := svc.QueryTransactions(ctx, storage.TransactionQuery{AccountID: "a", Limit: tt.limit})
+			require.NoError(t, err)
+			assert.Len(t, page.Transactions, tt.want)
+			assert.True(t, page.HasMore)
+		})
+	}
+
+	txs, err := svc.Transactions(ctx, "a")
+	require.NoError(t, err)
+	assert.Len(t, txs, service.MaxPageSize+1, "Transactions is not paged")
+}
+
+func TestService_BalanceAt(t *testing.T) {
+	repo := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "anton", Status: model.StatusActive},
+		model.Account{ID: "b", Owner: "stas", Balance: 40, Status: model.StatusActive})
+	svc := service.NewService(repo)
+	ctx := context.Background()
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, amount := range []float64{100, -30, 5} {
+		tx := model.NewDepositTransaction("a", amount)
+		if amount < 0 {
+			tx = model.NewWithdrawTransaction("a", -amount)
+		}
+		tx.CreatedAt = base.AddDate(0, 0, i)
+		require.NoError(t, repo.ApplyTransaction("a", amount, tx))
+	}
+
+	tests := []struct {
+		name      string
+		accountID string
+		at        time.Time
+		want      float64
+		wantErr   error
+	}{
+		{name: "before the first transaction", accountID: "a", at: base.Add(-time.Second), want: 0},
+		{name: "at a transaction", accountID: "a", at: base, want: 100},
+		{name: "between transactions", accountID: "a", at: base.AddDate(0, 0, 1).Add(time.Hour), want: 70},
+		{name: "after the last transaction", accountID: "a", at: base.AddDate(1, 0, 0), want: 75},
+		{name: "opening balance", accountID: "b", at: base, want: 40},
+		{name: "unknown account", accountID: "missing", at: base, wantErr: storage.ErrNotFound},
+		{name: "empty ID", at: base, wantErr: service.ErrEmptyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.BalanceAt(ctx, tt.accountID, tt.at)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
 }
@@ -0,0 +1,393 @@
+package storage
+
+import (
+	"archive/tar"
+	"bank-app/internal/model"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// ErrInvalidBackup means a backup archive is damaged, incomplete or holds
+// data that does not pass the integrity checks.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// A backup archive is a gzipped tar of manifest.json followed by the data
+// files under fixed names, so that it restores into any set of paths.
+const manifestName = "manifest.json"
+
+// MaxBackupEntrySize bounds each file of a backup archive read back, so
+// that a damaged or hostile archive cannot make a restore exhaust memory.
+const MaxBackupEntrySize = 1 << 30
+
+var backupNames = map[fileKind]string{
+	kindAccounts:     "accounts.json",
+	kindTransactions: "transactions.json",
+}
+
+type Manifest struct {
+	FormatVersion int          `json:"format_version"`
+	CreatedAt     time.Time    `json:"created_at"`
+	Accounts      int          `json:"accounts"`
+	Transactions  int          `json:"transactions"`
+	Files         []BackupFile `json:"files"`
+}
+
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup is the verified content of a backup archive, ready to restore.
+type Backup struct {
+	Manifest Manifest
+
+	accounts []model.Account
+	txs      []model.Transaction
+}
+
+type backupEntry struct {
+	name string
+	data []byte
+}
+
+// Backup writes a consistent copy of the data files to w while the storage
+// stays online. The copy is checked like ReadBackup does before anything
+// is written. The files are read under the storage lock, which also
+// keeps out other processes, and the archive is written after it is
+// released.
+func (fs *FileStorage) Backup(w io.Writer) (_ Manifest, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpBackup, start, err)
+	}(time.Now())
+
+	manifest, entries, err := fs.readBackupFiles()
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	// An archive that ReadBackup would refuse is no backup at all.
+	files := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		files[e.name] = e.data
+	}
+	if err := (&Backup{Manifest: manifest}).decode(files); err != nil {
+		return Manifest{}, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	if err := writeBackup(w, manifest, entries); err != nil {
+		return Manifest{}, fmt.Errorf("write backup: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func (fs *FileStorage) readBackupFiles() (Manifest, []backupEntry, error) {
+	if err := fs.lock(OpBackup); err != nil {
+		return Manifest{}, nil, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return Manifest{}, nil, err
+	}
+
+	accounts, err := fs.loadAccountsUnsafe()
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+	txs, err := fs.loadTransactionsUnsafe()
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+
+	manifest := Manifest{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Accounts:      len(accounts),
+		Transactions:  len(txs),
+		Files:         []BackupFile{},
+	}
+
+	// Only the files storage owns are copied; the other stores keep their
+	// own files and are backed up through their own API. The outbox is
+	// left out too: its events may be delivered by the time the backup is
+	// restored.
+	var entries []backupEntry
+	for _, f := range fs.dataFiles() {
+		if f.kind == kindOutbox {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Manifest{}, nil, fmt.Errorf("read %s file: %w", f.kind, err)
+		}
+
+		sum := sha256.Sum256(data)
+		name := backupNames[f.kind]
+		manifest.Files = append(manifest.Files, BackupFile{
+			Name:   name,
+			Size:   int64(len(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+		entries = append(entries, backupEntry{name: name, data: data})
+	}
+
+	return manifest, entries, nil
+}
+
+func writeBackup(w io.Writer, manifest Manifest, entries []backupEntry) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	entries = append([]backupEntry{{name: manifestName, data: data}}, entries...)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.name,
+			Mode:     0644,
+			Size:     int64(len(e.data)),
+			ModTime:  manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// ReadBackup reads a backup archive and checks it before anything is
+// restored from it: every file must match its manifest entry, the data
+// must parse, the counts must agree with the manifest, the hash chain must
+// verify, every transaction must belong to an account in the backup and
+// every balance must follow from the account's transactions.
+func ReadBackup(r io.Reader) (*Backup, error) {
+	files, err := readBackupArchive(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	data, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s", ErrInvalidBackup, manifestName)
+	}
+	b := &Backup{}
+	if err := json.Unmarshal(data, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: parse %s: %w", ErrInvalidBackup, manifestName, err)
+	}
+	if b.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("%w: backup has format version %d, this build reads up to %d: %w",
+			ErrInvalidBackup, b.Manifest.FormatVersion, FormatVersion, ErrUnsupportedVersion)
+	}
+
+	listed := map[string]bool{manifestName: true}
+	for _, f := range b.Manifest.Files {
+		data, ok := files[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is missing", ErrInvalidBackup, f.Name)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, fmt.Errorf("%w: %s does not match its checksum", ErrInvalidBackup, f.Name)
+		}
+		listed[f.Name] = true
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrInvalidBackup, name)
+		}
+	}
+
+	if err := b.decode(files); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	return b, nil
+}
+
+func readBackupArchive(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s is not a regular file", hdr.Name)
+		}
+		if _, ok := files[hdr.Name]; ok {
+			return nil, fmt.Errorf("%s appears twice", hdr.Name)
+		}
+		if hdr.Name != manifestName && !slices.Contains(slices.Collect(maps.Values(backupNames)), hdr.Name) {
+			return nil, fmt.Errorf("unexpected file %s", hdr.Name)
+		}
+
+		if hdr.Size > MaxBackupEntrySize {
+			return nil, fmt.Errorf("%s is %d bytes, at most %d allowed", hdr.Name, hdr.Size, MaxBackupEntrySize)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, MaxBackupEntrySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		if len(data) > MaxBackupEntrySize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", hdr.Name, MaxBackupEntrySize)
+		}
+		files[hdr.Name] = data
+	}
+}
+
+func (b *Backup) decode(files map[string][]byte) error {
+	b.accounts, b.txs = []model.Account{}, []model.Transaction{}
+	for kind, v := range map[fileKind]any{
+		kindAccounts:     &b.accounts,
+		kindTransactions: &b.txs,
+	} {
+		data, ok := files[backupNames[kind]]
+		if !ok || len(data) == 0 {
+			continue
+		}
+		if err := decodeFile(kind, data, v); err != nil {
+			return fmt.Errorf("parse %s: %w", backupNames[kind], err)
+		}
+	}
+
+	if len(b.accounts) != b.Manifest.Accounts || len(b.txs) != b.Manifest.Transactions {
+		return fmt.Errorf("backup holds %d accounts and %d transactions, manifest says %d and %d",
+			len(b.accounts), len(b.txs), b.Manifest.Accounts, b.Manifest.Transactions)
+	}
+	if err := VerifyChain(b.txs); err != nil {
+		return err
+	}
+	for _, tx := range b.txs {
+		if findAccount(b.accounts, tx.AccountID) == nil {
+			return fmt.Errorf("transaction %s: account %s %w", tx.ID, tx.AccountID, ErrNotFound)
+		}
+	}
+
+	return checkBalances(b.accounts, b.txs)
+}
+
+// checkBalances replays the transactions of every account. An account may
+// open with a balance that no transaction records, so the replay starts
+// from the balance less the transactions; that opening balance must not be
+// negative, and no withdrawal may take the account below zero. Versions
+// are not compared: data written before they existed has none.
+func checkBalances(accounts []model.Account, txs []model.Transaction) error {
+	byAccount := make(map[string][]model.Transaction)
+	for _, tx := range txs {
+		byAccount[tx.AccountID] = append(byAccount[tx.AccountID], tx)
+	}
+
+	for _, acc := range accounts {
+		history := byAccount[acc.ID]
+		balance := acc.Balance
+		for _, tx := range history {
+			balance -= tx.Delta()
+		}
+		if balance < -balanceTolerance {
+			return fmt.Errorf("account %s: balance %v does not follow from its transactions", acc.ID, acc.Balance)
+		}
+		for _, tx := range history {
+			balance += tx.Delta()
+			if balance < -balanceTolerance {
+				return fmt.Errorf("account %s: transaction %s takes the balance below zero", acc.ID, tx.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// balanceTolerance absorbs the rounding of summing float amounts in another
+// order than they were applied in.
+const balanceTolerance = 1e-6
+
+// Restore replaces the data files with the content of b in one commit.
+// The files of the other stores are left alone, the audit log above all,
+// which must never be rolled back. The outbox, if configured, is emptied: events of the replaced state must not be delivered, and
+// those pending when the backup was taken may have been delivered since.
+func (fs *FileStorage) Restore(b *Backup) (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpRestore, start, err)
+	}(time.Now())
+
+	if err := fs.lock(OpRestore); err != nil {
+		return err
+	}
+	defer fs.unlock()
+
+	// Only finish an interrupted commit: the live files are replaced
+	// anyway, so there is no point in upgrading them or in failing because
+	// they are damaged.
+	if fs.closed {
+		return ErrClosed
+	}
+	if err := fs.recoverJournalUnsafe(); err != nil {
+		return err
+	}
+
+	accWrite, err := marshalFile(fs.accountFilePath, b.accounts)
+	if err != nil {
+		return err
+	}
+	txWrite, err := marshalFile(fs.transactionFilePath, b.txs)
+	if err != nil {
+		return err
+	}
+	writes := []fileWrite{accWrite, txWrite}
+	if fs.outboxFilePath != "" {
+		// Keep counting from the live outbox, if it can be read, so that
+		// subscribers never see a sequence number twice.
+		outbox := &outboxFile{Events: []model.Event{}}
+		if live, err := fs.loadOutboxUnsafe(); err == nil {
+			outbox.NextSeq = live.NextSeq
+		}
+		w, err := marshalFile(fs.outboxFilePath, outbox)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, w)
+	}
+
+	if err := fs.commitUnsafe(writes...); err != nil {
+		return err
+	}
+	fs.upgraded = true
+	fs.reindexUnsafe(b.txs)
+
+	return nil
+}
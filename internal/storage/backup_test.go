@@ -0,0 +1,353 @@
+package storage_test
+
+import (
+	"archive/tar"
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackupStorage(t *testing.T) (*storage.FileStorage, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	return storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json"))), dir
+}
+
+// seedBackupStorage opens two accounts with some history, puts files of
+// other stores next to them and returns a backup taken afterwards, which
+// must leave those files out.
+func seedBackupStorage(t *testing.T, fs *storage.FileStorage, dir string) []byte {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api_keys.json"), []byte(`{"keys":[]}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "audit.jsonl"), []byte("{\"action\":\"deposit\"}\n"), 0644))
+
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, fs.SaveNewAccount(*model.NewAccount(id, "Anton", 0)))
+	}
+	require.NoError(t, fs.ApplyTransaction("a", 100, model.NewDepositTransaction("a", 100)))
+	out, in := model.NewTransferTransactions("a", "b", 40)
+	require.NoError(t, fs.Transfer("a", "b", 40, out, in))
+
+	var buf bytes.Buffer
+	manifest, err := fs.Backup(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, storage.FormatVersion, manifest.FormatVersion)
+	assert.Equal(t, 2, manifest.Accounts)
+	assert.Equal(t, 3, manifest.Transactions)
+	assert.Len(t, manifest.Files, 2, "accounts and transactions, but not the outbox or other stores' files")
+
+	return buf.Bytes()
+}
+
+func TestFileStorage_BackupRestore(t *testing.T) {
+	fs, dir := newBackupStorage(t)
+	archive := seedBackupStorage(t, fs, dir)
+
+	wantAccounts, err := fs.LoadAccounts()
+	require.NoError(t, err)
+	wantTxs, err := fs.LoadTransactions()
+	require.NoError(t, err)
+
+	// Changes made after the backup are undone by the restore.
+	require.NoError(t, fs.ApplyTransaction("b", -40, model.NewWithdrawTransaction("b", 40)))
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("c", "Stas", 0)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "audit.jsonl"),
+		[]byte("{\"action\":\"deposit\"}\n{\"action\":\"restore\"}\n"), 0644))
+	seq := lastEventSeq(t, fs)
+
+	other, otherDir := newBackupStorage(t)
+	tests := []struct {
+		name    string
+		repo    *storage.FileStorage
+		dir     string
+		nextSeq int64
+	}{
+		{name: "into the same files", repo: fs, dir: dir, nextSeq: seq + 1},
+		{name: "into other files", repo: other, dir: otherDir, nextSeq: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := storage.ReadBackup(bytes.NewReader(archive))
+			require.NoError(t, err)
+			require.NoError(t, tt.repo.Restore(b))
+
+			accounts, err := tt.repo.LoadAccounts()
+			require.NoError(t, err)
+			assertAccounts(t, wantAccounts, accounts)
+
+			txs, err := tt.repo.LoadTransactions()
+			require.NoError(t, err)
+			assert.Len(t, txs, len(wantTxs))
+			require.NoError(t, tt.repo.Verify())
+
+			balance, err := tt.repo.BalanceAt("b", txs[len(txs)-1].CreatedAt)
+			require.NoError(t, err)
+			assert.Equal(t, 40.0, balance, "the transaction index follows the restore")
+
+			events, err := tt.repo.PendingEvents(0)
+			require.NoError(t, err)
+			assert.Empty(t, events, "no event is delivered again")
+			require.NoError(t, tt.repo.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+			assert.Equal(t, tt.nextSeq, lastEventSeq(t, tt.repo), "sequence numbers are not reused")
+
+			if tt.repo == fs {
+				audit, err := os.ReadFile(filepath.Join(tt.dir, "audit.jsonl"))
+				require.NoError(t, err)
+				assert.Contains(t, string(audit), "restore", "the audit log is never rolled back")
+			} else {
+				assert.NoFileExists(t, filepath.Join(tt.dir, "audit.jsonl"))
+			}
+		})
+	}
+}
+
+func lastEventSeq(t *testing.T, fs *storage.FileStorage) int64 {
+	t.Helper()
+
+	events, err := fs.PendingEvents(0)
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	return events[len(events)-1].Seq
+}
+
+func TestFileStorage_BackupOfDataWithoutVersions(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+	// The transactions are sealed by a store of their own, and the accounts
+	// file is then replaced by one from before versions.
+	scratch := storage.NewFileStorage(filepath.Join(t.TempDir(), "accounts.json"), txPath)
+	require.NoError(t, scratch.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+	require.NoError(t, scratch.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	require.NoError(t, scratch.ApplyTransaction("a", 5, model.NewDepositTransaction("a", 5)))
+	require.NoError(t, scratch.Close())
+	writeJSON(t, accPath, []map[string]any{{"ID": "a", "Owner": "Anton", "Balance": 15}})
+	fs := storage.NewFileStorage(accPath, txPath)
+
+	var buf bytes.Buffer
+	_, err := fs.Backup(&buf)
+	require.NoError(t, err)
+	_, err = storage.ReadBackup(&buf)
+	require.NoError(t, err, "files written before account versions can be restored")
+}
+
+func TestFileStorage_BackupRefusesInvalidData(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+	writeJSON(t, accPath, []model.Account{{ID: "a", Owner: "Anton", Balance: 5, Status: model.StatusActive}})
+	writeJSON(t, txPath, []model.Transaction{model.NewDepositTransaction("a", 10)})
+	fs := storage.NewFileStorage(accPath, txPath)
+
+	var buf bytes.Buffer
+	_, err := fs.Backup(&buf)
+	require.ErrorIs(t, err, storage.ErrInvalidBackup)
+	assert.Zero(t, buf.Len(), "nothing is written")
+}
+
+func TestFileStorage_BackupWhileWriting(t *testing.T) {
+	fs, dir := newBackupStorage(t)
+	seedBackupStorage(t, fs, dir)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			assert.NoError(t, fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+		}
+	}()
+
+	for range 10 {
+		var buf bytes.Buffer
+		manifest, err := fs.Backup(&buf)
+		require.NoError(t, err)
+
+		b, err := storage.ReadBackup(&buf)
+		require.NoError(t, err, "every backup is consistent")
+		assert.Equal(t, manifest, b.Manifest)
+	}
+	wg.Wait()
+}
+
+func TestReadBackup_Rejects(t *testing.T) {
+	fs, dir := newBackupStorage(t)
+	archive := seedBackupStorage(t, fs, dir)
+
+	tests := []struct {
+		name    string
+		archive func(t *testing.T) []byte
+		wantErr error
+	}{
+		{
+			name:    "not an archive",
+			archive: func(t *testing.T) []byte { return []byte("not gzip") },
+		},
+		{
+			name: "file too large",
+			archive: func(t *testing.T) []byte {
+				// Only the header is written: its size alone is refused.
+				var buf bytes.Buffer
+				gzw := gzip.NewWriter(&buf)
+				tw := tar.NewWriter(gzw)
+				require.NoError(t, tw.WriteHeader(&tar.Header{
+					Typeflag: tar.TypeReg, Name: "accounts.json", Mode: 0644, Size: storage.MaxBackupEntrySize + 1,
+				}))
+				require.NoError(t, gzw.Close())
+				return buf.Bytes()
+			},
+		},
+		{
+			name: "no manifest",
+			archive: editBackup(archive, false, func(t *testing.T, files map[string][]byte) {
+				delete(files, "manifest.json")
+			}),
+		},
+		{
+			name: "file changed",
+			archive: editBackup(archive, false, func(t *testing.T, files map[string][]byte) {
+				files["accounts.json"] = bytes.Replace(files["accounts.json"], []byte("Anton"), []byte("Mallory"), 1)
+			}),
+		},
+		{
+			name: "file missing",
+			archive: editBackup(archive, false, func(t *testing.T, files map[string][]byte) {
+				delete(files, "transactions.json")
+			}),
+		},
+		{
+			name: "file not in the manifest",
+			archive: editBackup(archive, false, func(t *testing.T, files map[string][]byte) {
+				files["outbox.json.bak"] = []byte("{}")
+			}),
+		},
+		{
+			name: "broken hash chain",
+			archive: editBackup(archive, true, func(t *testing.T, files map[string][]byte) {
+				files["transactions.json"] = bytes.Replace(files["transactions.json"],
+					[]byte(`"amount": 100`), []byte(`"amount": 900`), 1)
+			}),
+			wantErr: storage.ErrChainBroken,
+		},
+		{
+			name: "balance without the transactions behind it",
+			archive: editBackup(archive, true, func(t *testing.T, files map[string][]byte) {
+				files["accounts.json"] = bytes.Replace(files["accounts.json"],
+					[]byte(`"balance": 60`), []byte(`"balance": 10`), 1)
+			}),
+		},
+		{
+			name: "counts differ from the manifest",
+			archive: editBackup(archive, true, func(t *testing.T, files map[string][]byte) {
+				editManifest(t, files, func(m *storage.Manifest) { m.Accounts++ })
+			}),
+		},
+		{
+			name: "newer format",
+			archive: editBackup(archive, true, func(t *testing.T, files map[string][]byte) {
+				editManifest(t, files, func(m *storage.Manifest) { m.FormatVersion = storage.FormatVersion + 1 })
+			}),
+			wantErr: storage.ErrUnsupportedVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := storage.ReadBackup(bytes.NewReader(tt.archive(t)))
+			require.ErrorIs(t, err, storage.ErrInvalidBackup)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// editBackup returns archive with its files changed by edit. With resum
+// the manifest checksums are updated to match, as a careful forger would.
+func editBackup(archive []byte, resum bool, edit func(t *testing.T, files map[string][]byte)) func(t *testing.T) []byte {
+	return func(t *testing.T) []byte {
+		t.Helper()
+
+		gz, err := gzip.NewReader(bytes.NewReader(archive))
+		require.NoError(t, err)
+		tr := tar.NewReader(gz)
+		files := map[string][]byte{}
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			files[hdr.Name], err = io.ReadAll(tr)
+			require.NoError(t, err)
+			names = append(names, hdr.Name)
+		}
+
+		edit(t, files)
+
+		if resum {
+			editManifest(t, files, func(m *storage.Manifest) {
+				for i, f := range m.Files {
+					sum := sha256.Sum256(files[f.Name])
+					m.Files[i].Size, m.Files[i].SHA256 = int64(len(files[f.Name])), hex.EncodeToString(sum[:])
+				}
+			})
+		}
+
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gzw)
+		for name := range files {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			data, ok := files[name]
+			if !ok {
+				continue
+			}
+			require.NoError(t, tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(data)),
+			}))
+			_, err := tw.Write(data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gzw.Close())
+
+		return buf.Bytes()
+	}
+}
+
+func editManifest(t *testing.T, files map[string][]byte, edit func(m *storage.Manifest)) {
+	t.Helper()
+
+	var m storage.Manifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &m))
+	edit(&m)
+
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	files["manifest.json"] = data
+}
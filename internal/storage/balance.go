@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+)
+
+// checkpointEvery is the number of an account's transactions between two
+// balance checkpoints, and so the most a point-in-time balance has to add
+// up on top of one.
+const checkpointEvery = 64
+
+// ledger orders the transactions of one account by time and keeps the
+// running balance after every checkpointEvery of them.
+type ledger struct {
+	byTime []int
+	// checkpoints[k] is the balance after the first (k+1)*checkpointEvery
+	// transactions of byTime.
+	checkpoints []float64
+}
+
+func (l *ledger) add(txs []model.Transaction, pos int) {
+	var i int
+	l.byTime, i = insertByTime(txs, l.byTime, pos)
+
+	// A transaction that is late for its time moves every later
+	// checkpoint.
+	l.checkpoints = l.checkpoints[:min(len(l.checkpoints), i/checkpointEvery)]
+	for k := len(l.checkpoints); (k+1)*checkpointEvery <= len(l.byTime); k++ {
+		l.checkpoints = append(l.checkpoints, l.sum(txs, k*checkpointEvery, (k+1)*checkpointEvery))
+	}
+}
+
+// balanceAt adds up the transactions created at or before at, starting
+// from the last checkpoint before them, and tells how many there were.
+func (l *ledger) balanceAt(txs []model.Transaction, at time.Time) (float64, int) {
+	n := sort.Search(len(l.byTime), func(i int) bool {
+		return txs[l.byTime[i]].CreatedAt.After(at)
+	})
+
+	return l.through(txs, n), n
+}
+
+// total adds up all the transactions.
+func (l *ledger) total(txs []model.Transaction) float64 {
+	return l.through(txs, len(l.byTime))
+}
+
+// through is the sum of byTime[:n], from the last checkpoint before n.
+func (l *ledger) through(txs []model.Transaction, n int) float64 {
+	k := min(n/checkpointEvery, len(l.checkpoints))
+	return l.sum(txs, k*checkpointEvery, n)
+}
+
+// sum is the balance after byTime[:to], computed from byTime[from:to] and
+// the checkpoint in front of it. from must be on a checkpoint boundary.
+func (l *ledger) sum(txs []model.Transaction, from, to int) float64 {
+	balance := 0.0
+	if k := from / checkpointEvery; k > 0 {
+		balance = l.checkpoints[k-1]
+	}
+	for _, pos := range l.byTime[from:to] {
+		balance += txs[pos].Delta()
+	}
+
+	return balance
+}
+
+// insertByTime inserts pos into positions, which is sorted by CreatedAt
+// with ties in log order, and returns where it went. New transactions
+// almost always belong at the end.
+func insertByTime(txs []model.Transaction, positions []int, pos int) ([]int, int) {
+	i := len(positions)
+	for i > 0 && txs[positions[i-1]].CreatedAt.After(txs[pos].CreatedAt) {
+		i--
+	}
+
+	return slices.Insert(positions, i, pos), i
+}
+
+// balanceAt replays the transactions of acc created at or before at on
+// top of its opening balance. An account can be opened or imported with
+// money on it that no transaction accounts for, so the opening balance is
+// what acc.Balance holds on top of all its transactions; once every
+// transaction is in, the result is acc.Balance itself. Before the account
+// was opened, and before any transaction, the balance is zero.
+func (ix *txIndex) balanceAt(acc model.Account, at time.Time) float64 {
+	l, ok := ix.ledgers[acc.ID]
+	if !ok {
+		l = &ledger{}
+	}
+
+	sum, n := l.balanceAt(ix.txs, at)
+	switch {
+	case n == len(l.byTime) && !at.Before(acc.CreatedAt):
+		return acc.Balance
+	case n == 0 && at.Before(acc.CreatedAt):
+		return 0
+	}
+
+	return acc.Balance - l.total(ix.txs) + sum
+}
+
+// BalanceAt replays the transactions of accountID created at or before at
+// on top of its opening balance.
+func (fs *FileStorage) BalanceAt(accountID string, at time.Time) (_ float64, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpBalanceAt, start, err, slog.String("account_id", accountID))
+	}(time.Now())
+
+	if err := fs.lock(OpBalanceAt); err != nil {
+		return 0, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return 0, err
+	}
+
+	accounts, err := fs.loadAccountsUnsafe()
+	if err != nil {
+		return 0, err
+	}
+	acc := findAccount(accounts, accountID)
+	if acc == nil {
+		return 0, fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+	ix, err := fs.indexUnsafe()
+	if err != nil {
+		return 0, err
+	}
+
+	return ix.balanceAt(*acc, at), nil
+}
+
+// BalanceAt holds the lock of the account, so that its balance and its
+// transactions agree.
+func (m *MemoryStorage) BalanceAt(accountID string, at time.Time) (float64, error) {
+	unlock := m.lockAccounts(accountID)
+	defer unlock()
+
+	if err := m.begin(OpBalanceAt); err != nil {
+		return 0, err
+	}
+
+	acc := m.lookup(accountID)
+	if acc == nil {
+		return 0, fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	return m.index.balanceAt(*acc, at), nil
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// ErrBatchRejected means an atomic batch was not applied because at least
+// one of its items failed.
+var ErrBatchRejected = errors.New("batch rejected")
+
+// Posting is one balance change together with the transaction recording it.
+type Posting struct {
+	AccountID   string
+	Amount      float64
+	Transaction model.Transaction
+
+	// With CheckVersion set the account must be at Version before the
+	// batch is applied, for callers that prepared it from what they read.
+	CheckVersion bool
+	Version      int64
+}
+
+// Batch is applied in a single commit. Items are applied in order, each all
+// or nothing, so later items see the effect of earlier ones. With Atomic set
+// one failing item rejects the whole batch. An account that is no longer at
+// the version a posting expects fails the whole batch with
+// ErrConcurrentModification in either mode, since its items were prepared
+// together.
+type Batch struct {
+	Items  [][]Posting
+	Atomic bool
+}
+
+func (b Batch) postings() [][]posting {
+	items := make([][]posting, len(b.Items))
+	for i, item := range b.Items {
+		for _, p := range item {
+			items[i] = append(items[i], posting{accountID: p.AccountID, amount: p.Amount, tx: p.Transaction})
+		}
+	}
+
+	return items
+}
+
+// versionChecks returns the versions the batch expects its accounts to be
+// at, as postings to check.
+func (b Batch) versionChecks() []posting {
+	var checks []posting
+	for _, item := range b.Items {
+		for _, p := range item {
+			if p.CheckVersion {
+				checks = append(checks, posting{accountID: p.AccountID, checkVersion: true, version: p.Version})
+			}
+		}
+	}
+
+	return checks
+}
+
+// checkVersions fails with ErrConcurrentModification unless every account
+// found by lookup is at the version its checks expect. A missing account is
+// left for its item to fail on.
+func checkVersions(checks []posting, lookup func(accountID string) *model.Account) error {
+	for _, c := range checks {
+		if acc := lookup(c.accountID); acc != nil {
+			if err := c.check(acc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b Batch) accountIDs() []string {
+	var ids []string
+	for _, item := range b.Items {
+		for _, p := range item {
+			ids = append(ids, p.AccountID)
+		}
+	}
+	slices.Sort(ids)
+
+	return slices.Compact(ids)
+}
+
+func (b Batch) size() int {
+	return len(b.Items)
+}
+
+func (fs *FileStorage) ApplyBatch(batch Batch) (_ []error, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpApplyBatch, start, err, slog.Int("size", batch.size()),
+			slog.Bool("atomic", batch.Atomic))
+	}(time.Now())
+
+	if err := fs.lock(OpApplyBatch); err != nil {
+		return nil, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return nil, err
+	}
+
+	return fs.applyBatchUnsafe(batch.postings(), batch.Atomic, batch.versionChecks())
+}
+
+func (m *MemoryStorage) ApplyBatch(batch Batch) ([]error, error) {
+	unlock := m.lockAccounts(batch.accountIDs()...)
+	defer unlock()
+
+	if err := m.begin(OpApplyBatch); err != nil {
+		return nil, err
+	}
+	if err := checkVersions(batch.versionChecks(), m.lookup); err != nil {
+		return nil, err
+	}
+
+	items := batch.postings()
+	stored := make(map[string]*model.Account)
+	updated := make(map[string]*model.Account)
+	errs := make([]error, len(items))
+	var committed []posting
+	for i, postings := range items {
+		if errs[i] = m.stageUnsafe(stored, updated, postings); errs[i] == nil {
+			committed = append(committed, postings...)
+		}
+	}
+	if batch.Atomic && slices.ContainsFunc(errs, func(err error) bool { return err != nil }) {
+		return errs, ErrBatchRejected
+	}
+
+	if err := m.appendUnsafe(committed, stored, updated); err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrChainBroken = errors.New("transaction chain broken")
+
+// ChainError points at the first transaction whose link in the hash chain
+// does not hold.
+type ChainError struct {
+	Index         int
+	TransactionID string
+	Reason        string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("transaction #%d (%s): %s", e.Index, e.TransactionID, e.Reason)
+}
+
+func (e *ChainError) Unwrap() error {
+	return ErrChainBroken
+}
+
+// HashTransaction hashes the JSON form of tx without its own Hash field.
+// New fields must be omitempty so that hashes of older records stay valid.
+func HashTransaction(tx model.Transaction) (string, error) {
+	tx.Hash = ""
+
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return "", fmt.Errorf("marshal transaction: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sealTransaction(history []model.Transaction, tx *model.Transaction) error {
+	var prevHash, accountPrevHash string
+	if len(history) > 0 {
+		prevHash = history[len(history)-1].Hash
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].AccountID == tx.AccountID {
+			accountPrevHash = history[i].Hash
+			break
+		}
+	}
+
+	return sealAfter(tx, prevHash, accountPrevHash)
+}
+
+// sealAfter links tx to the given hashes, for callers that track the heads
+// of the chain instead of searching the history.
+func sealAfter(tx *model.Transaction, prevHash, accountPrevHash string) error {
+	tx.PrevHash = prevHash
+	tx.AccountPrevHash = accountPrevHash
+
+	hash, err := HashTransaction(*tx)
+	if err != nil {
+		return err
+	}
+	tx.Hash = hash
+
+	return nil
+}
+
+// VerifyChain walks the log and returns a *ChainError for the first broken
+// link. Records written before chaining existed carry no hash and are
+// accepted only as a leading prefix of the log. A log with records but no
+// sealed one fails: it cannot be told from a log stripped of its hashes.
+// The first write to such a log seals it from there on.
+func VerifyChain(txs []model.Transaction) error {
+	v := newChainVerifier()
+	for _, tx := range txs {
+		if err := v.add(tx); err != nil {
+			return err
+		}
+	}
+
+	return v.done()
+}
+
+// chainVerifier is VerifyChain one transaction at a time, for callers that
+// stream the log instead of loading it.
+type chainVerifier struct {
+	index       int
+	firstID     string
+	sealed      bool
+	prev        string
+	accountPrev map[string]string
+}
+
+func newChainVerifier() *chainVerifier {
+	return &chainVerifier{accountPrev: make(map[string]string)}
+}
+
+func (v *chainVerifier) add(tx model.Transaction) error {
+	i := v.index
+	v.index++
+	if i == 0 {
+		v.firstID = tx.ID
+	}
+
+	if !v.sealed && tx.Hash == "" && tx.PrevHash == "" {
+		return nil
+	}
+	v.sealed = true
+
+	if tx.Hash == "" {
+		return &ChainError{Index: i, TransactionID: tx.ID, Reason: "missing hash"}
+	}
+	if tx.PrevHash != v.prev {
+		return &ChainError{Index: i, TransactionID: tx.ID, Reason: "previous hash mismatch"}
+	}
+	if tx.AccountPrevHash != v.accountPrev[tx.AccountID] {
+		return &ChainError{Index: i, TransactionID: tx.ID, Reason: "account previous hash mismatch"}
+	}
+
+	want, err := HashTransaction(tx)
+	if err != nil {
+		return err
+	}
+	if want != tx.Hash {
+		return &ChainError{Index: i, TransactionID: tx.ID, Reason: "contents do not match hash"}
+	}
+
+	v.prev = tx.Hash
+	v.accountPrev[tx.AccountID] = tx.Hash
+	return nil
+}
+
+// done fails a log that had records but none of them sealed.
+func (v *chainVerifier) done() error {
+	if v.index > 0 && !v.sealed {
+		return &ChainError{Index: 0, TransactionID: v.firstID, Reason: "no sealed records"}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package storage_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_TransactionChain(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+
+	writeJSON(t, accPath, []model.Account{
+		{ID: "a", Owner: "Anton", Balance: 100},
+		{ID: "b", Owner: "Stas", Balance: 100},
+	})
+
+	fs := storage.NewFileStorage(accPath, txPath)
+
+	require.NoError(t, fs.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	require.NoError(t, fs.ApplyTransaction("b", -5, model.NewWithdrawTransaction("b", 5)))
+	require.NoError(t, fs.ApplyTransaction("a", -1, model.NewWithdrawTransaction("a", 1)))
+
+	txs := readTransactions(t, txPath)
+	require.Len(t, txs, 3)
+
+	assert.Empty(t, txs[0].PrevHash)
+	assert.Equal(t, txs[0].Hash, txs[1].PrevHash)
+	assert.Empty(t, txs[1].AccountPrevHash)
+	assert.Equal(t, txs[1].Hash, txs[2].PrevHash)
+	assert.Equal(t, txs[0].Hash, txs[2].AccountPrevHash)
+
+	require.NoError(t, storage.VerifyChain(txs))
+	require.NoError(t, fs.Verify())
+}
+
+func TestVerifyChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		tamper    func([]model.Transaction) []model.Transaction
+		wantIndex int
+		wantOK    bool
+	}{
+		{
+			name:   "untouched",
+			tamper: func(txs []model.Transaction) []model.Transaction { return txs },
+			wantOK: true,
+		}, {
+			name: "amount edited",
+			tamper: func(txs []model.Transaction) []model.Transaction {
+				txs[1].Amount = 1000
+				return txs
+			},
+			wantIndex: 1,
+		}, {
+			name: "transaction removed",
+			tamper: func(txs []model.Transaction) []model.Transaction {
+				return append(txs[:1], txs[2:]...)
+			},
+			wantIndex: 1,
+		}, {
+			name: "transactions reordered",
+			tamper: func(txs []model.Transaction) []model.Transaction {
+				txs[2], txs[3] = txs[3], txs[2]
+				return txs
+			},
+			wantIndex: 2,
+		}, {
+			name: "hash stripped",
+			tamper: func(txs []model.Transaction) []model.Transaction {
+				txs[3].Hash = ""
+				return txs
+			},
+			wantIndex: 3,
+		}, {
+			name: "every hash stripped",
+			tamper: func(txs []model.Transaction) []model.Transaction {
+				for i := range txs {
+					txs[i].Hash, txs[i].PrevHash, txs[i].AccountPrevHash = "", "", ""
+				}
+				return txs
+			},
+			wantIndex: 0,
+		}, {
+			name: "unsealed legacy prefix",
+			tamper: func(txs []model.Transaction) []model.Transaction {
+				legacy := model.NewDepositTransaction("a", 1)
+				return append([]model.Transaction{legacy}, txs...)
+			},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			accPath := filepath.Join(dir, "accounts.json")
+			txPath := filepath.Join(dir, "transactions.json")
+
+			writeJSON(t, accPath, []model.Account{{ID: "a", Owner: "Anton", Balance: 100}})
+
+			fs := storage.NewFileStorage(accPath, txPath)
+			for i := 0; i < 4; i++ {
+				require.NoError(t, fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+			}
+
+			err := storage.VerifyChain(tt.tamper(readTransactions(t, txPath)))
+
+			if tt.wantOK {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, storage.ErrChainBroken)
+
+			var chainErr *storage.ChainError
+			require.ErrorAs(t, err, &chainErr)
+			assert.Equal(t, tt.wantIndex, chainErr.Index)
+		})
+	}
+}
+
+func TestFileStorage_StateReportsBrokenChain(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+
+	writeJSON(t, accPath, []model.Account{{ID: "a", Owner: "Anton", Balance: 100}})
+
+	fs := storage.NewFileStorage(accPath, txPath)
+	require.NoError(t, fs.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	require.NoError(t, fs.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+
+	txs := readTransactions(t, txPath)
+	txs[0].Amount = 1000
+	writeJSON(t, txPath, txs)
+
+	state, err := fs.State()
+	require.NoError(t, err)
+	assert.Equal(t, 1, state.Accounts)
+	assert.Equal(t, 2, state.Transactions)
+	assert.False(t, state.ChainVerified)
+	assert.Contains(t, state.ChainError, "transaction #0")
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type fileWrite struct {
+	Path string `json:"path"`
+	Data []byte `json:"data"`
+}
+
+type commitJournal struct {
+	Files []fileWrite `json:"files"`
+}
+
+// marshalFile encodes v as the data of a file in the current format.
+func marshalFile(path string, v any) (fileWrite, error) {
+	data, err := json.MarshalIndent(fileEnvelope{Version: FormatVersion, Data: v}, "", "  ")
+	if err != nil {
+		return fileWrite{}, fmt.Errorf("marshal %s: %w", filepath.Base(path), err)
+	}
+
+	return fileWrite{Path: path, Data: data}, nil
+}
+
+// commitUnsafe makes several file writes atomic as a group. The new contents
+// go to a journal first; once the journal is durable the target files are
+// replaced one by one, and a crash in between is rolled forward by
+// recoverUnsafe on the next operation.
+func (fs *FileStorage) commitUnsafe(writes ...fileWrite) error {
+	if len(writes) == 1 {
+		return writeFileAtomic(writes[0].Path, writes[0].Data)
+	}
+
+	data, err := json.Marshal(commitJournal{Files: writes})
+	if err != nil {
+		return fmt.Errorf("marshal commit journal: %w", err)
+	}
+	if err := writeFileAtomic(fs.journalPath(), data); err != nil {
+		return fmt.Errorf("write commit journal: %w", err)
+	}
+
+	return fs.replayJournalUnsafe(writes)
+}
+
+// recoverUnsafe is the first step of every locked operation: it finishes a
+// commit interrupted by a crash, upgrades data files of an older format,
+// and refuses to work after Close.
+func (fs *FileStorage) recoverUnsafe() error {
+	if fs.closed {
+		return ErrClosed
+	}
+	if err := fs.recoverJournalUnsafe(); err != nil {
+		return err
+	}
+
+	return fs.upgradeUnsafe()
+}
+
+func (fs *FileStorage) recoverJournalUnsafe() error {
+	data, err := os.ReadFile(fs.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read commit journal: %w", err)
+	}
+
+	var journal commitJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return fmt.Errorf("corrupted commit journal: %w", err)
+	}
+
+	return fs.replayJournalUnsafe(journal.Files)
+}
+
+func (fs *FileStorage) replayJournalUnsafe(writes []fileWrite) error {
+	for _, w := range writes {
+		if err := writeFileAtomic(w.Path, w.Data); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(fs.journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove commit journal: %w", err)
+	}
+
+	return nil
+}
+
+func (fs *FileStorage) journalPath() string {
+	return fs.accountFilePath + ".journal"
+}
+
+// syncDir makes renames inside dir durable. Some platforms cannot open a
+// directory for syncing; there the rename is as durable as it gets.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return fmt.Errorf("sync %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// syncDirsUnsafe makes the renames of earlier commits durable in every
+// data directory. A directory that does not exist yet holds nothing to sync.
+func (fs *FileStorage) syncDirsUnsafe() error {
+	for dir := range fs.dirs() {
+		if err := syncDir(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create temp file for %s: %w", filepath.Base(path), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("chmod %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", filepath.Base(path), err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace %s: %w", filepath.Base(path), err)
+	}
+
+	return nil
+}
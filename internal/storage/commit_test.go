@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_RecoversInterruptedCommit(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+
+	fs := NewFileStorage(accPath, txPath)
+
+	accWrite, err := marshalFile(accPath, []model.Account{{ID: "a", Owner: "Anton", Balance: 10}})
+	require.NoError(t, err)
+	txWrite, err := marshalFile(txPath, []model.Transaction{model.NewDepositTransaction("a", 10)})
+	require.NoError(t, err)
+
+	// simulate a crash after the journal was written but before any target
+	data, err := json.Marshal(commitJournal{Files: []fileWrite{accWrite, txWrite}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fs.journalPath(), data, 0644))
+
+	acc, err := fs.LoadAccount("a")
+	require.NoError(t, err)
+	require.Equal(t, 10.0, acc.Balance)
+
+	txs, err := fs.LoadTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+
+	_, err = os.Stat(fs.journalPath())
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
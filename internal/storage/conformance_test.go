@@ -0,0 +1,44 @@
+package storage_test
+
+import (
+	"bank-app/internal/storage"
+	"bank-app/internal/storage/storagetest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStorage_Conformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Storage {
+		dir := t.TempDir()
+		return storage.NewFileStorage(
+			filepath.Join(dir, "accounts.json"),
+			filepath.Join(dir, "transactions.json"),
+			storage.WithOutbox(filepath.Join(dir, "outbox.json")))
+	})
+}
+
+func TestFileStorage_GroupCommitConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Storage {
+		dir := t.TempDir()
+		return storage.NewFileStorage(
+			filepath.Join(dir, "accounts.json"),
+			filepath.Join(dir, "transactions.json"),
+			storage.WithOutbox(filepath.Join(dir, "outbox.json")),
+			storage.WithGroupCommit(16, time.Millisecond))
+	})
+}
+
+func TestMemoryStorage_Conformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestEventStore_Conformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.Storage {
+		dir := t.TempDir()
+		return storage.NewEventStore(filepath.Join(dir, "events.jsonl"),
+			storage.WithSnapshots(filepath.Join(dir, "snapshot.json"), 10))
+	})
+}
@@ -0,0 +1,1135 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventStore is a backend whose source of truth is an append-only log of
+// domain events. Account state is not stored anywhere: it is a projection
+// rebuilt by replaying the log through model.Account, starting from a
+// snapshot when there is one. Other read models are fed from the same log
+// with WithProjection.
+//
+// After a header line with the format version, each line of the log
+// holds the events of one commit, so a transfer is never half written; a
+// line cut short by a crash is ignored and overwritten by the next commit.
+// A log of an older version is upgraded when it is first read. Like
+// FileStorage it locks the log against other processes during every
+// operation, and picks up what they appended before doing anything else.
+type EventStore struct {
+	logPath       string
+	snapshotPath  string
+	snapshotEvery int64
+	lockTimeout   time.Duration
+	procLock      processLock
+	projections   []Projection
+
+	mu     sync.Mutex
+	closed bool
+	// state is nil until the log is first read. offset is how much of the
+	// log it reflects, logSum the hash of those bytes and tail how many
+	// bytes of an unfinished line follow.
+	state        *accountProjection
+	offset       int64
+	logSum       hash.Hash
+	tail         int64
+	snapshotSeq  int64
+	history      *eventHistory
+	dispatchPath string
+}
+
+// eventHistory is the whole log in memory. Account state does not need it,
+// so it is only loaded for reads of the transaction history; the outbox
+// and the diagnostics read the log instead.
+type eventHistory struct {
+	events []model.Event
+	index  *txIndex
+}
+
+func (h *eventHistory) add(e model.Event) {
+	h.events = append(h.events, e)
+	if e.Transaction != nil {
+		h.index.add(*e.Transaction)
+	}
+}
+
+type EventOption func(*EventStore)
+
+// WithSnapshots saves the account state to path after every n events, and
+// when the store is closed or rebuilt, so that opening it only replays
+// the events since. With n at zero only Close and Rebuild save one.
+func WithSnapshots(path string, n int) EventOption {
+	return func(es *EventStore) {
+		es.snapshotPath = path
+		es.snapshotEvery = int64(n)
+	}
+}
+
+// WithProjection feeds p every event of the log, the existing ones
+// included, from the first operation on.
+func WithProjection(p Projection) EventOption {
+	return func(es *EventStore) {
+		es.projections = append(es.projections, p)
+	}
+}
+
+// WithEventLockTimeout is WithLockTimeout for an EventStore.
+func WithEventLockTimeout(d time.Duration) EventOption {
+	return func(es *EventStore) {
+		es.lockTimeout = d
+	}
+}
+
+var (
+	_ Storage = (*EventStore)(nil)
+	_ Outbox  = (*EventStore)(nil)
+)
+
+func NewEventStore(logPath string, opts ...EventOption) *EventStore {
+	es := &EventStore{
+		logPath:      logPath,
+		dispatchPath: logPath + ".dispatched",
+		lockTimeout:  defaultLockTimeout,
+	}
+	for _, opt := range opts {
+		opt(es)
+	}
+	es.procLock = newProcessLock(logPath+".lock", defaultStaleLockAge)
+
+	return es
+}
+
+// OpenEventStore is NewEventStore that reads the log right away, and fails
+// if it cannot be read or upgraded, above all when a newer build wrote it.
+func OpenEventStore(logPath string, opts ...EventOption) (*EventStore, error) {
+	es := NewEventStore(logPath, opts...)
+	if err := es.Refresh(); err != nil {
+		_ = es.procLock.close()
+		return nil, err
+	}
+
+	return es, nil
+}
+
+func (es *EventStore) lock() error {
+	es.mu.Lock()
+	if err := acquire(es.procLock, es.lockTimeout); err != nil {
+		es.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (es *EventStore) unlock() {
+	// A lock that fails to release shows up as ErrLockTimeout in the next
+	// operation of another process.
+	_ = es.procLock.unlock()
+	if es.closed {
+		_ = es.procLock.close()
+	}
+	es.mu.Unlock()
+}
+
+// syncUnsafe is the first step of every locked operation: it loads the
+// state on first use and applies whatever other processes appended since.
+func (es *EventStore) syncUnsafe() error {
+	if es.closed {
+		return ErrClosed
+	}
+	if es.state == nil {
+		return es.loadUnsafe()
+	}
+
+	size, err := es.sizeUnsafe()
+	if err != nil {
+		return err
+	}
+	if size < es.offset {
+		return fmt.Errorf("%w: log shrank from %d to %d bytes", ErrCorruptLog, es.offset, size)
+	}
+	if size == es.offset+es.tail {
+		return nil
+	}
+
+	if es.offset, err = es.readLogUnsafe(es.offset, es.applyLineUnsafe); err != nil {
+		// The state may hold part of a line; start over next time.
+		es.state = nil
+		return err
+	}
+	es.tail = size - es.offset
+	return nil
+}
+
+func (es *EventStore) sizeUnsafe() (int64, error) {
+	info, err := os.Stat(es.logPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("stat event log: %w", err)
+	}
+
+	return info.Size(), nil
+}
+
+// loadUnsafe builds the state, from the snapshot if there is a usable one
+// and no projection needs the events before it.
+func (es *EventStore) loadUnsafe() error {
+	es.state, es.offset, es.tail, es.snapshotSeq, es.history = nil, 0, 0, 0, nil
+
+	if err := es.upgradeLogUnsafe(); err != nil {
+		return err
+	}
+
+	if len(es.projections) == 0 {
+		if snap, err := es.readSnapshotUnsafe(); err == nil && snap != nil {
+			if es.logSum, err = es.checkSnapshotUnsafe(snap); err == nil {
+				es.state, es.offset, es.snapshotSeq = snap.projection(), snap.Offset, snap.Seq
+				if err := es.catchUpUnsafe(); err == nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	// Without a snapshot, or with one that does not match the log, replay
+	// everything.
+	return es.replayUnsafe()
+}
+
+// replayUnsafe rebuilds the state and the projections from the start of
+// the log. Projections are reset first, so that events they got before a
+// failed read are not counted twice.
+func (es *EventStore) replayUnsafe() error {
+	es.state, es.offset, es.tail, es.snapshotSeq = newAccountProjection(), 0, 0, 0
+	es.logSum = sha256.New()
+	for _, p := range es.projections {
+		p.Reset()
+	}
+	if err := es.catchUpUnsafe(); err != nil {
+		es.state, es.history = nil, nil
+		return err
+	}
+
+	return nil
+}
+
+func (es *EventStore) catchUpUnsafe() error {
+	size, err := es.sizeUnsafe()
+	if err != nil {
+		return err
+	}
+	if size < es.offset {
+		return fmt.Errorf("%w: log is shorter than its snapshot", ErrCorruptLog)
+	}
+
+	es.offset, err = es.readLogUnsafe(es.offset, es.applyLineUnsafe)
+	if err != nil {
+		return err
+	}
+	es.tail = size - es.offset
+
+	return nil
+}
+
+// applyUnsafe is the only place where events change the state, both when
+// the log is replayed and when this store commits. The events of a line
+// reach the projections and the history only once the state took all of
+// them; on an error the state is left half applied and must be dropped.
+func (es *EventStore) applyUnsafe(events []model.Event) error {
+	for _, e := range events {
+		if err := es.state.apply(e); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range events {
+		for _, p := range es.projections {
+			p.Apply(e)
+		}
+		if es.history != nil {
+			es.history.add(e)
+		}
+	}
+
+	return nil
+}
+
+// applyLineUnsafe applies a line read from the log.
+func (es *EventStore) applyLineUnsafe(line logLine) error {
+	if err := es.applyUnsafe(line.events); err != nil {
+		return err
+	}
+
+	es.logSum.Write(line.data)
+	return nil
+}
+
+// logLine is one complete line of the log, which ends at offset end.
+type logLine struct {
+	data   []byte
+	end    int64
+	events []model.Event
+}
+
+// errStopReading ends readLogUnsafe early without an error.
+var errStopReading = errors.New("stop reading")
+
+// readLogUnsafe calls fn with each complete line from offset on, and
+// returns the offset after the last line it handled.
+func (es *EventStore) readLogUnsafe(offset int64, fn func(logLine) error) (int64, error) {
+	f, err := os.Open(es.logPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return offset, nil
+	}
+	if err != nil {
+		return offset, fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, fmt.Errorf("seek event log: %w", err)
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("read event log: %w", err)
+		}
+
+		var events []model.Event
+		if offset == 0 && bytes.HasPrefix(line, []byte("{")) {
+			// The header holds no events, but fn still gets it as part of
+			// the bytes of the log.
+			if _, _, err := parseLogHeader(line); err != nil {
+				return offset, err
+			}
+		} else if err := json.Unmarshal(line, &events); err != nil {
+			return offset, fmt.Errorf("%w: line at byte %d: %v", ErrCorruptLog, offset, err)
+		}
+		err = fn(logLine{data: line, end: offset + int64(len(line)), events: events})
+		if errors.Is(err, errStopReading) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+	}
+}
+
+// historyUnsafe loads the whole log for reads of the history.
+func (es *EventStore) historyUnsafe() (*eventHistory, error) {
+	if es.history != nil {
+		return es.history, nil
+	}
+
+	h := &eventHistory{index: newTxIndex()}
+	_, err := es.readLogUnsafe(0, func(line logLine) error {
+		for _, e := range line.events {
+			if e.Seq > es.state.seq {
+				return errStopReading
+			}
+			h.add(e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	es.history = h
+	return h, nil
+}
+
+// commitUnsafe numbers events, appends them to the log as one line and
+// applies them.
+func (es *EventStore) commitUnsafe(events []model.Event) error {
+	for i := range events {
+		events[i].Seq = es.state.seq + int64(i) + 1
+	}
+	line, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("marshal events: %w", err)
+	}
+	line = append(line, '\n')
+	if es.offset == 0 {
+		line = append(logHeaderLine(), line...)
+	}
+
+	if err := es.appendUnsafe(line); err != nil {
+		return err
+	}
+	es.offset += int64(len(line))
+
+	if err := es.applyUnsafe(events); err != nil {
+		// The line is in the log but the state does not match it; the
+		// next operation replays the log and reports it.
+		es.state, es.history = nil, nil
+		return err
+	}
+	es.logSum.Write(line)
+
+	if es.snapshotEvery > 0 && es.state.seq-es.snapshotSeq >= es.snapshotEvery {
+		// A failed snapshot only costs replay time on the next start.
+		_ = es.snapshotUnsafe()
+	}
+	return nil
+}
+
+func (es *EventStore) appendUnsafe(line []byte) error {
+	if es.tail > 0 {
+		if err := os.Truncate(es.logPath, es.offset); err != nil {
+			return fmt.Errorf("drop unfinished line: %w", err)
+		}
+		es.tail = 0
+	}
+
+	f, err := os.OpenFile(es.logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open event log: %w", err)
+	}
+
+	_, err = f.Write(line)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && es.offset == 0 {
+		err = syncDir(filepath.Dir(es.logPath))
+	}
+	if err != nil {
+		// Take back whatever made it to the file, or failing that leave it
+		// for the next sync to find.
+		if terr := os.Truncate(es.logPath, es.offset); terr != nil {
+			es.tail = 1
+		}
+		return fmt.Errorf("append to event log: %w", err)
+	}
+
+	return nil
+}
+
+// eventSnapshot is the account state after the first Offset bytes of the
+// log. LogSHA256 is the hash of those bytes, so that a snapshot is only
+// used on the log it was taken from, and Checksum the hash of the
+// snapshot itself without it.
+type eventSnapshot struct {
+	Seq       int64             `json:"seq"`
+	Offset    int64             `json:"offset"`
+	LogSHA256 string            `json:"log_sha256"`
+	Accounts  []model.Account   `json:"accounts"`
+	LastHash  string            `json:"last_hash,omitempty"`
+	Heads     map[string]string `json:"heads,omitempty"`
+	Checksum  string            `json:"checksum"`
+}
+
+func (s eventSnapshot) checksum() (string, error) {
+	s.Checksum = ""
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("marshal snapshot: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *eventSnapshot) projection() *accountProjection {
+	p := newAccountProjection()
+	for _, acc := range s.Accounts {
+		p.accounts[acc.ID] = &acc
+		p.order = append(p.order, acc.ID)
+	}
+	p.seq, p.lastHash = s.Seq, s.LastHash
+	for id, hash := range s.Heads {
+		p.heads[id] = hash
+	}
+
+	return p
+}
+
+func (es *EventStore) snapshotUnsafe() error {
+	if es.snapshotPath == "" || es.state.seq == es.snapshotSeq {
+		return nil
+	}
+
+	snap := eventSnapshot{
+		Seq:       es.state.seq,
+		Offset:    es.offset,
+		LogSHA256: hex.EncodeToString(es.logSum.Sum(nil)),
+		Accounts:  es.state.list(),
+		LastHash:  es.state.lastHash,
+		Heads:     es.state.heads,
+	}
+	var err error
+	if snap.Checksum, err = snap.checksum(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fileEnvelope{Version: FormatVersion, Data: snap}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	if err := writeFileAtomic(es.snapshotPath, data); err != nil {
+		return err
+	}
+
+	es.snapshotSeq = es.state.seq
+	return nil
+}
+
+// readSnapshotUnsafe returns nil without an error when there is no
+// snapshot.
+func (es *EventStore) readSnapshotUnsafe() (*eventSnapshot, error) {
+	if es.snapshotPath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(es.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap eventSnapshot
+	if err := decodeFile(kindSnapshot, data, &snap); err != nil {
+		return nil, fmt.Errorf("corrupted snapshot: %w", err)
+	}
+
+	return &snap, nil
+}
+
+// checkSnapshotUnsafe makes sure snap is intact and was taken from the
+// first snap.Offset bytes of the log as it is now, and returns the hash of
+// those bytes to continue from.
+func (es *EventStore) checkSnapshotUnsafe(snap *eventSnapshot) (hash.Hash, error) {
+	if sum, err := snap.checksum(); err != nil || sum != snap.Checksum {
+		return nil, fmt.Errorf("snapshot does not match its checksum")
+	}
+
+	f, err := os.Open(es.logPath)
+	if err != nil {
+		return nil, fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close()
+
+	logSum := sha256.New()
+	if _, err := io.CopyN(logSum, f, snap.Offset); err != nil {
+		return nil, fmt.Errorf("hash event log: %w", err)
+	}
+	if hex.EncodeToString(logSum.Sum(nil)) != snap.LogSHA256 {
+		return nil, fmt.Errorf("snapshot was taken from another log")
+	}
+
+	return logSum, nil
+}
+
+// Rebuild throws the account state and the projections away, replays the
+// whole log and saves a fresh snapshot. It fails if the log does not
+// replay or its hash chain is broken.
+func (es *EventStore) Rebuild() error {
+	if err := es.lock(); err != nil {
+		return err
+	}
+	defer es.unlock()
+
+	if es.closed {
+		return ErrClosed
+	}
+
+	es.history = &eventHistory{index: newTxIndex()}
+	if err := es.replayUnsafe(); err != nil {
+		return err
+	}
+	if err := VerifyChain(es.history.index.txs); err != nil {
+		return err
+	}
+
+	return es.snapshotUnsafe()
+}
+
+// Refresh applies what other processes appended to the log, so that
+// projections are up to date.
+func (es *EventStore) Refresh() error {
+	if err := es.lock(); err != nil {
+		return err
+	}
+	defer es.unlock()
+
+	return es.syncUnsafe()
+}
+
+// Close saves a snapshot if snapshots are on. Every later call fails with
+// ErrClosed.
+func (es *EventStore) Close() error {
+	if err := es.lock(); err != nil {
+		return err
+	}
+	defer es.unlock()
+
+	if es.closed {
+		return nil
+	}
+	if err := es.syncUnsafe(); err != nil {
+		return err
+	}
+	if err := es.snapshotUnsafe(); err != nil {
+		return err
+	}
+
+	es.closed = true
+	return nil
+}
+
+func (es *EventStore) SaveNewAccount(acc model.Account) error {
+	if err := es.lock(); err != nil {
+		return err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return err
+	}
+
+	if _, ok := es.state.accounts[acc.ID]; ok {
+		return fmt.Errorf("account with ID %s %w", acc.ID, ErrAlreadyExists)
+	}
+
+	return es.commitUnsafe([]model.Event{model.NewAccountOpenedEvent(acc)})
+}
+
+func (es *EventStore) LoadAccount(accountID string) (*model.Account, error) {
+	if err := es.lock(); err != nil {
+		return nil, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return nil, err
+	}
+
+	acc, ok := es.state.accounts[accountID]
+	if !ok {
+		return nil, fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+
+	copied := *acc
+	return &copied, nil
+}
+
+func (es *EventStore) LoadAccounts() ([]model.Account, error) {
+	if err := es.lock(); err != nil {
+		return nil, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return nil, err
+	}
+
+	return es.state.list(), nil
+}
+
+func (es *EventStore) UpdateAccountStatus(accountID string, status model.AccountStatus) error {
+	if err := es.lock(); err != nil {
+		return err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return err
+	}
+
+	acc, ok := es.state.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+	updated := *acc
+	if err := updated.SetStatus(status); err != nil {
+		return err
+	}
+
+	return es.commitUnsafe([]model.Event{model.NewAccountStatusEvent(updated)})
+}
+
+func (es *EventStore) ApplyTransaction(accountID string, amount float64, tx model.Transaction) error {
+	return es.apply(posting{accountID: accountID, amount: amount, tx: tx})
+}
+
+func (es *EventStore) CompareAndApply(
+	accountID string, version int64, amount float64, tx model.Transaction) error {
+	return es.apply(posting{accountID: accountID, amount: amount, tx: tx, checkVersion: true, version: version})
+}
+
+func (es *EventStore) apply(p posting) error {
+	if p.accountID == "" {
+		return fmt.Errorf("empty ID field")
+	}
+
+	errs, err := es.applyBatch([][]posting{{p}}, false, nil)
+	if err != nil {
+		return err
+	}
+	return errs[0]
+}
+
+func (es *EventStore) Transfer(fromID, toID string, amount float64, out, in model.Transaction) error {
+	return es.transfer(
+		posting{accountID: fromID, amount: -amount, tx: out},
+		posting{accountID: toID, amount: amount, tx: in})
+}
+
+func (es *EventStore) CompareAndTransfer(fromID, toID string, fromVersion, toVersion int64,
+	amount float64, out, in model.Transaction) error {
+	return es.transfer(
+		posting{accountID: fromID, amount: -amount, tx: out, checkVersion: true, version: fromVersion},
+		posting{accountID: toID, amount: amount, tx: in, checkVersion: true, version: toVersion})
+}
+
+func (es *EventStore) transfer(from, to posting) error {
+	if err := validateTransfer(from, to); err != nil {
+		return err
+	}
+
+	errs, err := es.applyBatch([][]posting{{from, to}}, false, nil)
+	if err != nil {
+		return err
+	}
+	return errs[0]
+}
+
+func (es *EventStore) ApplyBatch(batch Batch) ([]error, error) {
+	return es.applyBatch(batch.postings(), batch.Atomic, batch.versionChecks())
+}
+
+// applyBatch stages each item all or nothing and commits the events of
+// those that succeeded as one line, or nothing if atomic and one failed or
+// if an account fails one of checks.
+func (es *EventStore) applyBatch(items [][]posting, atomic bool, checks []posting) ([]error, error) {
+	if err := es.lock(); err != nil {
+		return nil, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return nil, err
+	}
+	err := checkVersions(checks, func(accountID string) *model.Account {
+		return es.state.accounts[accountID]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := newEventStage(es.state)
+	errs := make([]error, len(items))
+	for i, postings := range items {
+		errs[i] = s.add(postings)
+	}
+	if atomic && slices.ContainsFunc(errs, func(err error) bool { return err != nil }) {
+		return errs, ErrBatchRejected
+	}
+	if len(s.events) == 0 {
+		return errs, nil
+	}
+
+	if err := es.commitUnsafe(s.events); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// eventStage checks postings against the state as changed by the postings
+// staged before them, and collects their sealed transactions as events.
+// The state itself only changes once the events are committed.
+type eventStage struct {
+	state    *accountProjection
+	accounts map[string]model.Account
+	lastHash string
+	heads    map[string]string
+	events   []model.Event
+}
+
+func newEventStage(state *accountProjection) *eventStage {
+	return &eventStage{
+		state:    state,
+		accounts: make(map[string]model.Account),
+		lastHash: state.lastHash,
+		heads:    make(map[string]string),
+	}
+}
+
+// add stages postings all or nothing.
+func (s *eventStage) add(postings []posting) error {
+	accounts := make(map[string]model.Account, len(postings))
+	for _, p := range postings {
+		// Replay applies the transaction, so it has to say what the
+		// posting does.
+		if p.tx.AccountID != p.accountID || p.tx.Delta() != p.amount {
+			return fmt.Errorf("transaction %s does not match its posting: %w", p.tx.ID, model.ErrInvalidAmount)
+		}
+
+		acc, ok := accounts[p.accountID]
+		if !ok {
+			if acc, ok = s.accounts[p.accountID]; !ok {
+				current, ok := s.state.accounts[p.accountID]
+				if !ok {
+					return fmt.Errorf("account %s %w", p.accountID, ErrNotFound)
+				}
+				acc = *current
+			}
+		}
+		if err := p.check(&acc); err != nil {
+			return err
+		}
+		if err := acc.Apply(p.amount); err != nil {
+			return err
+		}
+		accounts[p.accountID] = acc
+	}
+
+	lastHash := s.lastHash
+	heads := make(map[string]string, len(postings))
+	events := make([]model.Event, 0, len(postings))
+	for _, p := range postings {
+		tx := p.tx
+		accountPrevHash, ok := heads[tx.AccountID]
+		if !ok {
+			if accountPrevHash, ok = s.heads[tx.AccountID]; !ok {
+				accountPrevHash = s.state.heads[tx.AccountID]
+			}
+		}
+		if err := sealAfter(&tx, lastHash, accountPrevHash); err != nil {
+			return err
+		}
+		lastHash, heads[tx.AccountID] = tx.Hash, tx.Hash
+		events = append(events, model.NewTransactionEvent(tx))
+	}
+
+	for id, acc := range accounts {
+		s.accounts[id] = acc
+	}
+	for id, hash := range heads {
+		s.heads[id] = hash
+	}
+	s.lastHash = lastHash
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (es *EventStore) LoadTransactions() ([]model.Transaction, error) {
+	if err := es.lock(); err != nil {
+		return nil, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return nil, err
+	}
+	h, err := es.historyUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	txs := slices.Clone(h.index.txs)
+	if txs == nil {
+		txs = []model.Transaction{}
+	}
+	return txs, nil
+}
+
+func (es *EventStore) QueryTransactions(q TransactionQuery) (TransactionPage, error) {
+	if err := es.lock(); err != nil {
+		return TransactionPage{}, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return TransactionPage{}, err
+	}
+	h, err := es.historyUnsafe()
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	return h.index.query(q)
+}
+
+func (es *EventStore) BalanceAt(accountID string, at time.Time) (float64, error) {
+	if err := es.lock(); err != nil {
+		return 0, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return 0, err
+	}
+	acc, ok := es.state.accounts[accountID]
+	if !ok {
+		return 0, fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+	h, err := es.historyUnsafe()
+	if err != nil {
+		return 0, err
+	}
+
+	return h.index.balanceAt(*acc, at), nil
+}
+
+func (es *EventStore) Verify() error {
+	txs, err := es.LoadTransactions()
+	if err != nil {
+		return err
+	}
+
+	return VerifyChain(txs)
+}
+
+// dispatchState records which events the outbox dispatcher has delivered:
+// everything up to Through, and the IDs of the delivered events after it.
+// Offset is where the line holding the event after Through starts, so that
+// the outbox reads only the tail of the log.
+type dispatchState struct {
+	Through int64    `json:"through"`
+	Offset  int64    `json:"offset,omitempty"`
+	IDs     []string `json:"ids,omitempty"`
+}
+
+func (es *EventStore) readDispatchUnsafe() (*dispatchState, error) {
+	state := &dispatchState{}
+
+	data, err := os.ReadFile(es.dispatchPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read dispatch state: %w", err)
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("corrupted dispatch state: %w", err)
+	}
+	if state.Offset > es.offset {
+		// Written for a longer log; find the place by sequence instead.
+		state.Offset = 0
+	}
+
+	return state, nil
+}
+
+// readUndispatchedUnsafe calls fn with every committed event after
+// dispatched.Through, and with the end of the line after its last event.
+func (es *EventStore) readUndispatchedUnsafe(dispatched *dispatchState,
+	fn func(e model.Event) error, lineDone func(end int64)) error {
+	_, err := es.readLogUnsafe(dispatched.Offset, func(line logLine) error {
+		for _, e := range line.events {
+			if e.Seq > es.state.seq {
+				return errStopReading
+			}
+			if e.Seq <= dispatched.Through {
+				continue
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if lineDone != nil {
+			lineDone(line.end)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// PendingEvents serves the log itself as the outbox: every event that has
+// not been marked dispatched is pending.
+func (es *EventStore) PendingEvents(limit int) ([]model.Event, error) {
+	if err := es.lock(); err != nil {
+		return nil, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return nil, err
+	}
+	dispatched, err := es.readDispatchUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	events := []model.Event{}
+	err = es.readUndispatchedUnsafe(dispatched, func(e model.Event) error {
+		if slices.Contains(dispatched.IDs, e.ID) {
+			return nil
+		}
+		if limit > 0 && len(events) == limit {
+			return errStopReading
+		}
+		events = append(events, e)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (es *EventStore) MarkDispatched(eventIDs ...string) error {
+	if err := es.lock(); err != nil {
+		return err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return err
+	}
+	dispatched, err := es.readDispatchUnsafe()
+	if err != nil {
+		return err
+	}
+
+	marked := make(map[string]bool, len(dispatched.IDs)+len(eventIDs))
+	for _, id := range append(dispatched.IDs, eventIDs...) {
+		marked[id] = true
+	}
+
+	// Move Through past the events delivered in order, and keep the IDs of
+	// those delivered ahead of an undelivered one.
+	advancing := true
+	dispatched.IDs = nil
+	err = es.readUndispatchedUnsafe(dispatched, func(e model.Event) error {
+		switch {
+		case !marked[e.ID]:
+			advancing = false
+		case advancing:
+			dispatched.Through = e.Seq
+		default:
+			dispatched.IDs = append(dispatched.IDs, e.ID)
+		}
+		return nil
+	}, func(end int64) {
+		if advancing {
+			dispatched.Offset = end
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(dispatched)
+	if err != nil {
+		return fmt.Errorf("marshal dispatch state: %w", err)
+	}
+	return writeFileAtomic(es.dispatchPath, data)
+}
+
+func (es *EventStore) Ping() error {
+	if err := es.lock(); err != nil {
+		return err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return err
+	}
+	_, err := es.readDispatchUnsafe()
+	return err
+}
+
+func (es *EventStore) Ready() error {
+	if err := es.Ping(); err != nil {
+		return err
+	}
+
+	return probeWrite(filepath.Dir(es.logPath))
+}
+
+// State reads the log from the start without keeping it, to count and
+// verify the transactions.
+func (es *EventStore) State() (State, error) {
+	if err := es.lock(); err != nil {
+		return State{}, err
+	}
+	defer es.unlock()
+
+	if err := es.syncUnsafe(); err != nil {
+		return State{}, err
+	}
+	dispatched, err := es.readDispatchUnsafe()
+	if err != nil {
+		return State{}, err
+	}
+
+	state := State{Files: []FileState{}, Accounts: len(es.state.accounts)}
+	for _, path := range []string{es.logPath, es.snapshotPath, es.dispatchPath} {
+		if path == "" {
+			continue
+		}
+		file := FileState{Path: path}
+		if info, err := os.Stat(path); err == nil {
+			file.Exists, file.Size, file.ModTime = true, info.Size(), info.ModTime().UTC()
+		}
+		state.Files = append(state.Files, file)
+	}
+
+	chain := newChainVerifier()
+	var chainErr error
+	_, err = es.readLogUnsafe(0, func(line logLine) error {
+		for _, e := range line.events {
+			if e.Seq > es.state.seq {
+				return errStopReading
+			}
+			if e.Transaction == nil {
+				continue
+			}
+			state.Transactions++
+			state.LastTransactionAt = e.Transaction.CreatedAt
+			if chainErr == nil {
+				chainErr = chain.add(*e.Transaction)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return State{}, err
+	}
+	if chainErr == nil {
+		chainErr = chain.done()
+	}
+
+	state.PendingEvents = int(es.state.seq-dispatched.Through) - len(dispatched.IDs)
+	if chainErr != nil {
+		state.ChainError = chainErr.Error()
+	} else {
+		state.ChainVerified = true
+	}
+
+	return state, nil
+}
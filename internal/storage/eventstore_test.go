@@ -0,0 +1,274 @@
+package storage_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedEvents writes some history through a store of its own and returns
+// the resulting accounts.
+func seedEvents(t *testing.T, logPath string, opts ...storage.EventOption) []model.Account {
+	t.Helper()
+
+	es := storage.NewEventStore(logPath, opts...)
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, es.SaveNewAccount(*model.NewAccount(id, "Anton", 0)))
+	}
+
+	jan := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	for i := range 12 {
+		tx := model.NewDepositTransaction("a", 10)
+		tx.CreatedAt = jan.AddDate(0, 0, 10*i)
+		require.NoError(t, es.ApplyTransaction("a", 10, tx))
+	}
+	out, in := model.NewTransferTransactions("a", "b", 25)
+	out.CreatedAt, in.CreatedAt = jan, jan
+	require.NoError(t, es.Transfer("a", "b", 25, out, in))
+	require.NoError(t, es.UpdateAccountStatus("b", model.StatusFrozen))
+
+	accounts, err := es.LoadAccounts()
+	require.NoError(t, err)
+	require.NoError(t, es.Close())
+	return accounts
+}
+
+func loadAccounts(t *testing.T, es *storage.EventStore) []model.Account {
+	t.Helper()
+
+	accounts, err := es.LoadAccounts()
+	require.NoError(t, err)
+	return accounts
+}
+
+// assertAccounts compares the stored form, since times read back from a
+// file lose their monotonic clock and location.
+func assertAccounts(t *testing.T, want, got []model.Account, msgAndArgs ...any) {
+	t.Helper()
+
+	wantJSON, err := json.Marshal(want)
+	require.NoError(t, err)
+	gotJSON, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(wantJSON), string(gotJSON), msgAndArgs...)
+}
+
+func TestEventStore_Replay(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "events.jsonl")
+	snapPath := filepath.Join(dir, "snapshot.json")
+	want := seedEvents(t, logPath, storage.WithSnapshots(snapPath, 5))
+	require.Len(t, want, 2)
+	assert.Equal(t, 95.0, want[0].Balance)
+	assert.Equal(t, model.StatusFrozen, want[1].Status)
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+		opts  []storage.EventOption
+	}{
+		{name: "from scratch"},
+		{name: "from snapshot", opts: []storage.EventOption{storage.WithSnapshots(snapPath, 0)}},
+		{
+			name: "snapshot that does not fit the log",
+			setup: func(t *testing.T) {
+				writeJSON(t, snapPath, map[string]any{"seq": 3, "offset": 7, "accounts": []model.Account{}})
+			},
+			opts: []storage.EventOption{storage.WithSnapshots(snapPath, 0)},
+		},
+		{
+			name: "snapshot changed",
+			setup: func(t *testing.T) {
+				es := storage.NewEventStore(logPath, storage.WithSnapshots(snapPath, 0))
+				require.NoError(t, es.Rebuild())
+				require.NoError(t, es.Close())
+
+				data, err := os.ReadFile(snapPath)
+				require.NoError(t, err)
+				var snap map[string]any
+				require.NoError(t, json.Unmarshal(data, &snap))
+				snap["data"].(map[string]any)["accounts"].([]any)[0].(map[string]any)["balance"] = 1e6
+				writeJSON(t, snapPath, snap)
+			},
+			opts: []storage.EventOption{storage.WithSnapshots(snapPath, 0)},
+		},
+		{
+			name: "snapshot of another log",
+			setup: func(t *testing.T) {
+				seedEvents(t, filepath.Join(t.TempDir(), "events.jsonl"), storage.WithSnapshots(snapPath, 0))
+			},
+			opts: []storage.EventOption{storage.WithSnapshots(snapPath, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
+			es := storage.NewEventStore(logPath, tt.opts...)
+			assertAccounts(t, want, loadAccounts(t, es))
+			require.NoError(t, es.Verify())
+		})
+	}
+}
+
+func TestEventStore_TornLine(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	want := seedEvents(t, logPath)
+
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`[{"id":"half-writ`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	es := storage.NewEventStore(logPath)
+	assertAccounts(t, want, loadAccounts(t, es), "an unfinished line is not part of the log")
+
+	require.NoError(t, es.ApplyTransaction("a", 5, model.NewDepositTransaction("a", 5)))
+	reopened := storage.NewEventStore(logPath)
+	acc, err := reopened.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, want[0].Balance+5, acc.Balance, "the next commit replaces the unfinished line")
+}
+
+func TestEventStore_Rebuild(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "events.jsonl")
+	snapPath := filepath.Join(dir, "snapshot.json")
+	want := seedEvents(t, logPath, storage.WithSnapshots(snapPath, 0))
+
+	es := storage.NewEventStore(logPath, storage.WithSnapshots(snapPath, 0))
+	require.NoError(t, es.Rebuild())
+	assertAccounts(t, want, loadAccounts(t, es))
+
+	reopened := storage.NewEventStore(logPath, storage.WithSnapshots(snapPath, 0))
+	assertAccounts(t, want, loadAccounts(t, reopened), "rebuild replaces the snapshot")
+}
+
+func TestEventStore_ProjectionOverExistingLog(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	seedEvents(t, logPath)
+
+	totals := storage.NewMonthlyTotals()
+	es := storage.NewEventStore(logPath, storage.WithProjection(totals))
+	require.NoError(t, es.Refresh())
+
+	assert.Equal(t, []storage.MonthTotal{
+		{Month: "2026-01", In: 20, Out: 25, Count: 3},
+		{Month: "2026-02", In: 30, Count: 3},
+		{Month: "2026-03", In: 30, Count: 3},
+		{Month: "2026-04", In: 30, Count: 3},
+		{Month: "2026-05", In: 10, Count: 1},
+	}, totals.Totals("a"))
+
+	tx := model.NewDepositTransaction("a", 5)
+	tx.CreatedAt = time.Date(2026, 5, 31, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, es.ApplyTransaction("a", 5, tx))
+	assert.Equal(t, storage.MonthTotal{Month: "2026-05", In: 15, Count: 2}, totals.Totals("a")[4],
+		"new events reach the projection as they are committed")
+}
+
+func TestEventStore_ProjectionAfterFailedRead(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	seedEvents(t, logPath)
+
+	totals := storage.NewMonthlyTotals()
+	es := storage.NewEventStore(logPath, storage.WithProjection(totals))
+	require.NoError(t, es.Refresh())
+	want := totals.Totals("a")
+
+	info, err := os.Stat(logPath)
+	require.NoError(t, err)
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("not json\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.ErrorIs(t, es.Refresh(), storage.ErrCorruptLog)
+
+	require.NoError(t, os.Truncate(logPath, info.Size()))
+	require.NoError(t, es.Refresh())
+	assert.Equal(t, want, totals.Totals("a"), "the replay after a failed read does not count events twice")
+}
+
+func TestEventStore_AcrossHandles(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	first := storage.NewEventStore(logPath)
+	second := storage.NewEventStore(logPath)
+
+	require.NoError(t, first.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+	require.NoError(t, second.ApplyTransaction("a", 30, model.NewDepositTransaction("a", 30)))
+	require.NoError(t, first.ApplyTransaction("a", -10, model.NewWithdrawTransaction("a", 10)))
+
+	acc, err := second.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, acc.Balance)
+	require.NoError(t, second.Verify())
+}
+
+func TestEventStore_Outbox(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	seedEvents(t, logPath)
+	es := storage.NewEventStore(logPath)
+
+	pending, err := es.PendingEvents(0)
+	require.NoError(t, err)
+	require.Len(t, pending, 17)
+	assert.Equal(t, model.AccountOpened, pending[0].Type)
+	assert.Equal(t, int64(17), pending[16].Seq)
+
+	require.NoError(t, es.MarkDispatched(pending[0].ID, pending[2].ID, pending[5].ID))
+	require.NoError(t, es.MarkDispatched(pending[1].ID))
+
+	rest, err := es.PendingEvents(2)
+	require.NoError(t, err)
+	require.Len(t, rest, 2)
+	assert.Equal(t, pending[3].ID, rest[0].ID)
+	assert.Equal(t, pending[4].ID, rest[1].ID)
+
+	state, err := es.State()
+	require.NoError(t, err)
+	assert.Equal(t, 13, state.PendingEvents)
+	assert.Equal(t, 14, state.Transactions)
+	assert.True(t, state.ChainVerified)
+
+	// The dispatch state points past the delivered lines, which another
+	// handle skips without reading.
+	var dispatched struct {
+		Through int64 `json:"through"`
+		Offset  int64 `json:"offset"`
+	}
+	data, err := os.ReadFile(logPath + ".dispatched")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &dispatched))
+	assert.Equal(t, int64(3), dispatched.Through)
+	assert.Positive(t, dispatched.Offset)
+
+	reopened := storage.NewEventStore(logPath)
+	rest, err = reopened.PendingEvents(0)
+	require.NoError(t, err)
+	require.Len(t, rest, 13)
+	assert.Equal(t, pending[3].ID, rest[0].ID)
+	assert.Equal(t, pending[16].ID, rest[12].ID)
+}
+
+func TestEventStore_DispatchStateUnreadable(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	seedEvents(t, logPath)
+	// Unreadable dispatch state must not look like nothing was delivered.
+	require.NoError(t, os.Mkdir(logPath+".dispatched", 0755))
+	es := storage.NewEventStore(logPath)
+
+	_, err := es.PendingEvents(0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read dispatch state")
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var ErrLockTimeout = errors.New("timed out waiting for storage lock")
+
+const (
+	defaultLockTimeout   = 10 * time.Second
+	defaultStaleLockAge  = time.Minute
+	maxLockRetryInterval = 50 * time.Millisecond
+)
+
+// processLock keeps other processes that open the same files out while an
+// operation runs. fs.mu already keeps out other goroutines of this one.
+type processLock interface {
+	tryLock() (bool, error)
+	unlock() error
+	close() error
+}
+
+// WithLockTimeout bounds how long an operation waits for another process
+// to release the data files before failing with ErrLockTimeout.
+func WithLockTimeout(d time.Duration) FileOption {
+	return func(fs *FileStorage) {
+		fs.lockTimeout = d
+	}
+}
+
+// WithStaleLockAge sets when a lock file left behind by a crashed process
+// may be taken over. It only matters on platforms without flock, where
+// the lock is a plain file that outlives its owner.
+func WithStaleLockAge(d time.Duration) FileOption {
+	return func(fs *FileStorage) {
+		fs.staleLockAge = d
+	}
+}
+
+func (fs *FileStorage) lockPath() string {
+	return fs.accountFilePath + ".lock"
+}
+
+func acquire(l processLock, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	wait := time.Millisecond
+
+	for {
+		ok, err := l.tryLock()
+		if err != nil {
+			return fmt.Errorf("lock data files: %w", err)
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w after %s", ErrLockTimeout, timeout)
+		}
+
+		time.Sleep(wait)
+		wait = min(wait*2, maxLockRetryInterval)
+	}
+}
+
+// lockFile is the portable fallback: whoever creates the file holds the
+// lock. It names its owner, and the owner touches it every staleAge/4
+// while it holds it, so a file that has not been touched for staleAge
+// belongs to a process that died holding it and may be taken over.
+type lockFile struct {
+	path     string
+	staleAge time.Duration
+
+	owner string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// maxLockTakeovers bounds how often one tryLock tries to take over a stale
+// lock before it leaves the rest to acquire's retries.
+const maxLockTakeovers = 3
+
+func (l *lockFile) tryLock() (bool, error) {
+	if l.owner == "" {
+		l.owner = strconv.Itoa(os.Getpid()) + " " + rand.Text()
+	}
+
+	for range maxLockTakeovers {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, werr := f.WriteString(l.owner + "\n")
+			cerr := f.Close()
+			if err := errors.Join(werr, cerr); err != nil {
+				os.Remove(l.path)
+				return false, err
+			}
+			l.heartbeat()
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+
+		taken, err := l.takeOver()
+		if err != nil || !taken {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// takeOver moves a stale lock file out of the way. The rename is atomic,
+// so of several processes that found the same stale file only one moves
+// it. Whoever moved a file that was no longer the stale one, because it
+// was taken over and created again in the meantime, puts it back.
+func (l *lockFile) takeOver() (bool, error) {
+	stale, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Since(info.ModTime()) <= l.staleAge {
+		return false, nil
+	}
+
+	moved := l.path + "." + rand.Text()
+	if err := os.Rename(l.path, moved); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return true, nil
+		}
+		return false, fmt.Errorf("take over stale lock: %w", err)
+	}
+	defer os.Remove(moved)
+
+	got, err := os.ReadFile(moved)
+	if err != nil {
+		return false, fmt.Errorf("take over stale lock: %w", err)
+	}
+	if !bytes.Equal(got, stale) {
+		if err := os.Link(moved, l.path); err != nil && !errors.Is(err, os.ErrExist) {
+			return false, fmt.Errorf("restore lock: %w", err)
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// heartbeat keeps the lock file fresh until unlock.
+func (l *lockFile) heartbeat() {
+	l.stop, l.done = make(chan struct{}), make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(max(l.staleAge/4, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				os.Chtimes(l.path, now, now)
+			}
+		}
+	}(l.stop, l.done)
+}
+
+// unlock removes the lock file unless it was taken over, which only
+// happens when the heartbeat could not keep up.
+func (l *lockFile) unlock() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop, l.done = nil, nil
+	}
+
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(data) != l.owner+"\n" {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *lockFile) close() error {
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package storage
+
+import "time"
+
+func newProcessLock(path string, staleAge time.Duration) processLock {
+	return &lockFile{path: path, staleAge: staleAge}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json.lock")
+	first := &lockFile{path: path, staleAge: time.Minute}
+	second := &lockFile{path: path, staleAge: time.Minute}
+
+	require.NoError(t, acquire(first, time.Second))
+
+	err := acquire(second, 20*time.Millisecond)
+	require.ErrorIs(t, err, ErrLockTimeout)
+
+	require.NoError(t, first.unlock())
+	require.NoError(t, acquire(second, time.Second))
+	require.NoError(t, second.unlock())
+}
+
+func TestLockFile_TakesOverStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json.lock")
+	require.NoError(t, os.WriteFile(path, []byte("12345\n"), 0644))
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	l := &lockFile{path: path, staleAge: time.Minute}
+	require.NoError(t, acquire(l, 20*time.Millisecond))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotEqual(t, "12345\n", string(data), "the lock now names this process")
+	require.NoError(t, l.unlock())
+}
+
+func TestLockFile_HeldLockStaysFresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json.lock")
+	holder := &lockFile{path: path, staleAge: 40 * time.Millisecond}
+	waiter := &lockFile{path: path, staleAge: 40 * time.Millisecond}
+
+	require.NoError(t, acquire(holder, time.Second))
+	err := acquire(waiter, 200*time.Millisecond)
+	require.ErrorIs(t, err, ErrLockTimeout, "a lock whose owner is alive is not stale")
+
+	require.NoError(t, holder.unlock())
+	require.NoError(t, acquire(waiter, time.Second))
+	require.NoError(t, waiter.unlock())
+}
+
+func TestLockFile_UnlockKeepsLockTakenOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json.lock")
+	l := &lockFile{path: path, staleAge: time.Minute}
+	require.NoError(t, acquire(l, time.Second))
+
+	require.NoError(t, os.WriteFile(path, []byte("12345 other\n"), 0644))
+	require.NoError(t, l.unlock())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "12345 other\n", string(data))
+}
+
+func TestFileStorage_LockTimeout(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+
+	holder := NewFileStorage(accPath, txPath)
+	waiter := NewFileStorage(accPath, txPath, WithLockTimeout(30*time.Millisecond))
+
+	require.NoError(t, holder.lock(OpLoadAccounts))
+
+	_, err := waiter.LoadAccounts()
+	require.ErrorIs(t, err, ErrLockTimeout)
+
+	holder.unlock()
+	_, err = waiter.LoadAccounts()
+	require.NoError(t, err)
+}
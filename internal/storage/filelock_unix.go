@@ -0,0 +1,55 @@
+//go:build unix
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// flock holds an advisory lock on an open file. The kernel drops it when
+// the owning process dies, so it never goes stale.
+type flock struct {
+	path string
+	f    *os.File
+}
+
+func newProcessLock(path string, _ time.Duration) processLock {
+	return &flock{path: path}
+}
+
+func (l *flock) tryLock() (bool, error) {
+	if l.f == nil {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return false, err
+		}
+		l.f = f
+	}
+
+	err := syscall.Flock(int(l.f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (l *flock) unlock() error {
+	return syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+}
+
+func (l *flock) close() error {
+	if l.f == nil {
+		return nil
+	}
+
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
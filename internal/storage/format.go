@@ -0,0 +1,426 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// FormatVersion is the version of the data files this build writes. Each
+// file is wrapped in an envelope, {"version": N, "data": ...}; version 1
+// files predate the envelope and hold the bare data. The event log of an
+// EventStore starts with a {"version": N} line instead, and has none in
+// version 1.
+const FormatVersion = 2
+
+// ErrUnsupportedVersion means a data file was written by a newer build and
+// cannot be read safely by this one.
+var ErrUnsupportedVersion = errors.New("unsupported data format version")
+
+type fileKind string
+
+const (
+	kindAccounts     fileKind = "accounts"
+	kindTransactions fileKind = "transactions"
+	kindOutbox       fileKind = "outbox"
+	kindEvents       fileKind = "event log"
+	kindSnapshot     fileKind = "snapshot"
+)
+
+type fileEnvelope struct {
+	Version int `json:"version"`
+	Data    any `json:"data"`
+}
+
+// migration upgrades the files of each kind it names from version from to
+// from+1; other kinds carry over unchanged. A step gets the document
+// decoded with json.Number for numbers, so values it does not touch are
+// written back exactly. For the event log the document is one line.
+type migration struct {
+	from  int
+	steps map[fileKind]func(doc any) (any, error)
+}
+
+// migrations holds one entry per version, in order: migrations[i] upgrades
+// version i+1.
+var migrations = []migration{
+	{from: 1, steps: map[fileKind]func(any) (any, error){
+		kindAccounts: renameAccountFields,
+		kindOutbox:   renameOutboxAccountFields,
+		kindEvents:   renameLineAccountFields,
+		kindSnapshot: renameSnapshotAccountFields,
+	}},
+}
+
+// accountFieldsV1 maps the Go field names version 1 used for accounts to
+// their JSON tags.
+var accountFieldsV1 = map[string]string{
+	"ID":        "id",
+	"Owner":     "owner",
+	"Balance":   "balance",
+	"Status":    "status",
+	"Version":   "version",
+	"CreatedAt": "created_at",
+}
+
+func renameAccountFields(doc any) (any, error) {
+	accounts, ok := doc.([]any)
+	if !ok {
+		return nil, fmt.Errorf("accounts are not a list")
+	}
+	for _, acc := range accounts {
+		if err := renameFields(acc, accountFieldsV1); err != nil {
+			return nil, err
+		}
+	}
+
+	return accounts, nil
+}
+
+// renameOutboxAccountFields fixes the accounts embedded in outbox events.
+func renameOutboxAccountFields(doc any) (any, error) {
+	outbox, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("outbox is not an object")
+	}
+	events, _ := outbox["events"].([]any)
+	if err := renameEventAccountFields(events); err != nil {
+		return nil, err
+	}
+
+	return outbox, nil
+}
+
+// renameLineAccountFields fixes the accounts embedded in the events of a
+// line of the event log.
+func renameLineAccountFields(doc any) (any, error) {
+	events, ok := doc.([]any)
+	if !ok {
+		return nil, fmt.Errorf("line is not a list of events")
+	}
+	if err := renameEventAccountFields(events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func renameSnapshotAccountFields(doc any) (any, error) {
+	snap, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("snapshot is not an object")
+	}
+	accounts, _ := snap["accounts"].([]any)
+	for _, acc := range accounts {
+		if err := renameFields(acc, accountFieldsV1); err != nil {
+			return nil, err
+		}
+	}
+
+	return snap, nil
+}
+
+func renameEventAccountFields(events []any) error {
+	for _, e := range events {
+		event, ok := e.(map[string]any)
+		if !ok {
+			return fmt.Errorf("event is not an object")
+		}
+		if acc, ok := event["account"]; ok && acc != nil {
+			if err := renameFields(acc, accountFieldsV1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func renameFields(v any, names map[string]string) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("expected an object, got %T", v)
+	}
+	for old, name := range names {
+		if value, ok := obj[old]; ok {
+			delete(obj, old)
+			obj[name] = value
+		}
+	}
+
+	return nil
+}
+
+// readEnvelope returns the version of a data file and the data inside.
+func readEnvelope(data []byte) (int, json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return 1, data, nil
+	}
+
+	var env struct {
+		Version int             `json:"version"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(trimmed, &env); err != nil {
+		return 0, nil, err
+	}
+	// The version 1 outbox is an object too, but has no version.
+	if env.Version == 0 {
+		return 1, data, nil
+	}
+
+	return env.Version, env.Data, nil
+}
+
+// migrate brings data of the given kind from version to FormatVersion.
+func migrate(kind fileKind, version int, data json.RawMessage) (json.RawMessage, error) {
+	if version > FormatVersion {
+		return nil, fmt.Errorf("%s file has version %d, this build reads up to %d: %w",
+			kind, version, FormatVersion, ErrUnsupportedVersion)
+	}
+	if version < 1 {
+		return nil, fmt.Errorf("%s file has invalid version %d", kind, version)
+	}
+	if version == FormatVersion {
+		return data, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations[version-1:] {
+		step, ok := m.steps[kind]
+		if !ok {
+			continue
+		}
+		var err error
+		if doc, err = step(doc); err != nil {
+			return nil, fmt.Errorf("migrate %s file from version %d: %w", kind, m.from, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// decodeFile reads a data file of any supported version into v.
+func decodeFile(kind fileKind, data []byte, v any) error {
+	version, raw, err := readEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if raw, err = migrate(kind, version, raw); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+type dataFile struct {
+	kind fileKind
+	path string
+}
+
+// dataFiles lists the files in the versioned format that fs uses.
+func (fs *FileStorage) dataFiles() []dataFile {
+	files := []dataFile{
+		{kindAccounts, fs.accountFilePath},
+		{kindTransactions, fs.transactionFilePath},
+	}
+	if fs.outboxFilePath != "" {
+		files = append(files, dataFile{kindOutbox, fs.outboxFilePath})
+	}
+
+	return files
+}
+
+// WithoutUpgrade leaves data files of an older version as they are and
+// reads them in the current format, for tools that must not change the
+// data they inspect. Files they cannot read, written by a newer build or
+// damaged, are still refused. An interrupted commit is still finished,
+// since the files disagree until it is.
+func WithoutUpgrade() FileOption {
+	return func(fs *FileStorage) {
+		fs.noUpgrade = true
+	}
+}
+
+// upgrade rewrites data files of an older version in the current format.
+// A failure is logged and returned, and the upgrade runs again on the next
+// operation, which fails for as long as it does.
+func (fs *FileStorage) upgrade() error {
+	err := fs.lock(OpUpgrade)
+	if err == nil {
+		err = fs.recoverUnsafe()
+		fs.unlock()
+	}
+	if err != nil {
+		fs.logger.Error("upgrade data files failed", slog.Any("error", err))
+	}
+
+	return err
+}
+
+// upgradeUnsafe copies every file to upgrade to <file>.v<N>.bak, N being
+// its old version, then replaces all of them in one commit.
+func (fs *FileStorage) upgradeUnsafe() error {
+	if fs.upgraded {
+		return nil
+	}
+
+	var writes []fileWrite
+	for _, f := range fs.dataFiles() {
+		data, err := os.ReadFile(f.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s file: %w", f.kind, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		version, raw, err := readEnvelope(data)
+		if err != nil {
+			return fmt.Errorf("corrupted %s file: %w", f.kind, err)
+		}
+		if version == FormatVersion {
+			continue
+		}
+		migrated, err := migrate(f.kind, version, raw)
+		if err != nil {
+			return err
+		}
+		if fs.noUpgrade {
+			continue
+		}
+
+		backup := fmt.Sprintf("%s.v%d.bak", f.path, version)
+		if err := writeFileAtomic(backup, data); err != nil {
+			return fmt.Errorf("back up %s file: %w", f.kind, err)
+		}
+		w, err := marshalFile(f.path, migrated)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, w)
+
+		fs.logger.Info("upgrading data file",
+			slog.String("path", f.path),
+			slog.Int("from_version", version),
+			slog.Int("to_version", FormatVersion),
+			slog.String("backup", backup))
+	}
+
+	if len(writes) > 0 {
+		if err := fs.commitUnsafe(writes...); err != nil {
+			return err
+		}
+	}
+
+	fs.upgraded = true
+	return nil
+}
+
+// logHeader is the first line of an event log from version 2 on.
+type logHeader struct {
+	Version int `json:"version"`
+}
+
+func logHeaderLine() []byte {
+	line, _ := json.Marshal(logHeader{Version: FormatVersion})
+	return append(line, '\n')
+}
+
+// parseLogHeader returns the version the header line of a log says, or 1
+// for a log that starts with events.
+func parseLogHeader(line []byte) (int, bool, error) {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return 1, false, nil
+	}
+
+	var h logHeader
+	if err := json.Unmarshal(trimmed, &h); err != nil {
+		return 0, false, fmt.Errorf("%w: header: %v", ErrCorruptLog, err)
+	}
+	if h.Version > FormatVersion {
+		return 0, false, fmt.Errorf("event log has version %d, this build reads up to %d: %w",
+			h.Version, FormatVersion, ErrUnsupportedVersion)
+	}
+	if h.Version < 2 {
+		return 0, false, fmt.Errorf("%w: header has invalid version %d", ErrCorruptLog, h.Version)
+	}
+
+	return h.Version, true, nil
+}
+
+// upgradeLogUnsafe rewrites an event log of an older version line by line
+// in the current format, after copying it to <log>.v<N>.bak. An
+// unfinished last line is dropped, as the next commit would. The rewrite
+// moves every line, so the outbox loses its place in the log and finds it
+// again by sequence, and the snapshot no longer matches and is replaced.
+func (es *EventStore) upgradeLogUnsafe() error {
+	data, err := os.ReadFile(es.logPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read event log: %w", err)
+	}
+
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if last := lines[len(lines)-1]; !bytes.HasSuffix(last, []byte("\n")) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	version, header, err := parseLogHeader(lines[0])
+	if err != nil {
+		return err
+	}
+	if version == FormatVersion {
+		return nil
+	}
+	if header {
+		lines = lines[1:]
+	}
+
+	upgraded := bytes.NewBuffer(logHeaderLine())
+	for i, line := range lines {
+		migrated, err := migrate(kindEvents, version, bytes.TrimSpace(line))
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %w", ErrCorruptLog, i+1, err)
+		}
+		upgraded.Write(migrated)
+		upgraded.WriteByte('\n')
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", es.logPath, version)
+	if err := writeFileAtomic(backup, data); err != nil {
+		return fmt.Errorf("back up event log: %w", err)
+	}
+	if err := writeFileAtomic(es.logPath, upgraded.Bytes()); err != nil {
+		return err
+	}
+
+	dispatched, err := es.readDispatchUnsafe()
+	if err != nil || (dispatched.Through == 0 && len(dispatched.IDs) == 0) {
+		return err
+	}
+	dispatched.Offset = 0
+	state, err := json.Marshal(dispatched)
+	if err != nil {
+		return fmt.Errorf("marshal dispatch state: %w", err)
+	}
+	return writeFileAtomic(es.dispatchPath, state)
+}
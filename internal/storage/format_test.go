@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	accountsV1 = `[
+  {"ID": "a", "Owner": "Anton", "Balance": 10.5, "Status": "active", "Version": 3,
+   "CreatedAt": "2025-03-01T10:00:00Z"}
+]`
+	transactionsV1 = `[
+  {"id": "t1", "account_id": "a", "type": "deposit", "amount": 10.5,
+   "created_at": "2025-03-01T10:00:00Z"}
+]`
+	outboxV1 = `{"next_seq": 2, "events": [
+  {"id": "e1", "seq": 1, "type": "account_opened", "account_id": "a",
+   "occurred_at": "2025-03-01T10:00:00Z",
+   "account": {"ID": "a", "Owner": "Anton", "Balance": 0, "Status": "active", "Version": 0,
+               "CreatedAt": "2025-03-01T10:00:00Z"}}
+]}`
+	eventLineV1 = `[{"id": "e1", "seq": 1, "type": "account_opened", "account_id": "a",` +
+		`"occurred_at": "2025-03-01T10:00:00Z", "account": {"ID": "a", "Owner": "Anton", "Balance": 0,` +
+		`"Status": "active", "Version": 0, "CreatedAt": "2025-03-01T10:00:00Z"}}]`
+)
+
+func TestMigrations_Ordered(t *testing.T) {
+	require.Len(t, migrations, FormatVersion-1, "every version but the first needs a migration")
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.from, "migration %d", i)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    fileKind
+		version int
+		data    string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "accounts from version 1",
+			kind:    kindAccounts,
+			version: 1,
+			data:    accountsV1,
+			want: `[{"id": "a", "owner": "Anton", "balance": 10.5, "status": "active", "version": 3,
+				"created_at": "2025-03-01T10:00:00Z"}]`,
+		},
+		{
+			name:    "transactions from version 1",
+			kind:    kindTransactions,
+			version: 1,
+			data:    transactionsV1,
+			want:    transactionsV1,
+		},
+		{
+			name:    "outbox from version 1",
+			kind:    kindOutbox,
+			version: 1,
+			data:    outboxV1,
+			want: `{"next_seq": 2, "events": [{"id": "e1", "seq": 1, "type": "account_opened",
+				"account_id": "a", "occurred_at": "2025-03-01T10:00:00Z",
+				"account": {"id": "a", "owner": "Anton", "balance": 0, "status": "active",
+				"version": 0, "created_at": "2025-03-01T10:00:00Z"}}]}`,
+		},
+		{
+			name:    "event log line from version 1",
+			kind:    kindEvents,
+			version: 1,
+			data:    eventLineV1,
+			want: `[{"id": "e1", "seq": 1, "type": "account_opened", "account_id": "a",
+				"occurred_at": "2025-03-01T10:00:00Z",
+				"account": {"id": "a", "owner": "Anton", "balance": 0, "status": "active",
+				"version": 0, "created_at": "2025-03-01T10:00:00Z"}}]`,
+		},
+		{
+			name:    "snapshot from version 1",
+			kind:    kindSnapshot,
+			version: 1,
+			data:    `{"seq": 1, "offset": 10, "accounts": [{"ID": "a", "CreatedAt": "2025-03-01T10:00:00Z"}]}`,
+			want:    `{"seq": 1, "offset": 10, "accounts": [{"id": "a", "created_at": "2025-03-01T10:00:00Z"}]}`,
+		},
+		{
+			name:    "current version",
+			kind:    kindAccounts,
+			version: FormatVersion,
+			data:    `[{"id": "a"}]`,
+			want:    `[{"id": "a"}]`,
+		},
+		{
+			name:    "newer version",
+			kind:    kindAccounts,
+			version: FormatVersion + 1,
+			data:    `[]`,
+			wantErr: ErrUnsupportedVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := migrate(tt.kind, tt.version, json.RawMessage(tt.data))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestFileStorage_UpgradesOldFiles(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+	outboxPath := filepath.Join(dir, "outbox.json")
+	for path, data := range map[string]string{
+		accPath:    accountsV1,
+		txPath:     transactionsV1,
+		outboxPath: outboxV1,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	}
+
+	fs := NewFileStorage(accPath, txPath, WithOutbox(outboxPath))
+
+	for path, data := range map[string]string{
+		accPath:    accountsV1,
+		txPath:     transactionsV1,
+		outboxPath: outboxV1,
+	} {
+		backup, err := os.ReadFile(path + ".v1.bak")
+		require.NoError(t, err)
+		assert.Equal(t, data, string(backup), "backup of %s", filepath.Base(path))
+
+		current, err := os.ReadFile(path)
+		require.NoError(t, err)
+		version, _, err := readEnvelope(current)
+		require.NoError(t, err)
+		assert.Equal(t, FormatVersion, version, "%s is upgraded", filepath.Base(path))
+	}
+
+	accounts, err := fs.LoadAccounts()
+	require.NoError(t, err)
+	assert.Equal(t, []model.Account{{
+		ID:        "a",
+		Owner:     "Anton",
+		Balance:   10.5,
+		Status:    model.StatusActive,
+		Version:   3,
+		CreatedAt: time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC),
+	}}, accounts)
+
+	pending, err := fs.PendingEvents(0)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "Anton", pending[0].Account.Owner)
+
+	txs, err := fs.LoadTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	assert.Equal(t, 10.5, txs[0].Amount)
+
+	// Files in the current format are left alone.
+	require.NoError(t, os.Remove(accPath+".v1.bak"))
+	NewFileStorage(accPath, txPath, WithOutbox(outboxPath))
+	assert.NoFileExists(t, accPath+".v1.bak")
+}
+
+func TestFileStorage_WithoutUpgrade(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+	require.NoError(t, os.WriteFile(accPath, []byte(accountsV1), 0644))
+	require.NoError(t, os.WriteFile(txPath, []byte(transactionsV1), 0644))
+
+	fs, err := OpenFileStorage(accPath, txPath, WithoutUpgrade())
+	require.NoError(t, err)
+	defer fs.Close()
+
+	accounts, err := fs.LoadAccounts()
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "Anton", accounts[0].Owner)
+	txs, err := fs.LoadTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+
+	for path, data := range map[string]string{accPath: accountsV1, txPath: transactionsV1} {
+		current, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, data, string(current), "%s is left as it is", filepath.Base(path))
+		assert.NoFileExists(t, path+".v1.bak")
+	}
+
+	newer := `{"version": 99, "data": []}`
+	require.NoError(t, os.WriteFile(accPath, []byte(newer), 0644))
+	_, err = OpenFileStorage(accPath, txPath, WithoutUpgrade())
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestFileStorage_UpgradeFailsOnUnreadableFile(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+	outboxPath := filepath.Join(dir, "outbox.json")
+	require.NoError(t, os.WriteFile(accPath, []byte(accountsV1), 0644))
+	require.NoError(t, os.Mkdir(outboxPath, 0755))
+
+	_, err := OpenFileStorage(accPath, txPath, WithOutbox(outboxPath))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read outbox file")
+
+	fs := NewFileStorage(accPath, txPath, WithOutbox(outboxPath))
+	_, err = fs.LoadAccounts()
+	require.Error(t, err)
+	assert.False(t, fs.upgraded, "the upgrade runs again on the next operation")
+
+	data, err := os.ReadFile(accPath)
+	require.NoError(t, err)
+	assert.Equal(t, accountsV1, string(data), "nothing is upgraded")
+}
+
+func TestFileStorage_RefusesNewerVersion(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+	newer := `{"version": 99, "data": [{"id": "a", "currency": "EUR"}]}`
+	require.NoError(t, os.WriteFile(accPath, []byte(newer), 0644))
+
+	_, err := OpenFileStorage(accPath, txPath)
+	require.ErrorIs(t, err, ErrUnsupportedVersion, "opening the store fails")
+
+	fs := NewFileStorage(accPath, txPath)
+	_, err = fs.LoadAccounts()
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	err = fs.SaveNewAccount(*model.NewAccount("b", "Stas", 0))
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	require.ErrorIs(t, fs.Ping(), ErrUnsupportedVersion)
+
+	data, err := os.ReadFile(accPath)
+	require.NoError(t, err)
+	assert.Equal(t, newer, string(data), "the file is not touched")
+	assert.NoFileExists(t, accPath+".v99.bak")
+}
+
+func TestEventStore_UpgradesOldLog(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "events.jsonl")
+
+	tx := model.NewDepositTransaction("a", 10.5)
+	tx.CreatedAt = time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, sealAfter(&tx, "", ""))
+	deposit := model.NewTransactionEvent(tx)
+	deposit.Seq = 2
+	line, err := json.Marshal([]model.Event{deposit})
+	require.NoError(t, err)
+	logV1 := eventLineV1 + "\n" + string(line) + "\n"
+	require.NoError(t, os.WriteFile(logPath, []byte(logV1), 0644))
+	// The outbox delivered the first event and knew where its line ended.
+	require.NoError(t, os.WriteFile(logPath+".dispatched",
+		[]byte(fmt.Sprintf(`{"through": 1, "offset": %d}`, len(eventLineV1)+1)), 0644))
+
+	es := NewEventStore(logPath)
+	accounts, err := es.LoadAccounts()
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC), accounts[0].CreatedAt.UTC(),
+		"fields renamed since version 1 survive the upgrade")
+	assert.Equal(t, 10.5, accounts[0].Balance)
+	require.NoError(t, es.Verify())
+
+	backup, err := os.ReadFile(logPath + ".v1.bak")
+	require.NoError(t, err)
+	assert.Equal(t, logV1, string(backup))
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	version, header, err := parseLogHeader(data[:bytes.IndexByte(data, '\n')+1])
+	require.NoError(t, err)
+	assert.True(t, header)
+	assert.Equal(t, FormatVersion, version)
+
+	pending, err := es.PendingEvents(0)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, deposit.ID, pending[0].ID)
+
+	// A log in the current format is left alone.
+	require.NoError(t, os.Remove(logPath+".v1.bak"))
+	_, err = NewEventStore(logPath).LoadAccounts()
+	require.NoError(t, err)
+	assert.NoFileExists(t, logPath+".v1.bak")
+}
+
+func TestEventStore_RefusesNewerVersion(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	newer := `{"version": 99}` + "\n" + `[{"id": "e1", "seq": 1, "type": "account_opened"}]` + "\n"
+	require.NoError(t, os.WriteFile(logPath, []byte(newer), 0644))
+
+	_, err := OpenEventStore(logPath)
+	require.ErrorIs(t, err, ErrUnsupportedVersion, "opening the store fails")
+
+	es := NewEventStore(logPath)
+	_, err = es.LoadAccounts()
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	require.ErrorIs(t, es.SaveNewAccount(*model.NewAccount("b", "Stas", 0)), ErrUnsupportedVersion)
+
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, newer, string(data), "the log is not touched")
+}
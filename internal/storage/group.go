@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WithGroupCommit coalesces concurrent transactions and transfers into
+// shared commits of at most maxBatch items. A batch waits up to window
+// after its first item for others to join, then one flusher goroutine
+// commits it for everyone; callers arriving meanwhile form the next
+// batch. Every item still succeeds or fails on its own. A maxBatch below
+// two disables it.
+func WithGroupCommit(maxBatch int, window time.Duration) FileOption {
+	return func(fs *FileStorage) {
+		if maxBatch < 2 {
+			fs.group = nil
+			return
+		}
+
+		fs.group = &groupCommit{
+			maxBatch: maxBatch,
+			window:   window,
+			full:     make(chan struct{}, 1),
+		}
+	}
+}
+
+type groupCommit struct {
+	maxBatch int
+	window   time.Duration
+
+	mu       sync.Mutex
+	pending  []*batchItem
+	flushing bool
+	full     chan struct{}
+}
+
+// batchItem is one caller's postings, applied all or nothing.
+type batchItem struct {
+	postings []posting
+	done     chan error
+}
+
+// submit queues postings and waits for the commit that includes them.
+// With no commit in progress it starts a flusher goroutine, so that no
+// caller is kept busy committing for others.
+func (fs *FileStorage) submit(postings ...posting) error {
+	g := fs.group
+	item := &batchItem{postings: postings, done: make(chan error, 1)}
+
+	g.mu.Lock()
+	g.pending = append(g.pending, item)
+	if len(g.pending) >= g.maxBatch {
+		select {
+		case g.full <- struct{}{}:
+		default:
+		}
+	}
+	if !g.flushing {
+		g.flushing = true
+		go fs.flush()
+	}
+	g.mu.Unlock()
+
+	return <-item.done
+}
+
+// flush commits batches until nobody is left waiting. Whatever way it
+// ends, a new flusher takes over if items arrived in the meantime.
+func (fs *FileStorage) flush() {
+	g := fs.group
+	defer func() {
+		g.mu.Lock()
+		g.flushing = len(g.pending) > 0
+		if g.flushing {
+			go fs.flush()
+		}
+		g.mu.Unlock()
+	}()
+
+	for {
+		g.mu.Lock()
+		idle := len(g.pending) == 0
+		g.mu.Unlock()
+		if idle {
+			return
+		}
+
+		g.wait()
+
+		g.mu.Lock()
+		n := min(len(g.pending), g.maxBatch)
+		batch := g.pending[:n:n]
+		g.pending = slices.Clone(g.pending[n:])
+		g.mu.Unlock()
+
+		fs.commitBatch(batch)
+	}
+}
+
+// wait lets the batch fill up for the window, unless it is full already.
+func (g *groupCommit) wait() {
+	g.mu.Lock()
+	if len(g.pending) >= g.maxBatch || g.window <= 0 {
+		g.mu.Unlock()
+		return
+	}
+	select {
+	case <-g.full:
+	default:
+	}
+	g.mu.Unlock()
+
+	timer := time.NewTimer(g.window)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-g.full:
+	}
+}
+
+// commitBatch applies the items that can be applied in one write, makes
+// the write durable and reports to each caller. If the write or its sync
+// fails, every item that would have been part of it fails with that error.
+func (fs *FileStorage) commitBatch(batch []*batchItem) {
+	errs := make([]error, len(batch))
+	var err error
+	fail := func(e error) {
+		err = e
+		for i := range errs {
+			errs[i] = e
+		}
+	}
+
+	// A panic fails the batch instead of leaving its callers waiting.
+	defer func(start time.Time) {
+		if r := recover(); r != nil {
+			fail(fmt.Errorf("commit batch: panic: %v", r))
+		}
+		fs.observe(OpCommitBatch, start, err, slog.Int("size", len(batch)))
+		for i, item := range batch {
+			item.done <- errs[i]
+		}
+	}(time.Now())
+
+	if err := fs.lock(OpCommitBatch); err != nil {
+		fail(err)
+		return
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		fail(err)
+		return
+	}
+
+	items := make([][]posting, len(batch))
+	for i, item := range batch {
+		items[i] = item.postings
+	}
+
+	itemErrs, err := fs.applyBatchUnsafe(items, false, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := fs.syncDirsUnsafe(); err != nil {
+		fail(err)
+		return
+	}
+	copy(errs, itemErrs)
+}
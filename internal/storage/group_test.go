@@ -0,0 +1,183 @@
+package storage_test
+
+import (
+	"bank-app/internal/metrics"
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_GroupCommit(t *testing.T) {
+	dir := t.TempDir()
+	reg := metrics.NewRegistry()
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json")),
+		storage.WithMetrics(reg),
+		storage.WithGroupCommit(8, 20*time.Millisecond))
+
+	for _, id := range []string{"a", "b", "poor"} {
+		require.NoError(t, fs.SaveNewAccount(*model.NewAccount(id, "Anton", 0)))
+	}
+
+	const deposits = 16
+	var wg sync.WaitGroup
+	errs := make([]error, deposits+2)
+	for i := range deposits {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := []string{"a", "b"}[i%2]
+			errs[i] = fs.ApplyTransaction(id, 10, model.NewDepositTransaction(id, 10))
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[deposits] = fs.ApplyTransaction("poor", -1, model.NewWithdrawTransaction("poor", 1))
+	}()
+	go func() {
+		defer wg.Done()
+		out, in := model.NewTransferTransactions("poor", "a", 5)
+		errs[deposits+1] = fs.Transfer("poor", "a", 5, out, in)
+	}()
+	wg.Wait()
+
+	for i, err := range errs[:deposits] {
+		require.NoError(t, err, "deposit %d", i)
+	}
+	require.ErrorIs(t, errs[deposits], model.ErrInsufficientFunds)
+	require.ErrorIs(t, errs[deposits+1], model.ErrInsufficientFunds)
+
+	a, err := fs.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 80.0, a.Balance)
+	assert.Equal(t, int64(deposits/2), a.Version)
+
+	txs, err := fs.LoadTransactions()
+	require.NoError(t, err)
+	assert.Len(t, txs, deposits)
+	require.NoError(t, storage.VerifyChain(txs))
+
+	events, err := fs.PendingEvents(0)
+	require.NoError(t, err)
+	assert.Len(t, events, 3+deposits)
+
+	var buf bytes.Buffer
+	_, err = reg.WriteTo(&buf)
+	require.NoError(t, err)
+	m := regexp.MustCompile(`bank_storage_operation_duration_seconds_count\{op="commit_batch",outcome="success"\} (\d+)`).
+		FindStringSubmatch(buf.String())
+	require.NotNil(t, m)
+	batches, err := strconv.Atoi(m[1])
+	require.NoError(t, err)
+	assert.Less(t, batches, deposits+2, "concurrent writes share commits")
+	assert.GreaterOrEqual(t, batches, (deposits+2)/8, "no batch exceeds the limit")
+}
+
+func TestFileStorage_GroupCommitClosed(t *testing.T) {
+	dir := t.TempDir()
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithGroupCommit(4, 0))
+
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+	require.NoError(t, fs.Close())
+
+	err := fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1))
+	require.ErrorIs(t, err, storage.ErrClosed)
+}
+
+// TestFileStorage_GroupCommitUnderLoad checks that callers return while
+// others keep writing, rather than one of them committing for the rest.
+func TestFileStorage_GroupCommitUnderLoad(t *testing.T) {
+	dir := t.TempDir()
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithGroupCommit(4, time.Millisecond))
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				assert.NoError(t, fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := range 20 {
+		done := make(chan error, 1)
+		go func() { done <- fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)) }()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("deposit %d did not return under load", i)
+		}
+	}
+}
+
+// BenchmarkFileStorage_Deposits compares one commit per deposit with group
+// commit under concurrent load.
+func BenchmarkFileStorage_Deposits(b *testing.B) {
+	cases := []struct {
+		name string
+		opts []storage.FileOption
+	}{
+		{"single", nil},
+		{"group=32", []storage.FileOption{storage.WithGroupCommit(32, 0)}},
+		{"group=32/window=1ms", []storage.FileOption{storage.WithGroupCommit(32, time.Millisecond)}},
+	}
+
+	for _, bc := range cases {
+		b.Run(bc.name, func(b *testing.B) {
+			dir := b.TempDir()
+			fs := storage.NewFileStorage(
+				filepath.Join(dir, "accounts.json"),
+				filepath.Join(dir, "transactions.json"),
+				bc.opts...)
+			for i := range 16 {
+				require.NoError(b, fs.SaveNewAccount(*model.NewAccount(fmt.Sprintf("acc-%d", i), "owner", 0)))
+			}
+
+			b.SetParallelism(8)
+			b.ResetTimer()
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id := fmt.Sprintf("acc-%d", next.Add(1)%16)
+					if err := fs.ApplyTransaction(id, 1, model.NewDepositTransaction(id, 1)); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
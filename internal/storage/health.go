@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Ping checks that every data file that exists can be read and parsed. A
+// file that does not exist yet is fine: it is created on first write.
+func (fs *FileStorage) Ping() (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpPing, start, err)
+	}(time.Now())
+
+	if err := fs.lock(OpPing); err != nil {
+		return err
+	}
+	defer fs.unlock()
+
+	return fs.pingUnsafe()
+}
+
+// Ready is Ping plus a check that every data directory accepts writes.
+func (fs *FileStorage) Ready() (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpReady, start, err)
+	}(time.Now())
+
+	if err := fs.lock(OpReady); err != nil {
+		return err
+	}
+	defer fs.unlock()
+
+	if err := fs.pingUnsafe(); err != nil {
+		return err
+	}
+
+	for dir := range fs.dirs() {
+		if err := probeWrite(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fs *FileStorage) pingUnsafe() error {
+	if err := fs.recoverUnsafe(); err != nil {
+		return err
+	}
+
+	if _, err := fs.loadAccountsUnsafe(); err != nil {
+		return fmt.Errorf("accounts: %w", err)
+	}
+	if _, err := fs.loadTransactionsUnsafe(); err != nil {
+		return fmt.Errorf("transactions: %w", err)
+	}
+	if _, err := fs.loadOutboxUnsafe(); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+
+	return nil
+}
+
+// dirs returns the directories holding the data files.
+func (fs *FileStorage) dirs() map[string]bool {
+	dirs := map[string]bool{}
+	for _, path := range fs.paths() {
+		dirs[filepath.Dir(path)] = true
+	}
+
+	return dirs
+}
+
+func (fs *FileStorage) paths() []string {
+	paths := []string{fs.accountFilePath, fs.transactionFilePath}
+	if fs.outboxFilePath != "" {
+		paths = append(paths, fs.outboxFilePath)
+	}
+
+	return paths
+}
+
+func probeWrite(dir string) error {
+	f, err := os.CreateTemp(dir, ".probe*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write([]byte("ok")); err != nil {
+		f.Close()
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+
+	return nil
+}
+
+type FileState struct {
+	Path    string    `json:"path"`
+	Exists  bool      `json:"exists"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+}
+
+// State is a point-in-time report on the data files for diagnostics.
+type State struct {
+	Files             []FileState `json:"files"`
+	Accounts          int         `json:"accounts"`
+	Transactions      int         `json:"transactions"`
+	PendingEvents     int         `json:"pending_events"`
+	LastTransactionAt time.Time   `json:"last_transaction_at,omitzero"`
+	ChainVerified     bool        `json:"chain_verified"`
+	ChainError        string      `json:"chain_error,omitempty"`
+}
+
+// State reads every data file once under the lock, so the counts agree
+// with each other. A broken hash chain is reported in the result rather
+// than returned as an error.
+func (fs *FileStorage) State() (_ State, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpState, start, err)
+	}(time.Now())
+
+	if err := fs.lock(OpState); err != nil {
+		return State{}, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return State{}, err
+	}
+
+	state := State{Files: []FileState{}}
+	for _, path := range fs.paths() {
+		file := FileState{Path: path}
+
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return State{}, fmt.Errorf("stat %s: %w", path, err)
+		default:
+			file.Exists = true
+			file.Size = info.Size()
+			file.ModTime = info.ModTime().UTC()
+		}
+		state.Files = append(state.Files, file)
+	}
+
+	accounts, err := fs.loadAccountsUnsafe()
+	if err != nil {
+		return State{}, err
+	}
+	txs, err := fs.loadTransactionsUnsafe()
+	if err != nil {
+		return State{}, err
+	}
+	outbox, err := fs.loadOutboxUnsafe()
+	if err != nil {
+		return State{}, err
+	}
+
+	state.Accounts = len(accounts)
+	state.Transactions = len(txs)
+	state.PendingEvents = len(outbox.Events)
+	if len(txs) > 0 {
+		state.LastTransactionAt = txs[len(txs)-1].CreatedAt
+	}
+
+	if err := VerifyChain(txs); err != nil {
+		state.ChainError = err.Error()
+	} else {
+		state.ChainVerified = true
+	}
+
+	return state, nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Operation names used in logs, metrics and fault injection.
+const (
+	OpSaveAccount       = "save_account"
+	OpLoadAccount       = "load_account"
+	OpLoadAccounts      = "load_accounts"
+	OpApplyTransaction  = "apply_transaction"
+	OpTransfer          = "transfer"
+	OpCommitBatch       = "commit_batch"
+	OpApplyBatch        = "apply_batch"
+	OpUpdateStatus      = "update_status"
+	OpLoadTransactions  = "load_transactions"
+	OpQueryTransactions = "query_transactions"
+	OpBalanceAt         = "balance_at"
+	OpPendingEvents     = "pending_events"
+	OpMarkDispatched    = "mark_dispatched"
+	OpPing              = "ping"
+	OpReady             = "ready"
+	OpState             = "state"
+	OpClose             = "close"
+	OpUpgrade           = "upgrade"
+	OpBackup            = "backup"
+	OpRestore           = "restore"
+)
+
+// WithLogger logs every storage operation at debug level, and failures at
+// warn or error depending on their class.
+func WithLogger(logger *slog.Logger) FileOption {
+	return func(fs *FileStorage) {
+		fs.logger = logger
+	}
+}
+
+// ErrorClass sorts err into a coarse, stable class for logs and metrics.
+// It returns an empty string for a nil error.
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrAlreadyExists), errors.Is(err, ErrConcurrentModification):
+		return "conflict"
+	case errors.Is(err, model.ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, model.ErrInvalidAmount), errors.Is(err, model.ErrInvalidStatus),
+		errors.Is(err, ErrInvalidQuery):
+		return "validation"
+	case errors.Is(err, model.ErrAccountFrozen), errors.Is(err, model.ErrAccountClosed),
+		errors.Is(err, model.ErrNonZeroBalance):
+		return "account_state"
+	case errors.Is(err, ErrBatchRejected):
+		return "rejected"
+	case errors.Is(err, ErrClosed):
+		return "unavailable"
+	case errors.Is(err, ErrChainBroken), errors.Is(err, ErrCorruptLog),
+		errors.Is(err, ErrUnsupportedVersion), errors.Is(err, ErrInvalidBackup):
+		return "integrity"
+	default:
+		return "internal"
+	}
+}
+
+func (fs *FileStorage) observe(op string, start time.Time, err error, attrs ...slog.Attr) {
+	latency := time.Since(start)
+	if fs.metrics != nil {
+		fs.metrics.latency.Observe(latency.Seconds(), op, outcome(err))
+	}
+
+	attrs = append(attrs, slog.Duration("latency", latency))
+
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+		if ErrorClass(err) == "internal" {
+			level = slog.LevelError
+		}
+		attrs = append(attrs, slog.String("error_class", ErrorClass(err)), slog.Any("error", err))
+	}
+
+	fs.logger.LogAttrs(context.Background(), level, "storage "+op, attrs...)
+}
@@ -0,0 +1,521 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryStripes is the number of account locks. Accounts that hash to the
+// same stripe share a lock, which costs some parallelism and nothing else.
+const memoryStripes = 64
+
+// MemoryStorage keeps everything in memory. It behaves like FileStorage,
+// hash chain and outbox included, which makes it a drop-in backend for
+// tests and for embedding. Faults can be injected to exercise error paths.
+//
+// Unlike FileStorage, which rewrites whole files and so serializes every
+// write, it locks accounts individually: operations on unrelated accounts
+// only meet briefly when they append to the log.
+type MemoryStorage struct {
+	// Locks are taken in this order: the stripes of the accounts involved,
+	// lowest index first, then logMu, then mu. mu is never held while
+	// waiting for another lock.
+	stripes [memoryStripes]sync.Mutex
+
+	logMu  sync.Mutex
+	index  *txIndex
+	outbox outboxFile
+	heads  map[string]string
+
+	// mu guards the account index and the test hooks. The accounts it
+	// points to are guarded by their stripes.
+	mu       sync.Mutex
+	accounts map[string]*model.Account
+	order    []string
+	closed   bool
+
+	faults  []fault
+	latency time.Duration
+	hook    func(op string)
+	calls   map[string]int
+}
+
+var (
+	_ Storage = (*MemoryStorage)(nil)
+	_ Outbox  = (*MemoryStorage)(nil)
+)
+
+type fault struct {
+	ops       map[string]bool
+	remaining int
+	err       error
+}
+
+func NewMemoryStorage(accounts ...model.Account) *MemoryStorage {
+	m := &MemoryStorage{
+		index:    newTxIndex(),
+		outbox:   outboxFile{Events: []model.Event{}},
+		heads:    make(map[string]string),
+		accounts: make(map[string]*model.Account, len(accounts)),
+		calls:    make(map[string]int),
+	}
+	for _, acc := range accounts {
+		m.accounts[acc.ID] = &acc
+		m.order = append(m.order, acc.ID)
+	}
+
+	return m
+}
+
+// FailNext makes the next n calls of the given operations fail with err
+// before they touch any data. Without ops every operation is affected.
+func (m *MemoryStorage) FailNext(n int, err error, ops ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := fault{remaining: n, err: err}
+	if len(ops) > 0 {
+		f.ops = make(map[string]bool, len(ops))
+		for _, op := range ops {
+			f.ops[op] = true
+		}
+	}
+	m.faults = append(m.faults, f)
+}
+
+// SetLatency delays every later call by d while it holds the locks of the
+// data it works on, as a slow disk would.
+func (m *MemoryStorage) SetLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.latency = d
+}
+
+// SetHook makes every later call run fn with its operation name while it
+// holds the locks of the data it works on, after the latency. Tests use it
+// to stop calls at a known point.
+func (m *MemoryStorage) SetHook(fn func(op string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hook = fn
+}
+
+// Calls reports how many times op was called, failed calls included.
+func (m *MemoryStorage) Calls(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.calls[op]
+}
+
+// begin counts the call, waits out the latency, runs the hook and returns
+// the injected fault, if any. Callers hold the locks op needs.
+func (m *MemoryStorage) begin(op string) error {
+	latency, hook, err := m.admit(op)
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if hook != nil {
+		hook(op)
+	}
+
+	return err
+}
+
+func (m *MemoryStorage) admit(op string) (time.Duration, func(string), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls[op]++
+	if m.closed {
+		return m.latency, m.hook, ErrClosed
+	}
+
+	for i := range m.faults {
+		f := &m.faults[i]
+		if f.remaining <= 0 || (f.ops != nil && !f.ops[op]) {
+			continue
+		}
+
+		err := f.err
+		f.remaining--
+		if f.remaining == 0 {
+			m.faults = slices.Delete(m.faults, i, i+1)
+		}
+		return m.latency, m.hook, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return m.latency, m.hook, nil
+}
+
+// lockAccounts takes the stripes of ids in ascending order, so that two
+// operations on overlapping accounts can never wait on each other.
+func (m *MemoryStorage) lockAccounts(ids ...string) (unlock func()) {
+	stripes := make([]int, 0, len(ids))
+	for _, id := range ids {
+		h := fnv.New32a()
+		h.Write([]byte(id))
+		stripes = append(stripes, int(h.Sum32()%memoryStripes))
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, i := range stripes {
+		m.stripes[i].Lock()
+	}
+
+	return func() {
+		for _, i := range stripes {
+			m.stripes[i].Unlock()
+		}
+	}
+}
+
+func (m *MemoryStorage) lockAllAccounts() (unlock func()) {
+	for i := range m.stripes {
+		m.stripes[i].Lock()
+	}
+
+	return func() {
+		for i := range m.stripes {
+			m.stripes[i].Unlock()
+		}
+	}
+}
+
+// lookup returns the stored account; the caller must hold its stripe.
+func (m *MemoryStorage) lookup(accountID string) *model.Account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.accounts[accountID]
+}
+
+func (m *MemoryStorage) SaveNewAccount(acc model.Account) error {
+	unlock := m.lockAccounts(acc.ID)
+	defer unlock()
+
+	if err := m.begin(OpSaveAccount); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if _, ok := m.accounts[acc.ID]; ok {
+		m.mu.Unlock()
+		return fmt.Errorf("account with ID %s %w", acc.ID, ErrAlreadyExists)
+	}
+	m.accounts[acc.ID] = &acc
+	m.order = append(m.order, acc.ID)
+	m.mu.Unlock()
+
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	m.outbox.append(model.NewAccountOpenedEvent(acc))
+	return nil
+}
+
+func (m *MemoryStorage) LoadAccount(accountID string) (*model.Account, error) {
+	unlock := m.lockAccounts(accountID)
+	defer unlock()
+
+	if err := m.begin(OpLoadAccount); err != nil {
+		return nil, err
+	}
+
+	acc := m.lookup(accountID)
+	if acc == nil {
+		return nil, fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+
+	copied := *acc
+	return &copied, nil
+}
+
+func (m *MemoryStorage) LoadAccounts() ([]model.Account, error) {
+	unlock := m.lockAllAccounts()
+	defer unlock()
+
+	if err := m.begin(OpLoadAccounts); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accounts := make([]model.Account, 0, len(m.order))
+	for _, id := range m.order {
+		accounts = append(accounts, *m.accounts[id])
+	}
+	return accounts, nil
+}
+
+func (m *MemoryStorage) ApplyTransaction(accountID string, amount float64, tx model.Transaction) error {
+	return m.apply(posting{accountID: accountID, amount: amount, tx: tx})
+}
+
+func (m *MemoryStorage) CompareAndApply(
+	accountID string, version int64, amount float64, tx model.Transaction) error {
+	return m.apply(posting{accountID: accountID, amount: amount, tx: tx, checkVersion: true, version: version})
+}
+
+func (m *MemoryStorage) apply(p posting) error {
+	if p.accountID == "" {
+		return fmt.Errorf("empty ID field")
+	}
+
+	unlock := m.lockAccounts(p.accountID)
+	defer unlock()
+
+	if err := m.begin(OpApplyTransaction); err != nil {
+		return err
+	}
+
+	return m.applyPostingsUnsafe([]posting{p})
+}
+
+func (m *MemoryStorage) Transfer(fromID, toID string, amount float64, out, in model.Transaction) error {
+	return m.transfer(
+		posting{accountID: fromID, amount: -amount, tx: out},
+		posting{accountID: toID, amount: amount, tx: in})
+}
+
+func (m *MemoryStorage) CompareAndTransfer(fromID, toID string, fromVersion, toVersion int64,
+	amount float64, out, in model.Transaction) error {
+	return m.transfer(
+		posting{accountID: fromID, amount: -amount, tx: out, checkVersion: true, version: fromVersion},
+		posting{accountID: toID, amount: amount, tx: in, checkVersion: true, version: toVersion})
+}
+
+func (m *MemoryStorage) transfer(from, to posting) error {
+	if err := validateTransfer(from, to); err != nil {
+		return err
+	}
+
+	unlock := m.lockAccounts(from.accountID, to.accountID)
+	defer unlock()
+
+	if err := m.begin(OpTransfer); err != nil {
+		return err
+	}
+
+	return m.applyPostingsUnsafe([]posting{from, to})
+}
+
+// applyPostingsUnsafe works on copies and stores them only when every
+// posting succeeded, so a failure leaves no trace. The caller must hold the
+// stripes of every account involved.
+func (m *MemoryStorage) applyPostingsUnsafe(postings []posting) error {
+	stored := make(map[string]*model.Account, len(postings))
+	updated := make(map[string]*model.Account, len(postings))
+	if err := m.stageUnsafe(stored, updated, postings); err != nil {
+		return err
+	}
+
+	return m.appendUnsafe(postings, stored, updated)
+}
+
+// stageUnsafe applies postings to copies of their accounts kept in updated,
+// remembering the stored originals in stored. If a posting fails, updated
+// is left as it was.
+func (m *MemoryStorage) stageUnsafe(stored, updated map[string]*model.Account, postings []posting) error {
+	staged := make(map[string]model.Account, len(postings))
+	for _, p := range postings {
+		acc, ok := staged[p.accountID]
+		if !ok {
+			if u, ok := updated[p.accountID]; ok {
+				acc = *u
+			} else {
+				current := m.lookup(p.accountID)
+				if current == nil {
+					return fmt.Errorf("account %s %w", p.accountID, ErrNotFound)
+				}
+				stored[p.accountID] = current
+				acc = *current
+			}
+		}
+		if err := p.check(&acc); err != nil {
+			return err
+		}
+		if err := acc.Apply(p.amount); err != nil {
+			return err
+		}
+		staged[p.accountID] = acc
+	}
+
+	for id, acc := range staged {
+		updated[id] = &acc
+	}
+	return nil
+}
+
+// appendUnsafe seals the transactions of postings, stores the updated
+// accounts and only then puts the transactions on the log and queues their
+// events, all under logMu: a reader that sees a transaction also sees the
+// balance it produced.
+func (m *MemoryStorage) appendUnsafe(postings []posting, stored, updated map[string]*model.Account) error {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	prevHash := ""
+	if n := len(m.index.txs); n > 0 {
+		prevHash = m.index.txs[n-1].Hash
+	}
+
+	sealed := make([]model.Transaction, 0, len(postings))
+	heads := make(map[string]string, len(postings))
+	for _, p := range postings {
+		tx := p.tx
+		accountPrevHash, ok := heads[tx.AccountID]
+		if !ok {
+			accountPrevHash = m.heads[tx.AccountID]
+		}
+		if err := sealAfter(&tx, prevHash, accountPrevHash); err != nil {
+			return err
+		}
+		prevHash, heads[tx.AccountID] = tx.Hash, tx.Hash
+		sealed = append(sealed, tx)
+	}
+
+	for id, acc := range updated {
+		*stored[id] = *acc
+	}
+	for _, tx := range sealed {
+		m.index.add(tx)
+		m.heads[tx.AccountID] = tx.Hash
+		m.outbox.append(model.NewTransactionEvent(tx))
+	}
+	return nil
+}
+
+func (m *MemoryStorage) LoadTransactions() ([]model.Transaction, error) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	if err := m.begin(OpLoadTransactions); err != nil {
+		return nil, err
+	}
+
+	txs := slices.Clone(m.index.txs)
+	if txs == nil {
+		txs = []model.Transaction{}
+	}
+	return txs, nil
+}
+
+func (m *MemoryStorage) UpdateAccountStatus(accountID string, status model.AccountStatus) error {
+	unlock := m.lockAccounts(accountID)
+	defer unlock()
+
+	if err := m.begin(OpUpdateStatus); err != nil {
+		return err
+	}
+
+	acc := m.lookup(accountID)
+	if acc == nil {
+		return fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+
+	updated := *acc
+	if err := updated.SetStatus(status); err != nil {
+		return err
+	}
+
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	*acc = updated
+	m.outbox.append(model.NewAccountStatusEvent(updated))
+	return nil
+}
+
+func (m *MemoryStorage) PendingEvents(limit int) ([]model.Event, error) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	if err := m.begin(OpPendingEvents); err != nil {
+		return nil, err
+	}
+
+	events := slices.Clone(m.outbox.Events)
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (m *MemoryStorage) MarkDispatched(eventIDs ...string) error {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	if err := m.begin(OpMarkDispatched); err != nil {
+		return err
+	}
+
+	m.outbox.Events = slices.DeleteFunc(m.outbox.Events, func(e model.Event) bool {
+		return slices.Contains(eventIDs, e.ID)
+	})
+	return nil
+}
+
+func (m *MemoryStorage) Verify() error {
+	txs, err := m.LoadTransactions()
+	if err != nil {
+		return err
+	}
+
+	return VerifyChain(txs)
+}
+
+func (m *MemoryStorage) Ping() error {
+	return m.begin(OpPing)
+}
+
+func (m *MemoryStorage) Ready() error {
+	return m.begin(OpReady)
+}
+
+func (m *MemoryStorage) State() (State, error) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	if err := m.begin(OpState); err != nil {
+		return State{}, err
+	}
+
+	m.mu.Lock()
+	accounts := len(m.accounts)
+	m.mu.Unlock()
+
+	state := State{
+		Files:         []FileState{},
+		Accounts:      accounts,
+		Transactions:  len(m.index.txs),
+		PendingEvents: len(m.outbox.Events),
+	}
+	if len(m.index.txs) > 0 {
+		state.LastTransactionAt = m.index.txs[len(m.index.txs)-1].CreatedAt
+	}
+	if err := VerifyChain(m.index.txs); err != nil {
+		state.ChainError = err.Error()
+	} else {
+		state.ChainVerified = true
+	}
+
+	return state, nil
+}
+
+func (m *MemoryStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls[OpClose]++
+	m.closed = true
+	return nil
+}
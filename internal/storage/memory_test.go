@@ -0,0 +1,278 @@
+package storage_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_Operations(t *testing.T) {
+	ms := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "Anton", Balance: 100})
+
+	require.NoError(t, ms.SaveNewAccount(*model.NewAccount("b", "Stas", 0)))
+	require.ErrorIs(t, ms.SaveNewAccount(*model.NewAccount("b", "Stas", 0)), storage.ErrAlreadyExists)
+
+	require.NoError(t, ms.ApplyTransaction("a", -30, model.NewWithdrawTransaction("a", 30)))
+	require.ErrorIs(t, ms.ApplyTransaction("b", -1, model.NewWithdrawTransaction("b", 1)), model.ErrInsufficientFunds)
+
+	out, in := model.NewTransferTransactions("a", "b", 20)
+	require.NoError(t, ms.Transfer("a", "b", 20, out, in))
+
+	_, err := ms.LoadAccount("missing")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	assert.EqualError(t, err, "account missing not found")
+
+	a, err := ms.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, a.Balance)
+
+	a.Balance = 1e6
+	again, err := ms.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, again.Balance, "callers get copies")
+
+	txs, err := ms.LoadTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 3)
+	require.NoError(t, ms.Verify())
+
+	require.NoError(t, ms.UpdateAccountStatus("b", model.StatusFrozen))
+	out, in = model.NewTransferTransactions("a", "b", 1)
+	require.ErrorIs(t, ms.Transfer("a", "b", 1, out, in), model.ErrAccountFrozen)
+
+	a, err = ms.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, a.Balance, "a failed transfer changes nothing")
+
+	events, err := ms.PendingEvents(0)
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+	assert.Equal(t, int64(1), events[0].Seq)
+	assert.Equal(t, model.AccountOpened, events[0].Type)
+
+	require.NoError(t, ms.MarkDispatched(events[0].ID, events[1].ID))
+	events, err = ms.PendingEvents(0)
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+}
+
+func TestMemoryStorage_FailNext(t *testing.T) {
+	errDisk := errors.New("disk on fire")
+	ms := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "Anton", Balance: 100})
+
+	ms.FailNext(2, errDisk, storage.OpApplyTransaction)
+
+	_, err := ms.LoadAccount("a")
+	require.NoError(t, err, "other operations are not affected")
+
+	for range 2 {
+		err := ms.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10))
+		require.ErrorIs(t, err, errDisk)
+	}
+	require.NoError(t, ms.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+
+	assert.Equal(t, 3, ms.Calls(storage.OpApplyTransaction))
+
+	acc, err := ms.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, 110.0, acc.Balance)
+
+	ms.FailNext(1, errDisk)
+	_, err = ms.LoadTransactions()
+	require.ErrorIs(t, err, errDisk)
+	_, err = ms.LoadTransactions()
+	require.NoError(t, err)
+}
+
+func TestMemoryStorage_Latency(t *testing.T) {
+	ms := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "Anton"})
+	ms.SetLatency(20 * time.Millisecond)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = ms.LoadAccount("a")
+		}()
+	}
+	wg.Wait()
+
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond, "latency is paid under the lock")
+}
+
+func TestMemoryStorage_UnrelatedAccountsInParallel(t *testing.T) {
+	ids := []string{"a", "b", "c"}
+	ms := storage.NewMemoryStorage()
+	for _, id := range ids {
+		require.NoError(t, ms.SaveNewAccount(*model.NewAccount(id, "Anton", 0)))
+	}
+
+	// Every deposit waits under its account lock until all of them got
+	// there, which they only can if none waits for another's lock.
+	var arrived sync.WaitGroup
+	arrived.Add(len(ids))
+	all := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(all)
+	}()
+	ms.SetHook(func(op string) {
+		if op != storage.OpApplyTransaction {
+			return
+		}
+		arrived.Done()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+			t.Error("unrelated accounts wait for each other")
+		}
+	})
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, ms.ApplyTransaction(id, 1, model.NewDepositTransaction(id, 1)))
+		}()
+	}
+	wg.Wait()
+
+	ms.SetHook(nil)
+	require.NoError(t, ms.Verify())
+}
+
+func TestMemoryStorage_OpposingTransfers(t *testing.T) {
+	ms := storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "Anton", Balance: 1000},
+		model.Account{ID: "b", Owner: "Stas", Balance: 1000})
+
+	var wg sync.WaitGroup
+	for _, pair := range [][2]string{{"a", "b"}, {"b", "a"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				out, in := model.NewTransferTransactions(pair[0], pair[1], 1)
+				assert.NoError(t, ms.Transfer(pair[0], pair[1], 1, out, in))
+			}
+		}()
+	}
+	wg.Wait()
+
+	accounts, err := ms.LoadAccounts()
+	require.NoError(t, err)
+	assert.Equal(t, 2000.0, accounts[0].Balance+accounts[1].Balance)
+	require.NoError(t, ms.Verify())
+}
+
+func TestMemoryStorage_Close(t *testing.T) {
+	ms := storage.NewMemoryStorage(model.Account{ID: "a", Owner: "Anton"})
+	require.NoError(t, ms.Close())
+
+	_, err := ms.LoadAccount("a")
+	require.ErrorIs(t, err, storage.ErrClosed)
+	require.ErrorIs(t, ms.Ready(), storage.ErrClosed)
+}
+
+// BenchmarkMemoryStorage runs deposits and transfers from many goroutines
+// over pools of accounts of different sizes. With one account every call
+// contends; with many, calls mostly run in parallel. The latency cases
+// stand for work done under the account lock, where striping pays off
+// the most. The lock=single runs put every call behind one mutex, as a
+// storage with a single lock would, for a baseline.
+func BenchmarkMemoryStorage(b *testing.B) {
+	cases := []struct {
+		name     string
+		accounts int
+		latency  time.Duration
+	}{
+		{"accounts=1", 1, 0},
+		{"accounts=16", 16, 0},
+		{"accounts=1024", 1024, 0},
+		{"accounts=1/latency=20us", 1, 20 * time.Microsecond},
+		{"accounts=16/latency=20us", 16, 20 * time.Microsecond},
+		{"accounts=1024/latency=20us", 1024, 20 * time.Microsecond},
+	}
+
+	for _, bc := range cases {
+		ids := make([]string, bc.accounts)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("acc-%d", i)
+		}
+		setup := func(b *testing.B) *storage.MemoryStorage {
+			ms := storage.NewMemoryStorage()
+			for _, id := range ids {
+				require.NoError(b, ms.SaveNewAccount(*model.NewAccount(id, "owner", 0)))
+				require.NoError(b, ms.ApplyTransaction(id, 1e9, model.NewDepositTransaction(id, 1e9)))
+			}
+			ms.SetLatency(bc.latency)
+			return ms
+		}
+
+		for _, lock := range []string{"striped", "single"} {
+			// serialize stands in for the one lock of the baseline.
+			var single sync.Mutex
+			serialize := func(fn func() error) error {
+				if lock == "single" {
+					single.Lock()
+					defer single.Unlock()
+				}
+				return fn()
+			}
+
+			b.Run("Deposit/"+bc.name+"/lock="+lock, func(b *testing.B) {
+				ms := setup(b)
+				b.SetParallelism(8)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rng := rand.New(rand.NewPCG(rand.Uint64(), 0))
+					for pb.Next() {
+						id := ids[rng.IntN(len(ids))]
+						err := serialize(func() error {
+							return ms.ApplyTransaction(id, 1, model.NewDepositTransaction(id, 1))
+						})
+						if err != nil {
+							b.Error(err)
+						}
+					}
+				})
+			})
+
+			if bc.accounts < 2 {
+				continue
+			}
+			b.Run("Transfer/"+bc.name+"/lock="+lock, func(b *testing.B) {
+				ms := setup(b)
+				b.SetParallelism(8)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rng := rand.New(rand.NewPCG(rand.Uint64(), 0))
+					for pb.Next() {
+						from, to := rng.IntN(len(ids)), rng.IntN(len(ids)-1)
+						if to >= from {
+							to++
+						}
+						out, in := model.NewTransferTransactions(ids[from], ids[to], 1)
+						err := serialize(func() error {
+							return ms.Transfer(ids[from], ids[to], 1, out, in)
+						})
+						if err != nil {
+							b.Error(err)
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bank-app/internal/metrics"
+	"bank-app/internal/model"
+	"time"
+)
+
+// MeteredStorage wraps any Storage to time the calls made through it and to
+// keep gauges of the number of accounts and their total balance. The gauges
+// start from the accounts the wrapped storage holds and follow the writes
+// made through MeteredStorage, so a scrape reads no data. Changes made
+// around it, such as a restore, show after a restart.
+type MeteredStorage struct {
+	Storage
+
+	latency  *metrics.Histogram
+	accounts *metrics.Gauge
+	balance  *metrics.Gauge
+}
+
+// accountLister is implemented by every backend in this package.
+type accountLister interface {
+	LoadAccounts() ([]model.Account, error)
+}
+
+// NewMeteredStorage registers the storage metrics in reg and wraps s.
+func NewMeteredStorage(s Storage, reg *metrics.Registry) (*MeteredStorage, error) {
+	m := &MeteredStorage{
+		Storage: s,
+		latency: reg.Histogram("bank_storage_call_duration_seconds",
+			"Time callers spend in storage calls, waits for a shared commit included.",
+			nil, "op", "outcome"),
+		accounts: reg.Gauge("bank_accounts", "Number of accounts."),
+		balance:  reg.Gauge("bank_balance_total", "Sum of all account balances."),
+	}
+
+	if lister, ok := s.(accountLister); ok {
+		accounts, err := lister.LoadAccounts()
+		if err != nil {
+			return nil, err
+		}
+
+		total := 0.0
+		for _, acc := range accounts {
+			total += acc.Balance
+		}
+		m.accounts.Set(float64(len(accounts)))
+		m.balance.Set(total)
+	}
+
+	return m, nil
+}
+
+func (m *MeteredStorage) observe(op string, start time.Time, err error) {
+	m.latency.Observe(time.Since(start).Seconds(), op, outcome(err))
+}
+
+func (m *MeteredStorage) SaveNewAccount(account model.Account) (err error) {
+	defer func(start time.Time) {
+		m.observe(OpSaveAccount, start, err)
+	}(time.Now())
+
+	if err = m.Storage.SaveNewAccount(account); err == nil {
+		m.accounts.Add(1)
+		m.balance.Add(account.Balance)
+	}
+	return err
+}
+
+func (m *MeteredStorage) LoadAccount(accountID string) (acc *model.Account, err error) {
+	defer func(start time.Time) {
+		m.observe(OpLoadAccount, start, err)
+	}(time.Now())
+
+	return m.Storage.LoadAccount(accountID)
+}
+
+func (m *MeteredStorage) ApplyTransaction(accountID string, amount float64, tx model.Transaction) (err error) {
+	defer func(start time.Time) {
+		m.observe(OpApplyTransaction, start, err)
+	}(time.Now())
+
+	if err = m.Storage.ApplyTransaction(accountID, amount, tx); err == nil {
+		m.balance.Add(amount)
+	}
+	return err
+}
+
+func (m *MeteredStorage) CompareAndApply(
+	accountID string, version int64, amount float64, tx model.Transaction,
+) (err error) {
+	defer func(start time.Time) {
+		m.observe(OpApplyTransaction, start, err)
+	}(time.Now())
+
+	if err = m.Storage.CompareAndApply(accountID, version, amount, tx); err == nil {
+		m.balance.Add(amount)
+	}
+	return err
+}
+
+func (m *MeteredStorage) LoadTransactions() (txs []model.Transaction, err error) {
+	defer func(start time.Time) {
+		m.observe(OpLoadTransactions, start, err)
+	}(time.Now())
+
+	return m.Storage.LoadTransactions()
+}
+
+func (m *MeteredStorage) UpdateAccountStatus(accountID string, status model.AccountStatus) (err error) {
+	defer func(start time.Time) {
+		m.observe(OpUpdateStatus, start, err)
+	}(time.Now())
+
+	return m.Storage.UpdateAccountStatus(accountID, status)
+}
+
+// Transfer and CompareAndTransfer move money between accounts and leave
+// the total balance as it was.
+func (m *MeteredStorage) Transfer(fromID, toID string, amount float64, out, in model.Transaction) (err error) {
+	defer func(start time.Time) {
+		m.observe(OpTransfer, start, err)
+	}(time.Now())
+
+	return m.Storage.Transfer(fromID, toID, amount, out, in)
+}
+
+func (m *MeteredStorage) CompareAndTransfer(fromID, toID string, fromVersion, toVersion int64,
+	amount float64, out, in model.Transaction,
+) (err error) {
+	defer func(start time.Time) {
+		m.observe(OpTransfer, start, err)
+	}(time.Now())
+
+	return m.Storage.CompareAndTransfer(fromID, toID, fromVersion, toVersion, amount, out, in)
+}
+
+func (m *MeteredStorage) ApplyBatch(batch Batch) (errs []error, err error) {
+	defer func(start time.Time) {
+		m.observe(OpApplyBatch, start, err)
+	}(time.Now())
+
+	if errs, err = m.Storage.ApplyBatch(batch); err != nil {
+		return errs, err
+	}
+
+	for i, item := range batch.Items {
+		if i < len(errs) && errs[i] != nil {
+			continue
+		}
+		for _, p := range item {
+			m.balance.Add(p.Amount)
+		}
+	}
+	return errs, nil
+}
+
+func (m *MeteredStorage) QueryTransactions(q TransactionQuery) (page TransactionPage, err error) {
+	defer func(start time.Time) {
+		m.observe(OpQueryTransactions, start, err)
+	}(time.Now())
+
+	return m.Storage.QueryTransactions(q)
+}
+
+func (m *MeteredStorage) BalanceAt(accountID string, at time.Time) (balance float64, err error) {
+	defer func(start time.Time) {
+		m.observe(OpBalanceAt, start, err)
+	}(time.Now())
+
+	return m.Storage.BalanceAt(accountID, at)
+}
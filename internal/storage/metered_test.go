@@ -0,0 +1,61 @@
+package storage_test
+
+import (
+	"bank-app/internal/metrics"
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage counts the full reads of the accounts.
+type countingStorage struct {
+	*storage.MemoryStorage
+	loads int
+}
+
+func (c *countingStorage) LoadAccounts() ([]model.Account, error) {
+	c.loads++
+	return c.MemoryStorage.LoadAccounts()
+}
+
+func TestMeteredStorage(t *testing.T) {
+	reg := metrics.NewRegistry()
+	inner := &countingStorage{MemoryStorage: storage.NewMemoryStorage(
+		model.Account{ID: "a", Owner: "Anton", Balance: 50, Status: model.StatusActive})}
+
+	ms, err := storage.NewMeteredStorage(inner, reg)
+	require.NoError(t, err)
+
+	scrape := func() string {
+		var buf bytes.Buffer
+		_, err := reg.WriteTo(&buf)
+		require.NoError(t, err)
+		return buf.String()
+	}
+	assert.Contains(t, scrape(), "bank_accounts 1\n")
+	assert.Contains(t, scrape(), "bank_balance_total 50\n")
+
+	require.NoError(t, ms.SaveNewAccount(*model.NewAccount("b", "Stas", 10)))
+	require.NoError(t, ms.ApplyTransaction("a", 100, model.NewDepositTransaction("a", 100)))
+	require.Error(t, ms.ApplyTransaction("b", -500, model.NewWithdrawTransaction("b", 500)))
+	require.NoError(t, ms.Transfer("a", "b", 20,
+		model.NewWithdrawTransaction("a", 20), model.NewDepositTransaction("b", 20)))
+
+	errs, err := ms.ApplyBatch(storage.Batch{Items: [][]storage.Posting{
+		{{AccountID: "a", Amount: 5, Transaction: model.NewDepositTransaction("a", 5)}},
+		{{AccountID: "b", Amount: -1000, Transaction: model.NewWithdrawTransaction("b", 1000)}},
+	}})
+	require.NoError(t, err)
+	require.Error(t, errs[1])
+
+	out := scrape()
+	assert.Contains(t, out, "bank_accounts 2\n")
+	assert.Contains(t, out, "bank_balance_total 165\n", "only the writes that succeeded count")
+	assert.Contains(t, out, `bank_storage_call_duration_seconds_count{op="apply_transaction",outcome="success"} 1`)
+	assert.Contains(t, out, `bank_storage_call_duration_seconds_count{op="apply_transaction",outcome="failure"} 1`)
+	assert.Equal(t, 1, inner.loads, "scrapes read no accounts")
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bank-app/internal/metrics"
+	"log/slog"
+	"time"
+)
+
+type storageMetrics struct {
+	latency  *metrics.Histogram
+	lockWait *metrics.Histogram
+}
+
+// WithMetrics records operation latency and the time spent waiting for the
+// storage lock. Account gauges come from NewMeteredStorage, which works
+// with every backend.
+func WithMetrics(reg *metrics.Registry) FileOption {
+	return func(fs *FileStorage) {
+		fs.metrics = &storageMetrics{
+			latency: reg.Histogram("bank_storage_operation_duration_seconds",
+				"Time spent in storage operations.", nil, "op", "outcome"),
+			lockWait: reg.Histogram("bank_storage_lock_wait_seconds",
+				"Time spent waiting for the storage lock.",
+				metrics.ExponentialBuckets(0.00001, 4, 10), "op"),
+		}
+	}
+}
+
+// lock takes fs.mu and then the lock shared with other processes,
+// recording how long op waited for both.
+func (fs *FileStorage) lock(op string) error {
+	start := time.Now()
+	fs.mu.Lock()
+
+	if err := acquire(fs.procLock, fs.lockTimeout); err != nil {
+		fs.mu.Unlock()
+		return err
+	}
+
+	if fs.metrics != nil {
+		fs.metrics.lockWait.Observe(time.Since(start).Seconds(), op)
+	}
+	return nil
+}
+
+// unlock releases what lock took. After Close it also lets go of the lock
+// file itself.
+func (fs *FileStorage) unlock() {
+	if err := fs.procLock.unlock(); err != nil {
+		fs.logger.Error("release storage lock failed", slog.Any("error", err))
+	}
+	if fs.closed {
+		if err := fs.procLock.close(); err != nil {
+			fs.logger.Error("close storage lock failed", slog.Any("error", err))
+		}
+	}
+
+	fs.mu.Unlock()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,91 @@
+package storage_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	helperDirEnv      = "BANK_STORAGE_HELPER_DIR"
+	helperDepositsEnv = "BANK_STORAGE_HELPER_DEPOSITS"
+)
+
+// TestHelperDepositor is not a real test: TestFileStorage_MultiProcess runs
+// the test binary again with only this test selected, once per writer.
+func TestHelperDepositor(t *testing.T) {
+	dir := os.Getenv(helperDirEnv)
+	if dir == "" {
+		t.Skip("helper process only")
+	}
+	n, err := strconv.Atoi(os.Getenv(helperDepositsEnv))
+	require.NoError(t, err)
+
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json")))
+
+	for range n {
+		require.NoError(t, fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+	}
+}
+
+func TestFileStorage_MultiProcess(t *testing.T) {
+	if testing.Short() {
+		t.Skip("spawns processes")
+	}
+
+	const (
+		writers  = 4
+		deposits = 25
+	)
+
+	dir := t.TempDir()
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json")))
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+
+	cmds := make([]*exec.Cmd, writers)
+	for i := range cmds {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperDepositor$", "-test.count=1")
+		cmd.Env = append(os.Environ(),
+			helperDirEnv+"="+dir,
+			fmt.Sprintf("%s=%d", helperDepositsEnv, deposits))
+		require.NoError(t, cmd.Start())
+		cmds[i] = cmd
+	}
+
+	// This process writes too, so that in-process and cross-process
+	// locking are exercised together.
+	for range deposits {
+		require.NoError(t, fs.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)))
+	}
+
+	for i, cmd := range cmds {
+		require.NoError(t, cmd.Wait(), "writer %d", i)
+	}
+
+	acc, err := fs.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, float64((writers+1)*deposits), acc.Balance, "no deposit is lost")
+
+	txs, err := fs.LoadTransactions()
+	require.NoError(t, err)
+	assert.Len(t, txs, (writers+1)*deposits)
+	require.NoError(t, storage.VerifyChain(txs))
+
+	events, err := fs.PendingEvents(0)
+	require.NoError(t, err)
+	assert.Len(t, events, 1+(writers+1)*deposits)
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Outbox exposes domain events that were committed together with the
+// balance changes they describe and have not been delivered yet.
+type Outbox interface {
+	PendingEvents(limit int) ([]model.Event, error)
+	MarkDispatched(eventIDs ...string) error
+}
+
+type outboxFile struct {
+	NextSeq int64         `json:"next_seq"`
+	Events  []model.Event `json:"events"`
+}
+
+func (o *outboxFile) append(e model.Event) {
+	if o.NextSeq == 0 {
+		o.NextSeq = 1
+	}
+	e.Seq = o.NextSeq
+	o.NextSeq++
+	o.Events = append(o.Events, e)
+}
+
+func (fs *FileStorage) PendingEvents(limit int) ([]model.Event, error) {
+	if err := fs.lock(OpPendingEvents); err != nil {
+		return nil, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return nil, err
+	}
+
+	outbox, err := fs.loadOutboxUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	events := outbox.Events
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+
+	return events, nil
+}
+
+func (fs *FileStorage) MarkDispatched(eventIDs ...string) error {
+	if err := fs.lock(OpMarkDispatched); err != nil {
+		return err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return err
+	}
+
+	outbox, err := fs.loadOutboxUnsafe()
+	if err != nil {
+		return err
+	}
+
+	dispatched := make(map[string]bool, len(eventIDs))
+	for _, id := range eventIDs {
+		dispatched[id] = true
+	}
+
+	pending := []model.Event{}
+	for _, e := range outbox.Events {
+		if !dispatched[e.ID] {
+			pending = append(pending, e)
+		}
+	}
+	if len(pending) == len(outbox.Events) {
+		return nil
+	}
+	outbox.Events = pending
+
+	w, err := marshalFile(fs.outboxFilePath, outbox)
+	if err != nil {
+		return err
+	}
+
+	return fs.commitUnsafe(w)
+}
+
+func (fs *FileStorage) loadOutboxUnsafe() (*outboxFile, error) {
+	outbox := &outboxFile{Events: []model.Event{}}
+	if fs.outboxFilePath == "" {
+		return outbox, nil
+	}
+
+	data, err := os.ReadFile(fs.outboxFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return outbox, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read outbox file: %w", err)
+	}
+	if len(data) == 0 {
+		return outbox, nil
+	}
+
+	if err := decodeFile(kindOutbox, data, outbox); err != nil {
+		return nil, fmt.Errorf("corrupted outbox file: %w", err)
+	}
+
+	return outbox, nil
+}
+
+// outboxWritesUnsafe returns the write that appends events to the outbox, or
+// nothing when the storage has no outbox configured.
+func (fs *FileStorage) outboxWritesUnsafe(events ...model.Event) ([]fileWrite, error) {
+	if fs.outboxFilePath == "" {
+		return nil, nil
+	}
+
+	outbox, err := fs.loadOutboxUnsafe()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		outbox.append(e)
+	}
+
+	w, err := marshalFile(fs.outboxFilePath, outbox)
+	if err != nil {
+		return nil, err
+	}
+
+	return []fileWrite{w}, nil
+}
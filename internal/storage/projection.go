@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ErrCorruptLog means the event log cannot be replayed: a line does not
+// parse, events are out of sequence, or an event does not apply to the
+// state the earlier ones built.
+var ErrCorruptLog = errors.New("corrupt event log")
+
+// Projection is a read model of the event log. EventStore feeds it every
+// event in log order, starting from the first, so a new projection needs
+// no migration: it is built from the history when the store is opened.
+// Events reach it only once they are committed and the account state took
+// them. Whenever the store replays the log from the start it calls Reset
+// first. Apply and Reset run under the store's lock; readers must do
+// their own locking.
+type Projection interface {
+	Name() string
+	Apply(e model.Event)
+	Reset()
+}
+
+// accountProjection is the account state of an EventStore. Unlike other
+// projections a failure to apply an event is an error, since the state
+// must match what every writer validated against.
+type accountProjection struct {
+	accounts map[string]*model.Account
+	order    []string
+	seq      int64
+	lastHash string
+	heads    map[string]string
+}
+
+func newAccountProjection() *accountProjection {
+	return &accountProjection{
+		accounts: make(map[string]*model.Account),
+		heads:    make(map[string]string),
+	}
+}
+
+func (p *accountProjection) apply(e model.Event) error {
+	if e.Seq != p.seq+1 {
+		return fmt.Errorf("%w: event %s has seq %d, expected %d", ErrCorruptLog, e.ID, e.Seq, p.seq+1)
+	}
+	if err := p.applyEvent(e); err != nil {
+		return fmt.Errorf("%w: event %d (%s): %w", ErrCorruptLog, e.Seq, e.Type, err)
+	}
+
+	p.seq = e.Seq
+	return nil
+}
+
+func (p *accountProjection) applyEvent(e model.Event) error {
+	switch e.Type {
+	case model.AccountOpened:
+		if e.Account == nil {
+			return fmt.Errorf("no account")
+		}
+		if _, ok := p.accounts[e.AccountID]; ok {
+			return fmt.Errorf("account %s %w", e.AccountID, ErrAlreadyExists)
+		}
+		acc := *e.Account
+		p.accounts[acc.ID] = &acc
+		p.order = append(p.order, acc.ID)
+
+	case model.MoneyDeposited, model.MoneyWithdrawn:
+		tx := e.Transaction
+		if tx == nil {
+			return fmt.Errorf("no transaction")
+		}
+		acc, ok := p.accounts[tx.AccountID]
+		if !ok {
+			return fmt.Errorf("account %s %w", tx.AccountID, ErrNotFound)
+		}
+		if tx.PrevHash != p.lastHash || tx.AccountPrevHash != p.heads[tx.AccountID] {
+			return fmt.Errorf("transaction %s: %w", tx.ID, ErrChainBroken)
+		}
+		if err := acc.Apply(tx.Delta()); err != nil {
+			return err
+		}
+		p.lastHash, p.heads[tx.AccountID] = tx.Hash, tx.Hash
+
+	case model.AccountFrozen, model.AccountUnfrozen, model.AccountClosed:
+		if e.Account == nil {
+			return fmt.Errorf("no account")
+		}
+		acc, ok := p.accounts[e.AccountID]
+		if !ok {
+			return fmt.Errorf("account %s %w", e.AccountID, ErrNotFound)
+		}
+		if err := acc.SetStatus(e.Account.Status); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+
+	return nil
+}
+
+func (p *accountProjection) list() []model.Account {
+	accounts := make([]model.Account, 0, len(p.order))
+	for _, id := range p.order {
+		accounts = append(accounts, *p.accounts[id])
+	}
+
+	return accounts
+}
+
+// MonthlyTotals is a read model of the money that went in and out of each
+// account per calendar month, in UTC.
+type MonthlyTotals struct {
+	mu     sync.Mutex
+	totals map[string]map[string]*MonthTotal
+}
+
+type MonthTotal struct {
+	Month string  `json:"month"`
+	In    float64 `json:"in"`
+	Out   float64 `json:"out"`
+	Count int     `json:"count"`
+}
+
+var _ Projection = (*MonthlyTotals)(nil)
+
+func NewMonthlyTotals() *MonthlyTotals {
+	return &MonthlyTotals{totals: make(map[string]map[string]*MonthTotal)}
+}
+
+func (p *MonthlyTotals) Name() string {
+	return "monthly_totals"
+}
+
+func (p *MonthlyTotals) Apply(e model.Event) {
+	tx := e.Transaction
+	if tx == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	months, ok := p.totals[tx.AccountID]
+	if !ok {
+		months = make(map[string]*MonthTotal)
+		p.totals[tx.AccountID] = months
+	}
+	month := tx.CreatedAt.UTC().Format("2006-01")
+	total, ok := months[month]
+	if !ok {
+		total = &MonthTotal{Month: month}
+		months[month] = total
+	}
+
+	if delta := tx.Delta(); delta > 0 {
+		total.In += delta
+	} else {
+		total.Out -= delta
+	}
+	total.Count++
+}
+
+func (p *MonthlyTotals) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.totals = make(map[string]map[string]*MonthTotal)
+}
+
+// Totals lists the months with transactions on accountID, oldest first.
+func (p *MonthlyTotals) Totals(accountID string) []MonthTotal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	months := p.totals[accountID]
+	totals := make([]MonthTotal, 0, len(months))
+	for _, month := range slices.Sorted(maps.Keys(months)) {
+		totals = append(totals, *months[month])
+	}
+
+	return totals
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"bank-app/internal/model"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"iter"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// TransactionQuery selects transactions from the log. Zero fields do not
+// filter.
+type TransactionQuery struct {
+	AccountID string
+	Types     []model.TransactionType
+	// MinAmount and MaxAmount are inclusive.
+	MinAmount float64
+	MaxAmount float64
+	// From is inclusive, To exclusive.
+	From time.Time
+	To   time.Time
+
+	// Limit caps the page; zero returns every match.
+	Limit int
+	// Cursor is the NextCursor of an earlier page of the same query.
+	Cursor string
+}
+
+// TransactionPage lists matches in log order. Since the log is append-only
+// that order never changes: following NextCursor never skips or repeats a
+// transaction, and once HasMore is false the same cursor picks up the
+// transactions appended later.
+type TransactionPage struct {
+	Transactions []model.Transaction `json:"transactions"`
+	NextCursor   string              `json:"next_cursor"`
+	HasMore      bool                `json:"has_more"`
+}
+
+func (q TransactionQuery) validate() error {
+	switch {
+	case q.MinAmount < 0 || q.MaxAmount < 0:
+		return fmt.Errorf("%w: negative amount bound", ErrInvalidQuery)
+	case q.MaxAmount > 0 && q.MinAmount > q.MaxAmount:
+		return fmt.Errorf("%w: min amount above max amount", ErrInvalidQuery)
+	case !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To):
+		return fmt.Errorf("%w: from is not before to", ErrInvalidQuery)
+	case q.Limit < 0:
+		return fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+
+	return nil
+}
+
+func (q TransactionQuery) match(tx model.Transaction) bool {
+	switch {
+	case q.AccountID != "" && tx.AccountID != q.AccountID:
+		return false
+	case len(q.Types) > 0 && !slices.Contains(q.Types, tx.Type):
+		return false
+	case tx.Amount < q.MinAmount:
+		return false
+	case q.MaxAmount > 0 && tx.Amount > q.MaxAmount:
+		return false
+	case !q.From.IsZero() && tx.CreatedAt.Before(q.From):
+		return false
+	case !q.To.IsZero() && !tx.CreatedAt.Before(q.To):
+		return false
+	}
+
+	return true
+}
+
+// fingerprint ties a cursor to the filters it was issued for.
+func (q TransactionQuery) fingerprint() uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%v|%v|%v|%d|%d",
+		q.AccountID, q.Types, q.MinAmount, q.MaxAmount, q.From.UnixNano(), q.To.UnixNano())
+
+	return h.Sum64()
+}
+
+// A cursor is the log position to resume from and the query fingerprint,
+// base64 encoded so that clients treat it as opaque.
+func encodeCursor(q TransactionQuery, pos int) string {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(pos))
+	buf = binary.BigEndian.AppendUint64(buf, q.fingerprint())
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeCursor(q TransactionQuery, logLen int) (int, error) {
+	if q.Cursor == "" {
+		return 0, nil
+	}
+
+	buf, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil || len(buf) != 16 {
+		return 0, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if binary.BigEndian.Uint64(buf[8:]) != q.fingerprint() {
+		return 0, fmt.Errorf("%w: cursor belongs to a different query", ErrInvalidQuery)
+	}
+	pos := binary.BigEndian.Uint64(buf[:8])
+	if pos > uint64(logLen) {
+		return 0, fmt.Errorf("%w: cursor is past the end of the log", ErrInvalidQuery)
+	}
+
+	return int(pos), nil
+}
+
+// txIndex holds the log together with the positions of each account's
+// transactions and all positions ordered by time, so that a query only
+// looks at the transactions that can match.
+type txIndex struct {
+	txs       []model.Transaction
+	byAccount map[string][]int
+	// byTime is sorted by CreatedAt, ties in log order. CreatedAt is set
+	// before a transaction is committed, so the log itself is only roughly
+	// in time order.
+	byTime  []int
+	ledgers map[string]*ledger
+}
+
+func newTxIndex() *txIndex {
+	return &txIndex{
+		byAccount: make(map[string][]int),
+		ledgers:   make(map[string]*ledger),
+	}
+}
+
+func (ix *txIndex) add(txs ...model.Transaction) {
+	for _, tx := range txs {
+		pos := len(ix.txs)
+		ix.txs = append(ix.txs, tx)
+		ix.byAccount[tx.AccountID] = append(ix.byAccount[tx.AccountID], pos)
+		ix.byTime, _ = insertByTime(ix.txs, ix.byTime, pos)
+
+		l, ok := ix.ledgers[tx.AccountID]
+		if !ok {
+			l = &ledger{}
+			ix.ledgers[tx.AccountID] = l
+		}
+		l.add(ix.txs, pos)
+	}
+}
+
+// extends reports whether txs is the indexed log with zero or more
+// transactions appended.
+func (ix *txIndex) extends(txs []model.Transaction) bool {
+	n := len(ix.txs)
+	if len(txs) < n {
+		return false
+	}
+	if n == 0 {
+		return true
+	}
+
+	last := ix.txs[n-1]
+	return txs[n-1].ID == last.ID && txs[n-1].Hash == last.Hash
+}
+
+func (ix *txIndex) query(q TransactionQuery) (TransactionPage, error) {
+	if err := q.validate(); err != nil {
+		return TransactionPage{}, err
+	}
+	start, err := decodeCursor(q, len(ix.txs))
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	page := TransactionPage{Transactions: []model.Transaction{}}
+	for pos := range ix.candidates(q, start) {
+		if !q.match(ix.txs[pos]) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Transactions) == q.Limit {
+			page.HasMore = true
+			page.NextCursor = encodeCursor(q, pos)
+			return page, nil
+		}
+		page.Transactions = append(page.Transactions, ix.txs[pos])
+	}
+
+	page.NextCursor = encodeCursor(q, len(ix.txs))
+	return page, nil
+}
+
+// candidates yields the positions from start on that may match q, in log
+// order, using the narrowest index available.
+func (ix *txIndex) candidates(q TransactionQuery, start int) iter.Seq[int] {
+	if q.AccountID != "" {
+		positions := ix.byAccount[q.AccountID]
+		i, _ := slices.BinarySearch(positions, start)
+		return slices.Values(positions[i:])
+	}
+
+	if q.From.IsZero() && q.To.IsZero() {
+		return func(yield func(int) bool) {
+			for pos := start; pos < len(ix.txs); pos++ {
+				if !yield(pos) {
+					return
+				}
+			}
+		}
+	}
+
+	lo, hi := 0, len(ix.byTime)
+	if !q.From.IsZero() {
+		lo, _ = slices.BinarySearchFunc(ix.byTime, q.From, ix.compareTime)
+	}
+	if !q.To.IsZero() {
+		hi, _ = slices.BinarySearchFunc(ix.byTime, q.To, ix.compareTime)
+	}
+
+	var positions []int
+	for _, pos := range ix.byTime[lo:max(lo, hi)] {
+		if pos >= start {
+			positions = append(positions, pos)
+		}
+	}
+	slices.Sort(positions)
+
+	return slices.Values(positions)
+}
+
+func (ix *txIndex) compareTime(pos int, t time.Time) int {
+	return ix.txs[pos].CreatedAt.Compare(t)
+}
+
+// QueryTransactions answers q from an index kept in memory. The index is
+// updated by this process's own commits and rebuilt from the file only
+// when another process has changed it.
+func (fs *FileStorage) QueryTransactions(q TransactionQuery) (_ TransactionPage, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpQueryTransactions, start, err, slog.String("account_id", q.AccountID))
+	}(time.Now())
+
+	if err := fs.lock(OpQueryTransactions); err != nil {
+		return TransactionPage{}, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return TransactionPage{}, err
+	}
+
+	ix, err := fs.indexUnsafe()
+	if err != nil {
+		return TransactionPage{}, err
+	}
+
+	return ix.query(q)
+}
+
+// indexUnsafe returns the index, reading the transaction file only if it
+// was replaced since the index was last brought up to date.
+func (fs *FileStorage) indexUnsafe() (*txIndex, error) {
+	info, err := os.Stat(fs.transactionFilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("stat transaction file: %w", err)
+	}
+	if fs.index != nil && sameFile(fs.indexedFile, info) {
+		return fs.index, nil
+	}
+
+	txs, err := fs.loadTransactionsUnsafe()
+	if err != nil {
+		return nil, err
+	}
+	fs.reindexUnsafe(txs)
+
+	return fs.index, nil
+}
+
+// reindexUnsafe brings the index up to txs, the current content of the
+// transaction file. When txs only appends to what is indexed already, just
+// the new transactions are added.
+func (fs *FileStorage) reindexUnsafe(txs []model.Transaction) {
+	info, err := os.Stat(fs.transactionFilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fs.index, fs.indexedFile = nil, nil
+		return
+	}
+
+	if fs.index == nil || !fs.index.extends(txs) {
+		fs.index = newTxIndex()
+	}
+	fs.index.add(txs[len(fs.index.txs):]...)
+	fs.indexedFile = info
+}
+
+// sameFile reports whether a and b describe the same version of a file.
+// Commits replace the file by renaming, so a change shows in the inode as
+// well as in the size and modification time.
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+func (m *MemoryStorage) QueryTransactions(q TransactionQuery) (TransactionPage, error) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	if err := m.begin(OpQueryTransactions); err != nil {
+		return TransactionPage{}, err
+	}
+
+	return m.index.query(q)
+}
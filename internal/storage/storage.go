@@ -1,84 +1,214 @@
 package storage
 
 import (
+	"bank-app/internal/logging"
 	"bank-app/internal/model"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
 	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrClosed        = errors.New("storage closed")
+
+	ErrConcurrentModification = errors.New("concurrent modification")
 )
 
 type Storage interface {
 	SaveNewAccount(account model.Account) error
 	LoadAccount(accountID string) (*model.Account, error)
 	ApplyTransaction(accountID string, amount float64, tx model.Transaction) error
+	LoadTransactions() ([]model.Transaction, error)
+	UpdateAccountStatus(accountID string, status model.AccountStatus) error
+	Transfer(fromID, toID string, amount float64, out, in model.Transaction) error
+
+	// CompareAndApply is ApplyTransaction that fails with
+	// ErrConcurrentModification unless the account is still at version.
+	CompareAndApply(accountID string, version int64, amount float64, tx model.Transaction) error
+	// CompareAndTransfer is Transfer with the same check on both accounts.
+	CompareAndTransfer(fromID, toID string, fromVersion, toVersion int64,
+		amount float64, out, in model.Transaction) error
+
+	// ApplyBatch commits a whole batch at once and returns the error of
+	// each item. A non-nil second result means nothing was committed; for
+	// an atomic batch with failing items it is ErrBatchRejected.
+	ApplyBatch(batch Batch) ([]error, error)
+
+	// QueryTransactions returns a page of the transactions matching q.
+	QueryTransactions(q TransactionQuery) (TransactionPage, error)
+	// BalanceAt returns the balance of accountID as of at, from its
+	// opening balance and its transactions created up to then.
+	BalanceAt(accountID string, at time.Time) (float64, error)
 }
 
 type FileStorage struct {
 	accountFilePath     string
 	transactionFilePath string
+	outboxFilePath      string
+	logger              *slog.Logger
+	metrics             *storageMetrics
+	lockTimeout         time.Duration
+	staleLockAge        time.Duration
+	procLock            processLock
+	group               *groupCommit
+	index               *txIndex
+	indexedFile         os.FileInfo
+	upgraded            bool
+	noUpgrade           bool
 	mu                  sync.Mutex
+	closed              bool
+}
+
+type FileOption func(*FileStorage)
+
+// WithOutbox records a domain event for every change in the given file, in
+// the same commit as the change itself.
+func WithOutbox(path string) FileOption {
+	return func(fs *FileStorage) {
+		fs.outboxFilePath = path
+	}
+}
+
+// NewFileStorage returns a storage over the given files. Files of an older
+// format are upgraded now, before anything else reads them; a failure is
+// logged and left to the first operation. Programs that own the data use
+// OpenFileStorage instead.
+func NewFileStorage(accPath, txPath string, opts ...FileOption) *FileStorage {
+	fs := newFileStorage(accPath, txPath, opts...)
+	_ = fs.upgrade()
+
+	return fs
 }
 
-func NewFileStorage(accPath, txPath string) *FileStorage {
-	return &FileStorage{
+// OpenFileStorage is NewFileStorage that fails when the files cannot be
+// upgraded, above all when a newer build wrote them, so that a server
+// refuses to start rather than fail every request.
+func OpenFileStorage(accPath, txPath string, opts ...FileOption) (*FileStorage, error) {
+	fs := newFileStorage(accPath, txPath, opts...)
+	if err := fs.upgrade(); err != nil {
+		_ = fs.procLock.close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func newFileStorage(accPath, txPath string, opts ...FileOption) *FileStorage {
+	fs := &FileStorage{
 		accountFilePath:     accPath,
 		transactionFilePath: txPath,
+		logger:              logging.Discard(),
+		lockTimeout:         defaultLockTimeout,
+		staleLockAge:        defaultStaleLockAge,
+	}
+	for _, opt := range opts {
+		opt(fs)
 	}
+	fs.procLock = newProcessLock(fs.lockPath(), fs.staleLockAge)
+
+	return fs
 }
 
-func (fs *FileStorage) SaveNewAccount(acc model.Account) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+// Close waits for operations in flight, finishes any interrupted commit and
+// syncs the data directories. Every later call fails with ErrClosed.
+func (fs *FileStorage) Close() (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpClose, start, err)
+	}(time.Now())
 
-	accounts := []model.Account{}
+	if err := fs.lock(OpClose); err != nil {
+		return err
+	}
+	defer fs.unlock()
 
-	data, err := os.ReadFile(fs.accountFilePath)
-	if err == nil && len(data) > 0 {
-		if err := json.Unmarshal(data, &accounts); err != nil {
-			return fmt.Errorf("corrupted json file: %w", err)
-		}
-		for _, a := range accounts {
-			if acc.ID == a.ID {
-				return fmt.Errorf("account with ID %s allready exist", acc.ID)
-			}
+	if fs.closed {
+		return nil
+	}
+	if err := fs.recoverUnsafe(); err != nil {
+		return err
+	}
+
+	if err := fs.syncDirsUnsafe(); err != nil {
+		return err
+	}
+
+	fs.closed = true
+	return nil
+}
+
+func (fs *FileStorage) SaveNewAccount(acc model.Account) (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpSaveAccount, start, err, slog.String("account_id", acc.ID))
+	}(time.Now())
+
+	if err := fs.lock(OpSaveAccount); err != nil {
+		return err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return err
+	}
+
+	accounts, err := fs.loadAccountsUnsafe()
+	if err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		if acc.ID == a.ID {
+			return fmt.Errorf("account with ID %s %w", acc.ID, ErrAlreadyExists)
 		}
 	}
 
 	accounts = append(accounts, acc)
 
-	newData, err := json.MarshalIndent(accounts, "", "  ")
+	accWrite, err := marshalFile(fs.accountFilePath, accounts)
 	if err != nil {
-		return fmt.Errorf("marshal accounts: %w", err)
+		return err
 	}
 
-	err = os.WriteFile(fs.accountFilePath, newData, 0644)
+	outboxWrites, err := fs.outboxWritesUnsafe(model.NewAccountOpenedEvent(acc))
 	if err != nil {
-		return fmt.Errorf("write acounts file: %w", err)
+		return err
 	}
 
-	return nil
+	return fs.commitUnsafe(append([]fileWrite{accWrite}, outboxWrites...)...)
 }
 
-func (fs *FileStorage) LoadAccount(accountID string) (*model.Account, error) {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+func (fs *FileStorage) LoadAccount(accountID string) (_ *model.Account, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpLoadAccount, start, err, slog.String("account_id", accountID))
+	}(time.Now())
+
+	if err := fs.lock(OpLoadAccount); err != nil {
+		return nil, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return nil, err
+	}
 
 	data, err := os.ReadFile(fs.accountFilePath)
 	if errors.Is(err, os.ErrNotExist) {
-		return nil, fmt.Errorf("account %s not found", accountID)
+		return nil, fmt.Errorf("account %s %w", accountID, ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("read account file: %w", err)
 	}
 	if len(data) == 0 {
-		return nil, fmt.Errorf("account %s not found", accountID)
+		return nil, fmt.Errorf("account %s %w", accountID, ErrNotFound)
 	}
 
 	accs := []model.Account{}
 
-	if err := json.Unmarshal(data, &accs); err != nil {
+	if err := decodeFile(kindAccounts, data, &accs); err != nil {
 		return nil, fmt.Errorf("corrupted json file %w", err)
 	}
 
@@ -88,113 +218,358 @@ func (fs *FileStorage) LoadAccount(accountID string) (*model.Account, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("account %v not found", accountID)
+	return nil, fmt.Errorf("account %s %w", accountID, ErrNotFound)
 }
 
-func (fs *FileStorage) ApplyTransaction(
-	accountID string, amount float64, tx model.Transaction) error {
-	if accountID == "" {
+func (fs *FileStorage) ApplyTransaction(accountID string, amount float64, tx model.Transaction) error {
+	return fs.apply(posting{accountID: accountID, amount: amount, tx: tx})
+}
+
+func (fs *FileStorage) CompareAndApply(
+	accountID string, version int64, amount float64, tx model.Transaction) error {
+	return fs.apply(posting{accountID: accountID, amount: amount, tx: tx, checkVersion: true, version: version})
+}
+
+func (fs *FileStorage) apply(p posting) (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpApplyTransaction, start, err, slog.String("account_id", p.accountID),
+			slog.String("transaction_id", p.tx.ID), slog.Float64("amount", p.amount))
+	}(time.Now())
+
+	if p.accountID == "" {
 		return fmt.Errorf("empty ID field")
 	}
+	if fs.group != nil {
+		return fs.submit(p)
+	}
+
+	if err := fs.lock(OpApplyTransaction); err != nil {
+		return err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return err
+	}
+
+	return fs.applyPostingsUnsafe([]posting{p})
+}
+
+// Transfer moves amount from fromID to toID, recording out and in, as a
+// single commit.
+func (fs *FileStorage) Transfer(fromID, toID string, amount float64, out, in model.Transaction) error {
+	return fs.transfer(
+		posting{accountID: fromID, amount: -amount, tx: out},
+		posting{accountID: toID, amount: amount, tx: in})
+}
+
+func (fs *FileStorage) CompareAndTransfer(fromID, toID string, fromVersion, toVersion int64,
+	amount float64, out, in model.Transaction) error {
+	return fs.transfer(
+		posting{accountID: fromID, amount: -amount, tx: out, checkVersion: true, version: fromVersion},
+		posting{accountID: toID, amount: amount, tx: in, checkVersion: true, version: toVersion})
+}
+
+func (fs *FileStorage) transfer(from, to posting) (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpTransfer, start, err, slog.String("account_id", from.accountID),
+			slog.String("to_account_id", to.accountID), slog.String("transaction_id", from.tx.ID),
+			slog.Float64("amount", to.amount))
+	}(time.Now())
+
+	if err := validateTransfer(from, to); err != nil {
+		return err
+	}
+	if fs.group != nil {
+		return fs.submit(from, to)
+	}
 
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	if err := fs.lock(OpTransfer); err != nil {
+		return err
+	}
+	defer fs.unlock()
 
-	if err := fs.applyTransactionUnsafe(accountID, amount, tx); err != nil {
+	if err := fs.recoverUnsafe(); err != nil {
 		return err
 	}
 
+	return fs.applyPostingsUnsafe([]posting{from, to})
+}
+
+func validateTransfer(from, to posting) error {
+	if from.accountID == "" || to.accountID == "" {
+		return fmt.Errorf("empty ID field")
+	}
+	if from.accountID == to.accountID {
+		return fmt.Errorf("transfer to the same account %s", from.accountID)
+	}
+	if to.amount <= 0 {
+		return model.ErrInvalidAmount
+	}
+
 	return nil
 }
 
+func (fs *FileStorage) UpdateAccountStatus(accountID string, status model.AccountStatus) (err error) {
+	defer func(start time.Time) {
+		fs.observe(OpUpdateStatus, start, err, slog.String("account_id", accountID),
+			slog.String("status", string(status)))
+	}(time.Now())
+
+	if err := fs.lock(OpUpdateStatus); err != nil {
+		return err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return err
+	}
+
+	accounts, err := fs.loadAccountsUnsafe()
+	if err != nil {
+		return err
+	}
+
+	acc := findAccount(accounts, accountID)
+	if acc == nil {
+		return fmt.Errorf("account %s %w", accountID, ErrNotFound)
+	}
+	if err := acc.SetStatus(status); err != nil {
+		return err
+	}
+
+	accWrite, err := marshalFile(fs.accountFilePath, accounts)
+	if err != nil {
+		return err
+	}
+	outboxWrites, err := fs.outboxWritesUnsafe(model.NewAccountStatusEvent(*acc))
+	if err != nil {
+		return err
+	}
+
+	return fs.commitUnsafe(append([]fileWrite{accWrite}, outboxWrites...)...)
+}
+
+func findAccount(accounts []model.Account, accountID string) *model.Account {
+	for i := range accounts {
+		if accounts[i].ID == accountID {
+			return &accounts[i]
+		}
+	}
+
+	return nil
+}
+
+// LoadAccounts returns every account in the order they were opened.
+func (fs *FileStorage) LoadAccounts() (_ []model.Account, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpLoadAccounts, start, err)
+	}(time.Now())
+
+	if err := fs.lock(OpLoadAccounts); err != nil {
+		return nil, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return nil, err
+	}
+
+	return fs.loadAccountsUnsafe()
+}
+
 func (fs *FileStorage) loadAccountsUnsafe() ([]model.Account, error) {
 	dataAccs, err := os.ReadFile(fs.accountFilePath)
-	if errors.Is(err, os.ErrNotExist) || len(dataAccs) == 0 {
+	if errors.Is(err, os.ErrNotExist) {
 		return []model.Account{}, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("file read: %w", err)
 	}
+	if len(dataAccs) == 0 {
+		return []model.Account{}, nil
+	}
 
 	sliceAccs := []model.Account{}
 
-	if err := json.Unmarshal(dataAccs, &sliceAccs); err != nil {
+	if err := decodeFile(kindAccounts, dataAccs, &sliceAccs); err != nil {
 		return nil, fmt.Errorf("corrupted json file %w", err)
 	}
 
 	return sliceAccs, nil
 }
 
-func (fs *FileStorage) saveTransactionUnsafe(tx model.Transaction) error {
+func (fs *FileStorage) LoadTransactions() (_ []model.Transaction, err error) {
+	defer func(start time.Time) {
+		fs.observe(OpLoadTransactions, start, err)
+	}(time.Now())
+
+	if err := fs.lock(OpLoadTransactions); err != nil {
+		return nil, err
+	}
+	defer fs.unlock()
+
+	if err := fs.recoverUnsafe(); err != nil {
+		return nil, err
+	}
+
+	return fs.loadTransactionsUnsafe()
+}
+
+func (fs *FileStorage) Verify() error {
+	txs, err := fs.LoadTransactions()
+	if err != nil {
+		return err
+	}
+
+	return VerifyChain(txs)
+}
+
+func (fs *FileStorage) loadTransactionsUnsafe() ([]model.Transaction, error) {
 	sliceTransactions := []model.Transaction{}
 
 	dataTxs, err := os.ReadFile(fs.transactionFilePath)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
-			return fmt.Errorf("read transaction file: %w", err)
+			return nil, fmt.Errorf("read transaction file: %w", err)
 		}
 	} else if len(dataTxs) > 0 {
-		if err := json.Unmarshal(dataTxs, &sliceTransactions); err != nil {
-			return fmt.Errorf("unmarshal transactions: %w", err)
+		if err := decodeFile(kindTransactions, dataTxs, &sliceTransactions); err != nil {
+			return nil, fmt.Errorf("unmarshal transactions: %w", err)
 		}
 	}
 
-	sliceTransactions = append(sliceTransactions, tx)
+	return sliceTransactions, nil
+}
 
-	newDataTxs, err := json.MarshalIndent(sliceTransactions, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal transactions: %w", err)
-	}
+// posting is one balance change together with the transaction recording it.
+// With checkVersion set it only applies to the account at version.
+type posting struct {
+	accountID    string
+	amount       float64
+	tx           model.Transaction
+	checkVersion bool
+	version      int64
+}
 
-	if err := os.WriteFile(fs.transactionFilePath, newDataTxs, 0644); err != nil {
-		return fmt.Errorf("write transactions file: %w", err)
+func (p posting) check(acc *model.Account) error {
+	if p.checkVersion && acc.Version != p.version {
+		return fmt.Errorf("account %s is at version %d, expected %d: %w",
+			acc.ID, acc.Version, p.version, ErrConcurrentModification)
 	}
 
 	return nil
 }
 
-func (fs *FileStorage) applyTransactionUnsafe(
-	accountID string, amount float64, tx model.Transaction) error {
-	accounts, err := fs.loadAccountsUnsafe()
+// applyPostingsUnsafe applies all postings or none of them.
+func (fs *FileStorage) applyPostingsUnsafe(postings []posting) error {
+	errs, err := fs.applyBatchUnsafe([][]posting{postings}, false, nil)
 	if err != nil {
 		return err
 	}
 
-	var acc *model.Account
-	for i := range accounts {
-		if accounts[i].ID == accountID {
-			acc = &accounts[i]
-			break
-		}
+	return errs[0]
+}
+
+// applyBatchUnsafe applies each item all or nothing and commits those that
+// succeeded in a single write, or none of them if atomic and one failed. It
+// returns the error of every item; a non-nil second result means nothing
+// was committed, which is also the case if an account fails one of checks.
+func (fs *FileStorage) applyBatchUnsafe(items [][]posting, atomic bool, checks []posting) ([]error, error) {
+	accounts, err := fs.loadAccountsUnsafe()
+	if err != nil {
+		return nil, err
 	}
-	if acc == nil {
-		return fmt.Errorf("account %s not found", accountID)
+	err = checkVersions(checks, func(accountID string) *model.Account {
+		return findAccount(accounts, accountID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	txs, err := fs.loadTransactionsUnsafe()
+	if err != nil {
+		return nil, err
 	}
 
-	if err := acc.Apply(amount); err != nil {
-		return err
+	errs := make([]error, len(items))
+	var events []model.Event
+	for i, postings := range items {
+		var applied []model.Transaction
+		applied, errs[i] = applyPostings(accounts, txs, postings)
+		if errs[i] != nil {
+			continue
+		}
+
+		txs = append(txs, applied...)
+		for _, tx := range applied {
+			events = append(events, model.NewTransactionEvent(tx))
+		}
+	}
+	if atomic && slices.ContainsFunc(errs, func(err error) bool { return err != nil }) {
+		return errs, ErrBatchRejected
+	}
+	if len(events) == 0 {
+		return errs, nil
 	}
 
-	if err := fs.writeAccountsUnsafe(accounts); err != nil {
-		return err
+	accWrite, err := marshalFile(fs.accountFilePath, accounts)
+	if err != nil {
+		return nil, err
+	}
+	txWrite, err := marshalFile(fs.transactionFilePath, txs)
+	if err != nil {
+		return nil, err
+	}
+	outboxWrites, err := fs.outboxWritesUnsafe(events...)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := fs.saveTransactionUnsafe(tx); err != nil {
-		return err
+	if err := fs.commitUnsafe(append([]fileWrite{accWrite, txWrite}, outboxWrites...)...); err != nil {
+		return nil, err
 	}
+	fs.reindexUnsafe(txs)
 
-	return nil
+	return errs, nil
 }
 
-func (fs *FileStorage) writeAccountsUnsafe(accounts []model.Account) error {
-	newData, err := json.MarshalIndent(accounts, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal accounts: %w", err)
+// applyPostings updates accounts in place and returns the sealed
+// transactions to append to history, or leaves accounts untouched if any
+// posting fails.
+func applyPostings(accounts []model.Account, history []model.Transaction,
+	postings []posting) ([]model.Transaction, error) {
+	updated := make(map[int]model.Account, len(postings))
+	for _, p := range postings {
+		i := slices.IndexFunc(accounts, func(a model.Account) bool { return a.ID == p.accountID })
+		if i < 0 {
+			return nil, fmt.Errorf("account %s %w", p.accountID, ErrNotFound)
+		}
+
+		acc, ok := updated[i]
+		if !ok {
+			acc = accounts[i]
+		}
+		if err := p.check(&acc); err != nil {
+			return nil, err
+		}
+		if err := acc.Apply(p.amount); err != nil {
+			return nil, err
+		}
+		updated[i] = acc
 	}
 
-	if err := os.WriteFile(fs.accountFilePath, newData, 0644); err != nil {
-		return fmt.Errorf("write accounts file: %w", err)
+	chain := history
+	for _, p := range postings {
+		tx := p.tx
+		if err := sealTransaction(chain, &tx); err != nil {
+			return nil, err
+		}
+		chain = append(chain, tx)
 	}
 
-	return nil
+	for i, acc := range updated {
+		accounts[i] = acc
+	}
+
+	return chain[len(history):], nil
 }
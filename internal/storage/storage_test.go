@@ -1,11 +1,15 @@
 package storage_test
 
 import (
+	"bank-app/internal/metrics"
 	"bank-app/internal/model"
 	"bank-app/internal/storage"
+	"bytes"
 	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -220,15 +224,27 @@ func writeJSON(t *testing.T, path string, v any) {
 	require.NoError(t, err)
 }
 
-func readAccounts(t *testing.T, path string) []model.Account {
+// readData decodes the data of a file in the current format into v.
+func readData(t *testing.T, path string, v any) {
 	t.Helper()
 
 	data, err := os.ReadFile(path)
 	require.NoError(t, err)
 
-	var accs []model.Account
+	var env struct {
+		Version int             `json:"version"`
+		Data    json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(data, &env))
+	require.Equal(t, storage.FormatVersion, env.Version)
+	require.NoError(t, json.Unmarshal(env.Data, v))
+}
+
+func readAccounts(t *testing.T, path string) []model.Account {
+	t.Helper()
 
-	require.NoError(t, json.Unmarshal(data, &accs))
+	var accs []model.Account
+	readData(t, path, &accs)
 
 	return accs
 }
@@ -236,12 +252,303 @@ func readAccounts(t *testing.T, path string) []model.Account {
 func readTransactions(t *testing.T, path string) []model.Transaction {
 	t.Helper()
 
-	data, err := os.ReadFile(path)
+	var txs []model.Transaction
+	readData(t, path, &txs)
+
+	return txs
+}
+
+func TestFileStorage_UpdateAccountStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		account    model.Account
+		steps      []model.AccountStatus
+		wantErr    error
+		wantStatus model.AccountStatus
+	}{
+		{
+			name:       "freeze",
+			account:    model.Account{ID: "a", Owner: "Anton", Balance: 10},
+			steps:      []model.AccountStatus{model.StatusFrozen},
+			wantStatus: model.StatusFrozen,
+		}, {
+			name:       "unfreeze",
+			account:    model.Account{ID: "a", Owner: "Anton", Balance: 10},
+			steps:      []model.AccountStatus{model.StatusFrozen, model.StatusActive},
+			wantStatus: model.StatusActive,
+		}, {
+			name:    "close with money left",
+			account: model.Account{ID: "a", Owner: "Anton", Balance: 10},
+			steps:   []model.AccountStatus{model.StatusClosed},
+			wantErr: model.ErrNonZeroBalance,
+		}, {
+			name:    "closed is final",
+			account: model.Account{ID: "a", Owner: "Anton"},
+			steps:   []model.AccountStatus{model.StatusClosed, model.StatusActive},
+			wantErr: model.ErrAccountClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			accPath := filepath.Join(dir, "accounts.json")
+
+			writeJSON(t, accPath, []model.Account{tt.account})
+			fs := storage.NewFileStorage(accPath, filepath.Join(dir, "transactions.json"))
+
+			var err error
+			for _, status := range tt.steps {
+				if err = fs.UpdateAccountStatus("a", status); err != nil {
+					break
+				}
+			}
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			acc, err := fs.LoadAccount("a")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, acc.Status)
+		})
+	}
+}
+
+func TestFileStorage_FrozenAccountRejectsTransactions(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+
+	writeJSON(t, accPath, []model.Account{{ID: "a", Owner: "Anton", Balance: 10}})
+	fs := storage.NewFileStorage(accPath, txPath)
+
+	require.NoError(t, fs.UpdateAccountStatus("a", model.StatusFrozen))
+	err := fs.ApplyTransaction("a", 5, model.NewDepositTransaction("a", 5))
+	require.ErrorIs(t, err, model.ErrAccountFrozen)
+
+	require.ErrorIs(t, fs.UpdateAccountStatus("missing", model.StatusFrozen), storage.ErrNotFound)
+}
+
+func TestFileStorage_Transfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		amount   float64
+		wantErr  bool
+		wantFrom float64
+		wantTo   float64
+		wantTxs  int
+	}{
+		{name: "success", from: "a", to: "b", amount: 30, wantFrom: 70, wantTo: 30, wantTxs: 2},
+		{name: "insufficient funds", from: "a", to: "b", amount: 150, wantErr: true, wantFrom: 100},
+		{name: "unknown target", from: "a", to: "x", amount: 10, wantErr: true, wantFrom: 100},
+		{name: "same account", from: "a", to: "a", amount: 10, wantErr: true, wantFrom: 100},
+		{name: "negative amount", from: "a", to: "b", amount: -10, wantErr: true, wantFrom: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			accPath := filepath.Join(dir, "accounts.json")
+			txPath := filepath.Join(dir, "transactions.json")
+
+			writeJSON(t, accPath, []model.Account{
+				{ID: "a", Owner: "Anton", Balance: 100},
+				{ID: "b", Owner: "Stas"},
+			})
+			fs := storage.NewFileStorage(accPath, txPath)
+
+			out, in := model.NewTransferTransactions(tt.from, tt.to, tt.amount)
+			err := fs.Transfer(tt.from, tt.to, tt.amount, out, in)
+
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			accs := readAccounts(t, accPath)
+			assert.Equal(t, tt.wantFrom, accs[0].Balance)
+			assert.Equal(t, tt.wantTo, accs[1].Balance)
+
+			txs, err := fs.LoadTransactions()
+			require.NoError(t, err)
+			assert.Len(t, txs, tt.wantTxs)
+		})
+	}
+}
+
+func TestFileStorage_OutboxWrittenWithChange(t *testing.T) {
+	dir := t.TempDir()
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json")))
+
+	require.NoError(t, fs.SaveNewAccount(model.Account{ID: "a", Owner: "Anton"}))
+	require.NoError(t, fs.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	require.NoError(t, fs.ApplyTransaction("a", -4, model.NewWithdrawTransaction("a", 4)))
+	require.Error(t, fs.ApplyTransaction("a", -100, model.NewWithdrawTransaction("a", 100)))
+
+	events, err := fs.PendingEvents(0)
 	require.NoError(t, err)
+	require.Len(t, events, 3)
 
-	var txs []model.Transaction
+	assert.Equal(t, model.AccountOpened, events[0].Type)
+	assert.Equal(t, model.MoneyDeposited, events[1].Type)
+	assert.Equal(t, model.MoneyWithdrawn, events[2].Type)
+	for i, e := range events {
+		assert.Equal(t, int64(i+1), e.Seq)
+	}
+	assert.NotEmpty(t, events[2].Transaction.Hash)
+}
 
-	require.NoError(t, json.Unmarshal(data, &txs))
+func TestFileStorage_OutboxUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	outboxPath := filepath.Join(dir, "outbox.json")
+	// A directory cannot be read as a file, which is not the same as an
+	// empty outbox.
+	require.NoError(t, os.Mkdir(outboxPath, 0755))
+
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(outboxPath))
+
+	_, err := fs.PendingEvents(0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read outbox file")
+}
 
-	return txs
+func TestFileStorage_Logging(t *testing.T) {
+	dir := t.TempDir()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithLogger(logger))
+
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+	tx := model.NewWithdrawTransaction("a", 50)
+	require.Error(t, fs.ApplyTransaction("a", -50, tx))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var failed map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &failed))
+
+	assert.Equal(t, "WARN", failed["level"])
+	assert.Equal(t, "a", failed["account_id"])
+	assert.Equal(t, tx.ID, failed["transaction_id"])
+	assert.Equal(t, -50.0, failed["amount"])
+	assert.Equal(t, "insufficient_funds", failed["error_class"])
+	assert.Contains(t, failed, "latency")
+}
+
+func TestFileStorage_Metrics(t *testing.T) {
+	dir := t.TempDir()
+	reg := metrics.NewRegistry()
+
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithMetrics(reg))
+
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("b", "Anton", 0)))
+	require.NoError(t, fs.ApplyTransaction("a", 100, model.NewDepositTransaction("a", 100)))
+	require.Error(t, fs.ApplyTransaction("b", -5, model.NewWithdrawTransaction("b", 5)))
+
+	var buf bytes.Buffer
+	_, err := reg.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+
+	assert.NotContains(t, out, "bank_accounts", "account gauges come from MeteredStorage")
+	assert.Contains(t, out, `bank_storage_operation_duration_seconds_count{op="apply_transaction",outcome="success"} 1`)
+	assert.Contains(t, out, `bank_storage_operation_duration_seconds_count{op="apply_transaction",outcome="failure"} 1`)
+	assert.Contains(t, out, `bank_storage_lock_wait_seconds_count{op="save_account"} 2`)
+}
+
+func TestFileStorage_Close(t *testing.T) {
+	dir := t.TempDir()
+	fs := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"),
+		storage.WithOutbox(filepath.Join(dir, "outbox.json")))
+
+	require.NoError(t, fs.SaveNewAccount(*model.NewAccount("a", "Anton", 0)))
+	require.NoError(t, fs.Close())
+	require.NoError(t, fs.Close(), "closing twice is a no-op")
+
+	_, err := fs.LoadAccount("a")
+	require.ErrorIs(t, err, storage.ErrClosed)
+	require.ErrorIs(t, fs.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)), storage.ErrClosed)
+
+	reopened := storage.NewFileStorage(
+		filepath.Join(dir, "accounts.json"),
+		filepath.Join(dir, "transactions.json"))
+	acc, err := reopened.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, "Anton", acc.Owner)
+}
+
+func TestFileStorage_CompareAndApplyAcrossHandles(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+
+	writeJSON(t, accPath, []model.Account{{ID: "a", Owner: "Anton", Balance: 100}})
+	first := storage.NewFileStorage(accPath, txPath)
+	second := storage.NewFileStorage(accPath, txPath)
+
+	seen, err := first.LoadAccount("a")
+	require.NoError(t, err)
+
+	require.NoError(t, second.CompareAndApply("a", seen.Version, -30, model.NewWithdrawTransaction("a", 30)))
+
+	err = first.CompareAndApply("a", seen.Version, -80, model.NewWithdrawTransaction("a", 80))
+	require.ErrorIs(t, err, storage.ErrConcurrentModification)
+
+	accounts := readAccounts(t, accPath)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, 70.0, accounts[0].Balance)
+	assert.Equal(t, seen.Version+1, accounts[0].Version)
+}
+
+func TestFileStorage_QueryTransactionsAcrossHandles(t *testing.T) {
+	dir := t.TempDir()
+	accPath := filepath.Join(dir, "accounts.json")
+	txPath := filepath.Join(dir, "transactions.json")
+
+	writeJSON(t, accPath, []model.Account{{ID: "a", Owner: "Anton"}, {ID: "b", Owner: "Stas"}})
+	first := storage.NewFileStorage(accPath, txPath)
+	second := storage.NewFileStorage(accPath, txPath)
+
+	query := func(accountID string) []model.Transaction {
+		t.Helper()
+		page, err := first.QueryTransactions(storage.TransactionQuery{AccountID: accountID})
+		require.NoError(t, err)
+		return page.Transactions
+	}
+
+	require.NoError(t, first.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	require.Len(t, query("a"), 1)
+
+	require.NoError(t, second.ApplyTransaction("a", 20, model.NewDepositTransaction("a", 20)))
+	require.NoError(t, second.ApplyTransaction("b", 5, model.NewDepositTransaction("b", 5)))
+	assert.Len(t, query("a"), 2, "commits of other handles are picked up")
+	assert.Len(t, query("b"), 1)
+
+	// A rewritten log is indexed from scratch.
+	writeJSON(t, txPath, []model.Transaction{model.NewDepositTransaction("b", 1)})
+	assert.Empty(t, query("a"))
+	assert.Len(t, query("b"), 1)
 }
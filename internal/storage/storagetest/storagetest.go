@@ -0,0 +1,721 @@
+// Package storagetest checks that a storage.Storage implementation behaves
+// like the reference FileStorage.
+package storagetest
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/storage"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a new, empty storage. It is called once per subtest and
+// may use t for temporary directories and cleanup.
+type Factory func(t *testing.T) storage.Storage
+
+// RunConformance runs the whole suite against storages made by factory.
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.Storage)
+	}{
+		{"SaveAndLoad", testSaveAndLoad},
+		{"DuplicateAccount", testDuplicateAccount},
+		{"LoadMissing", testLoadMissing},
+		{"LoadReturnsCopy", testLoadReturnsCopy},
+		{"ApplyTransaction", testApplyTransaction},
+		{"InsufficientFundsLeavesStateUnchanged", testInsufficientFunds},
+		{"UnknownAccount", testUnknownAccount},
+		{"EmptyAccountID", testEmptyAccountID},
+		{"TransactionRecordedOnce", testTransactionRecordedOnce},
+		{"Transfer", testTransfer},
+		{"TransferIsAtomic", testTransferIsAtomic},
+		{"TransferValidation", testTransferValidation},
+		{"AccountStatus", testAccountStatus},
+		{"HashChain", testHashChain},
+		{"Versions", testVersions},
+		{"CompareAndApply", testCompareAndApply},
+		{"CompareAndTransfer", testCompareAndTransfer},
+		{"BatchBestEffort", testBatchBestEffort},
+		{"BatchAtomic", testBatchAtomic},
+		{"BatchVersions", testBatchVersions},
+		{"QueryTransactions", testQueryTransactions},
+		{"QueryPagination", testQueryPagination},
+		{"BalanceAt", testBalanceAt},
+		{"BalanceAtOpeningBalance", testBalanceAtOpeningBalance},
+		{"ConcurrentDeposits", testConcurrentDeposits},
+		{"ConcurrentTransfers", testConcurrentTransfers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, factory(t))
+		})
+	}
+}
+
+func open(t *testing.T, s storage.Storage, id string, balance float64) {
+	t.Helper()
+
+	require.NoError(t, s.SaveNewAccount(*model.NewAccount(id, "owner-"+id, 0)))
+	if balance > 0 {
+		require.NoError(t, s.ApplyTransaction(id, balance, model.NewDepositTransaction(id, balance)))
+	}
+}
+
+func balance(t *testing.T, s storage.Storage, id string) float64 {
+	t.Helper()
+
+	acc, err := s.LoadAccount(id)
+	require.NoError(t, err)
+	return acc.Balance
+}
+
+func transactions(t *testing.T, s storage.Storage) []model.Transaction {
+	t.Helper()
+
+	txs, err := s.LoadTransactions()
+	require.NoError(t, err)
+	return txs
+}
+
+func testSaveAndLoad(t *testing.T, s storage.Storage) {
+	acc := *model.NewAccount("a", "Anton", 0)
+	require.NoError(t, s.SaveNewAccount(acc))
+
+	got, err := s.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", got.ID)
+	assert.Equal(t, "Anton", got.Owner)
+	assert.Zero(t, got.Balance)
+	assert.Equal(t, model.StatusActive, got.Status)
+	assert.True(t, acc.CreatedAt.Equal(got.CreatedAt))
+
+	assert.Empty(t, transactions(t, s), "opening an account records no transaction")
+}
+
+func testDuplicateAccount(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 10)
+
+	err := s.SaveNewAccount(*model.NewAccount("a", "Someone else", 0))
+	require.ErrorIs(t, err, storage.ErrAlreadyExists)
+
+	got, err := s.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, "owner-a", got.Owner, "the original account is kept")
+	assert.Equal(t, 10.0, got.Balance)
+}
+
+func testLoadMissing(t *testing.T, s storage.Storage) {
+	_, err := s.LoadAccount("missing")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	open(t, s, "a", 0)
+	_, err = s.LoadAccount("missing")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testLoadReturnsCopy(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 10)
+
+	acc, err := s.LoadAccount("a")
+	require.NoError(t, err)
+	acc.Balance = 1e9
+
+	assert.Equal(t, 10.0, balance(t, s, "a"))
+}
+
+func testApplyTransaction(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+
+	deposit := model.NewDepositTransaction("a", 100)
+	require.NoError(t, s.ApplyTransaction("a", 100, deposit))
+	withdraw := model.NewWithdrawTransaction("a", 30)
+	require.NoError(t, s.ApplyTransaction("a", -30, withdraw))
+
+	assert.Equal(t, 70.0, balance(t, s, "a"))
+
+	txs := transactions(t, s)
+	require.Len(t, txs, 2)
+	assert.Equal(t, deposit.ID, txs[0].ID)
+	assert.Equal(t, model.DepositTx, txs[0].Type)
+	assert.Equal(t, withdraw.ID, txs[1].ID)
+	assert.Equal(t, model.WithdrawTx, txs[1].Type)
+	assert.Equal(t, 30.0, txs[1].Amount)
+}
+
+func testInsufficientFunds(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 50)
+	before := transactions(t, s)
+
+	err := s.ApplyTransaction("a", -51, model.NewWithdrawTransaction("a", 51))
+	require.ErrorIs(t, err, model.ErrInsufficientFunds)
+
+	assert.Equal(t, 50.0, balance(t, s, "a"))
+	assert.Equal(t, before, transactions(t, s))
+}
+
+func testUnknownAccount(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+
+	err := s.ApplyTransaction("missing", 10, model.NewDepositTransaction("missing", 10))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Empty(t, transactions(t, s))
+
+	require.ErrorIs(t, s.UpdateAccountStatus("missing", model.StatusFrozen), storage.ErrNotFound)
+}
+
+func testEmptyAccountID(t *testing.T, s storage.Storage) {
+	require.Error(t, s.ApplyTransaction("", 10, model.NewDepositTransaction("", 10)))
+
+	out, in := model.NewTransferTransactions("", "b", 10)
+	require.Error(t, s.Transfer("", "b", 10, out, in))
+	assert.Empty(t, transactions(t, s))
+}
+
+func testTransactionRecordedOnce(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+
+	tx := model.NewDepositTransaction("a", 5)
+	require.NoError(t, s.ApplyTransaction("a", 5, tx))
+
+	count := 0
+	for _, got := range transactions(t, s) {
+		if got.ID == tx.ID {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+}
+
+func testTransfer(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 100)
+	open(t, s, "b", 0)
+
+	out, in := model.NewTransferTransactions("a", "b", 40)
+	require.NoError(t, s.Transfer("a", "b", 40, out, in))
+
+	assert.Equal(t, 60.0, balance(t, s, "a"))
+	assert.Equal(t, 40.0, balance(t, s, "b"))
+
+	txs := transactions(t, s)
+	require.Len(t, txs, 3)
+	assert.Equal(t, out.ID, txs[1].ID)
+	assert.Equal(t, in.ID, txs[2].ID)
+	assert.Equal(t, txs[1].TransferID, txs[2].TransferID)
+}
+
+func testTransferIsAtomic(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 100)
+	open(t, s, "b", 0)
+	require.NoError(t, s.UpdateAccountStatus("b", model.StatusFrozen))
+	before := transactions(t, s)
+
+	out, in := model.NewTransferTransactions("a", "b", 40)
+	require.ErrorIs(t, s.Transfer("a", "b", 40, out, in), model.ErrAccountFrozen)
+
+	out, in = model.NewTransferTransactions("a", "missing", 40)
+	require.ErrorIs(t, s.Transfer("a", "missing", 40, out, in), storage.ErrNotFound)
+
+	out, in = model.NewTransferTransactions("a", "b", 400)
+	require.Error(t, s.Transfer("a", "b", 400, out, in))
+
+	assert.Equal(t, 100.0, balance(t, s, "a"))
+	assert.Equal(t, 0.0, balance(t, s, "b"))
+	assert.Equal(t, before, transactions(t, s))
+}
+
+func testTransferValidation(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 100)
+	open(t, s, "b", 0)
+
+	out, in := model.NewTransferTransactions("a", "a", 10)
+	require.Error(t, s.Transfer("a", "a", 10, out, in))
+
+	out, in = model.NewTransferTransactions("a", "b", 0)
+	require.ErrorIs(t, s.Transfer("a", "b", 0, out, in), model.ErrInvalidAmount)
+
+	assert.Equal(t, 100.0, balance(t, s, "a"))
+}
+
+func testAccountStatus(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 10)
+
+	require.NoError(t, s.UpdateAccountStatus("a", model.StatusFrozen))
+	require.ErrorIs(t, s.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)), model.ErrAccountFrozen)
+
+	require.NoError(t, s.UpdateAccountStatus("a", model.StatusActive))
+	require.ErrorIs(t, s.UpdateAccountStatus("a", model.StatusClosed), model.ErrNonZeroBalance)
+
+	require.NoError(t, s.ApplyTransaction("a", -10, model.NewWithdrawTransaction("a", 10)))
+	require.NoError(t, s.UpdateAccountStatus("a", model.StatusClosed))
+	require.ErrorIs(t, s.ApplyTransaction("a", 1, model.NewDepositTransaction("a", 1)), model.ErrAccountClosed)
+	require.Error(t, s.UpdateAccountStatus("a", model.StatusActive), "closing is final")
+
+	acc, err := s.LoadAccount("a")
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusClosed, acc.Status)
+}
+
+func testHashChain(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 100)
+	open(t, s, "b", 0)
+	out, in := model.NewTransferTransactions("a", "b", 10)
+	require.NoError(t, s.Transfer("a", "b", 10, out, in))
+
+	txs := transactions(t, s)
+	for _, tx := range txs {
+		assert.NotEmpty(t, tx.Hash, tx.ID)
+	}
+	require.NoError(t, storage.VerifyChain(txs))
+}
+
+func testVersions(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+	version := func() int64 {
+		acc, err := s.LoadAccount("a")
+		require.NoError(t, err)
+		return acc.Version
+	}
+	assert.Equal(t, int64(0), version())
+
+	require.NoError(t, s.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	assert.Equal(t, int64(1), version())
+
+	require.NoError(t, s.UpdateAccountStatus("a", model.StatusFrozen))
+	assert.Equal(t, int64(2), version())
+
+	require.Error(t, s.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	assert.Equal(t, int64(2), version(), "a refused change keeps the version")
+}
+
+func testCompareAndApply(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 100)
+	acc, err := s.LoadAccount("a")
+	require.NoError(t, err)
+
+	require.NoError(t, s.CompareAndApply("a", acc.Version, -10, model.NewWithdrawTransaction("a", 10)))
+
+	err = s.CompareAndApply("a", acc.Version, -10, model.NewWithdrawTransaction("a", 10))
+	require.ErrorIs(t, err, storage.ErrConcurrentModification)
+	assert.Equal(t, "conflict", storage.ErrorClass(err))
+
+	assert.Equal(t, 90.0, balance(t, s, "a"))
+	assert.Len(t, transactions(t, s), 2)
+
+	err = s.CompareAndApply("missing", 0, 1, model.NewDepositTransaction("missing", 1))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testCompareAndTransfer(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 100)
+	open(t, s, "b", 0)
+	from, err := s.LoadAccount("a")
+	require.NoError(t, err)
+	to, err := s.LoadAccount("b")
+	require.NoError(t, err)
+
+	require.NoError(t, s.ApplyTransaction("b", 5, model.NewDepositTransaction("b", 5)))
+	before := transactions(t, s)
+
+	out, in := model.NewTransferTransactions("a", "b", 40)
+	err = s.CompareAndTransfer("a", "b", from.Version, to.Version, 40, out, in)
+	require.ErrorIs(t, err, storage.ErrConcurrentModification)
+	assert.Equal(t, 100.0, balance(t, s, "a"), "the matching leg must not be applied alone")
+	assert.Equal(t, before, transactions(t, s))
+
+	to, err = s.LoadAccount("b")
+	require.NoError(t, err)
+	require.NoError(t, s.CompareAndTransfer("a", "b", from.Version, to.Version, 40, out, in))
+	assert.Equal(t, 60.0, balance(t, s, "a"))
+	assert.Equal(t, 45.0, balance(t, s, "b"))
+}
+
+func deposit(id string, amount float64) []storage.Posting {
+	return []storage.Posting{{AccountID: id, Amount: amount, Transaction: model.NewDepositTransaction(id, amount)}}
+}
+
+func withdraw(id string, amount float64) []storage.Posting {
+	return []storage.Posting{{AccountID: id, Amount: -amount, Transaction: model.NewWithdrawTransaction(id, amount)}}
+}
+
+func transfer(from, to string, amount float64) []storage.Posting {
+	out, in := model.NewTransferTransactions(from, to, amount)
+	return []storage.Posting{
+		{AccountID: from, Amount: -amount, Transaction: out},
+		{AccountID: to, Amount: amount, Transaction: in},
+	}
+}
+
+func testBatchBestEffort(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+	open(t, s, "b", 0)
+
+	errs, err := s.ApplyBatch(storage.Batch{Items: [][]storage.Posting{
+		deposit("a", 100),
+		transfer("a", "b", 30),
+		withdraw("b", 50),
+		deposit("missing", 1),
+		transfer("b", "a", 10),
+	}})
+	require.NoError(t, err)
+	require.Len(t, errs, 5)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1], "later items see earlier ones")
+	assert.ErrorIs(t, errs[2], model.ErrInsufficientFunds)
+	assert.ErrorIs(t, errs[3], storage.ErrNotFound)
+	assert.NoError(t, errs[4])
+
+	assert.Equal(t, 80.0, balance(t, s, "a"))
+	assert.Equal(t, 20.0, balance(t, s, "b"))
+
+	txs := transactions(t, s)
+	assert.Len(t, txs, 5)
+	require.NoError(t, storage.VerifyChain(txs))
+}
+
+func testBatchAtomic(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 10)
+	open(t, s, "b", 0)
+	before := transactions(t, s)
+
+	errs, err := s.ApplyBatch(storage.Batch{Atomic: true, Items: [][]storage.Posting{
+		deposit("a", 100),
+		withdraw("b", 1),
+	}})
+	require.ErrorIs(t, err, storage.ErrBatchRejected)
+	require.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], model.ErrInsufficientFunds)
+
+	assert.Equal(t, 10.0, balance(t, s, "a"))
+	assert.Equal(t, before, transactions(t, s))
+
+	errs, err = s.ApplyBatch(storage.Batch{Atomic: true, Items: [][]storage.Posting{
+		deposit("a", 100),
+		transfer("a", "b", 110),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, 0.0, balance(t, s, "a"))
+	assert.Equal(t, 110.0, balance(t, s, "b"))
+}
+
+func testBatchVersions(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 100)
+	open(t, s, "b", 0)
+	acc, err := s.LoadAccount("a")
+	require.NoError(t, err)
+	expect := func(postings []storage.Posting, version int64) []storage.Posting {
+		for i := range postings {
+			postings[i].CheckVersion, postings[i].Version = true, version
+		}
+		return postings
+	}
+
+	require.NoError(t, s.ApplyTransaction("a", 5, model.NewDepositTransaction("a", 5)))
+	before := transactions(t, s)
+
+	for _, atomic := range []bool{false, true} {
+		errs, err := s.ApplyBatch(storage.Batch{Atomic: atomic, Items: [][]storage.Posting{
+			deposit("b", 1),
+			expect(withdraw("a", 10), acc.Version),
+		}})
+		require.ErrorIs(t, err, storage.ErrConcurrentModification, "atomic %v", atomic)
+		assert.Nil(t, errs)
+		assert.Equal(t, before, transactions(t, s), "no item is applied")
+	}
+
+	acc, err = s.LoadAccount("a")
+	require.NoError(t, err)
+	errs, err := s.ApplyBatch(storage.Batch{Items: [][]storage.Posting{
+		expect(withdraw("a", 10), acc.Version),
+		expect(withdraw("a", 10), acc.Version),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, errs, "versions are those before the batch")
+	assert.Equal(t, 85.0, balance(t, s, "a"))
+}
+
+func testQueryTransactions(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+	open(t, s, "b", 0)
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(tx model.Transaction, day int) model.Transaction {
+		tx.CreatedAt = base.AddDate(0, 0, day)
+		return tx
+	}
+	require.NoError(t, s.ApplyTransaction("a", 100, at(model.NewDepositTransaction("a", 100), 0)))
+	require.NoError(t, s.ApplyTransaction("b", 50, at(model.NewDepositTransaction("b", 50), 1)))
+	require.NoError(t, s.ApplyTransaction("a", -20, at(model.NewWithdrawTransaction("a", 20), 2)))
+	out, in := model.NewTransferTransactions("a", "b", 30)
+	require.NoError(t, s.Transfer("a", "b", 30, at(out, 3), at(in, 3)))
+	// Committed last but created first, as a slow caller's would be.
+	require.NoError(t, s.ApplyTransaction("b", 5, at(model.NewDepositTransaction("b", 5), -1)))
+
+	txs := transactions(t, s)
+	require.Len(t, txs, 6)
+
+	tests := []struct {
+		name  string
+		query storage.TransactionQuery
+		want  []int
+	}{
+		{"everything", storage.TransactionQuery{}, []int{0, 1, 2, 3, 4, 5}},
+		{"account", storage.TransactionQuery{AccountID: "a"}, []int{0, 2, 3}},
+		{"unknown account", storage.TransactionQuery{AccountID: "missing"}, nil},
+		{"type", storage.TransactionQuery{Types: []model.TransactionType{model.DepositTx}}, []int{0, 1, 5}},
+		{"types", storage.TransactionQuery{Types: []model.TransactionType{model.WithdrawTx, model.TransferInTx}}, []int{2, 4}},
+		{"min amount", storage.TransactionQuery{MinAmount: 30}, []int{0, 1, 3, 4}},
+		{"amount range", storage.TransactionQuery{MinAmount: 20, MaxAmount: 50}, []int{1, 2, 3, 4}},
+		{"from", storage.TransactionQuery{From: base.AddDate(0, 0, 2)}, []int{2, 3, 4}},
+		{"date range", storage.TransactionQuery{From: base.AddDate(0, 0, -1), To: base.AddDate(0, 0, 2)}, []int{0, 1, 5}},
+		{"account and date range", storage.TransactionQuery{AccountID: "b", To: base}, []int{5}},
+		{"all filters", storage.TransactionQuery{AccountID: "a", Types: []model.TransactionType{model.TransferOutTx},
+			MinAmount: 30, MaxAmount: 30, From: base, To: base.AddDate(0, 0, 4)}, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.QueryTransactions(tt.query)
+			require.NoError(t, err)
+
+			want := []model.Transaction{}
+			for _, i := range tt.want {
+				want = append(want, txs[i])
+			}
+			assert.Equal(t, want, page.Transactions)
+			assert.False(t, page.HasMore)
+		})
+	}
+
+	_, err := s.QueryTransactions(storage.TransactionQuery{MinAmount: 10, MaxAmount: 5})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+	_, err = s.QueryTransactions(storage.TransactionQuery{From: base, To: base})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+}
+
+func testQueryPagination(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+	open(t, s, "b", 0)
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, s.ApplyTransaction("a", float64(i), model.NewDepositTransaction("a", float64(i))))
+		require.NoError(t, s.ApplyTransaction("b", float64(i), model.NewDepositTransaction("b", float64(i))))
+	}
+
+	q := storage.TransactionQuery{AccountID: "a", Limit: 2}
+	var amounts []float64
+	for {
+		page, err := s.QueryTransactions(q)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Transactions), 2)
+		for _, tx := range page.Transactions {
+			amounts = append(amounts, tx.Amount)
+		}
+		q.Cursor = page.NextCursor
+		if !page.HasMore {
+			break
+		}
+
+		// Appends between pages land after everything already listed.
+		require.NoError(t, s.ApplyTransaction("a", 10, model.NewDepositTransaction("a", 10)))
+	}
+	assert.Equal(t, []float64{1, 2, 3, 4, 5, 10, 10, 10}, amounts)
+
+	page, err := s.QueryTransactions(q)
+	require.NoError(t, err)
+	assert.Empty(t, page.Transactions, "nothing new yet")
+
+	require.NoError(t, s.ApplyTransaction("a", 7, model.NewDepositTransaction("a", 7)))
+	page, err = s.QueryTransactions(q)
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1, "the last cursor picks up later transactions")
+	assert.Equal(t, 7.0, page.Transactions[0].Amount)
+
+	_, err = s.QueryTransactions(storage.TransactionQuery{AccountID: "b", Cursor: q.Cursor})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery, "cursors are bound to their query")
+	_, err = s.QueryTransactions(storage.TransactionQuery{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+}
+
+// testBalanceAt checks point-in-time balances against a replay of the
+// history, over enough transactions to span many checkpoints and with some
+// committed after later-created ones.
+func testBalanceAt(t *testing.T, s storage.Storage) {
+	open(t, s, "a", 0)
+	open(t, s, "b", 0)
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 300 {
+		at := base.Add(time.Duration(i) * time.Minute)
+		switch {
+		case i%10 == 9:
+			// Deposits only, so that no replay prefix goes negative.
+			tx := model.NewDepositTransaction("a", 7)
+			tx.CreatedAt = at.Add(-90 * time.Minute)
+			require.NoError(t, s.ApplyTransaction("a", 7, tx))
+		case i%3 == 2:
+			out, in := model.NewTransferTransactions("a", "b", 2)
+			out.CreatedAt, in.CreatedAt = at, at
+			require.NoError(t, s.Transfer("a", "b", 2, out, in))
+		case i%3 == 1:
+			tx := model.NewWithdrawTransaction("a", 1)
+			tx.CreatedAt = at
+			require.NoError(t, s.ApplyTransaction("a", -1, tx))
+		default:
+			tx := model.NewDepositTransaction("a", 5)
+			tx.CreatedAt = at
+			require.NoError(t, s.ApplyTransaction("a", 5, tx))
+		}
+	}
+
+	txs := transactions(t, s)
+	replay := func(id string, at time.Time) float64 {
+		acc := model.NewAccount(id, "", 0)
+		for _, tx := range txs {
+			if tx.AccountID == id && !tx.CreatedAt.After(at) {
+				require.NoError(t, acc.Apply(tx.Delta()))
+			}
+		}
+		return acc.Balance
+	}
+
+	for minute := -100; minute <= 310; minute += 7 {
+		at := base.Add(time.Duration(minute) * time.Minute)
+		for _, id := range []string{"a", "b"} {
+			got, err := s.BalanceAt(id, at)
+			require.NoError(t, err)
+			require.Equal(t, replay(id, at), got, "%s at minute %d", id, minute)
+		}
+	}
+
+	now, err := s.BalanceAt("a", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, balance(t, s, "a"), now)
+}
+
+// testBalanceAtOpeningBalance checks that money an account was opened with
+// counts, though no transaction records it.
+func testBalanceAtOpeningBalance(t *testing.T, s storage.Storage) {
+	acc := *model.NewAccount("a", "Anton", 50)
+	require.NoError(t, s.SaveNewAccount(acc))
+	tx := model.NewDepositTransaction("a", 20)
+	tx.CreatedAt = acc.CreatedAt.Add(time.Hour)
+	require.NoError(t, s.ApplyTransaction("a", 20, tx))
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want float64
+	}{
+		{name: "before the account was opened", at: acc.CreatedAt.Add(-time.Minute), want: 0},
+		{name: "when it was opened", at: acc.CreatedAt, want: 50},
+		{name: "before the deposit", at: tx.CreatedAt.Add(-time.Minute), want: 50},
+		{name: "after the deposit", at: tx.CreatedAt, want: 70},
+	}
+	for _, tt := range tests {
+		got, err := s.BalanceAt("a", tt.at)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+
+	_, err := s.BalanceAt("missing", acc.CreatedAt)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testConcurrentDeposits(t *testing.T, s storage.Storage) {
+	const (
+		accounts = 4
+		workers  = 8
+		deposits = 10
+	)
+	for i := range accounts {
+		open(t, s, fmt.Sprintf("acc-%d", i), 0)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*deposits)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("acc-%d", w%accounts)
+			for range deposits {
+				if err := s.ApplyTransaction(id, 1, model.NewDepositTransaction(id, 1)); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	perAccount := float64(workers / accounts * deposits)
+	for i := range accounts {
+		assert.Equal(t, perAccount, balance(t, s, fmt.Sprintf("acc-%d", i)))
+	}
+
+	txs := transactions(t, s)
+	assert.Len(t, txs, workers*deposits)
+	require.NoError(t, storage.VerifyChain(txs))
+}
+
+func testConcurrentTransfers(t *testing.T, s storage.Storage) {
+	const (
+		accounts  = 3
+		workers   = 6
+		transfers = 10
+		initial   = 100.0
+	)
+	for i := range accounts {
+		open(t, s, fmt.Sprintf("acc-%d", i), initial)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*transfers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			from := fmt.Sprintf("acc-%d", w%accounts)
+			to := fmt.Sprintf("acc-%d", (w+1)%accounts)
+			for range transfers {
+				out, in := model.NewTransferTransactions(from, to, 7)
+				// Some transfers may run out of funds; the total must
+				// hold either way.
+				err := s.Transfer(from, to, 7, out, in)
+				if err != nil && !errors.Is(err, model.ErrInsufficientFunds) {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	total := 0.0
+	for i := range accounts {
+		b := balance(t, s, fmt.Sprintf("acc-%d", i))
+		assert.GreaterOrEqual(t, b, 0.0)
+		total += b
+	}
+	assert.Equal(t, accounts*initial, total)
+
+	txs := transactions(t, s)
+	assert.Zero(t, (len(txs)-accounts)%2, "transfer legs are recorded in pairs")
+	require.NoError(t, storage.VerifyChain(txs))
+}
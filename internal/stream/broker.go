@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"bank-app/internal/model"
+	"sync"
+)
+
+// Broker fans out applied transactions to live subscribers. A subscriber
+// that falls a full buffer behind is dropped and its channel closed; it is
+// expected to reconnect and catch up from the stored history.
+type Broker struct {
+	buffer int
+
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]*subscriber
+}
+
+type subscriber struct {
+	accountID string
+	ch        chan model.Transaction
+}
+
+func NewBroker(buffer int) *Broker {
+	return &Broker{
+		buffer: buffer,
+		subs:   make(map[int]*subscriber),
+	}
+}
+
+// Subscribe returns a channel of transactions for accountID, or for every
+// account when accountID is empty, and a func that cancels the subscription.
+func (b *Broker) Subscribe(accountID string) (<-chan model.Transaction, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+
+	sub := &subscriber{
+		accountID: accountID,
+		ch:        make(chan model.Transaction, b.buffer),
+	}
+	b.subs[id] = sub
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[id]; ok {
+			delete(b.subs, id)
+			close(sub.ch)
+		}
+	}
+}
+
+func (b *Broker) Publish(tx model.Transaction) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, sub := range b.subs {
+		if sub.accountID != "" && sub.accountID != tx.AccountID {
+			continue
+		}
+
+		select {
+		case sub.ch <- tx:
+		default:
+			delete(b.subs, id)
+			close(sub.ch)
+		}
+	}
+}
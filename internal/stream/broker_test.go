@@ -0,0 +1,44 @@
+package stream_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/stream"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker_FiltersByAccount(t *testing.T) {
+	b := stream.NewBroker(4)
+
+	all, cancelAll := b.Subscribe("")
+	defer cancelAll()
+	onlyA, cancelA := b.Subscribe("a")
+	defer cancelA()
+
+	b.Publish(model.NewDepositTransaction("a", 1))
+	b.Publish(model.NewDepositTransaction("b", 2))
+
+	assert.Equal(t, "a", (<-all).AccountID)
+	assert.Equal(t, "b", (<-all).AccountID)
+	assert.Equal(t, "a", (<-onlyA).AccountID)
+	assert.Empty(t, onlyA)
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	b := stream.NewBroker(1)
+
+	ch, cancel := b.Subscribe("")
+	defer cancel()
+
+	b.Publish(model.NewDepositTransaction("a", 1))
+	b.Publish(model.NewDepositTransaction("a", 2))
+
+	tx, ok := <-ch
+	require.True(t, ok)
+	assert.Equal(t, 1.0, tx.Amount)
+
+	_, ok = <-ch
+	assert.False(t, ok)
+}
@@ -0,0 +1,304 @@
+package webhook
+
+import (
+	"bank-app/internal/logging"
+	"bank-app/internal/model"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDeliveryPending is returned by Notifier.Handle while some subscription
+// is still to get the event.
+var ErrDeliveryPending = errors.New("webhook delivery pending")
+
+const (
+	SignatureHeader = "X-Bank-Signature"
+	EventHeader     = "X-Bank-Event"
+	DeliveryHeader  = "X-Bank-Delivery"
+)
+
+// Payload is the body posted to subscribers. It carries the transaction
+// only, whose JSON names are unchanged by data format version 2; events
+// that embed an account are not posted, so the renamed account fields of
+// that version (see model.Account) do not show up here.
+type Payload struct {
+	EventID     string            `json:"event_id"`
+	EventType   model.EventType   `json:"event_type"`
+	AccountID   string            `json:"account_id"`
+	OccurredAt  time.Time         `json:"occurred_at"`
+	Transaction model.Transaction `json:"transaction"`
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of the raw body under the subscription secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Notifier is an outbox handler that posts money movements to subscribers.
+// Every call makes at most one attempt per subscription and returns an
+// error while some subscription is still owed the event, so that the
+// dispatcher calls again later; no call waits out a backoff. A subscription
+// that got the event is not posted it again, and one whose attempts ran
+// out is parked in the dead-letter list.
+type Notifier struct {
+	store       *Store
+	client      *http.Client
+	logger      *slog.Logger
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+
+	mu         sync.Mutex
+	deliveries map[string]map[string]*delivery
+}
+
+// delivery is the progress of one event to one subscription.
+type delivery struct {
+	attempts int
+	nextTry  time.Time
+	done     bool
+	// posting is set while a call posts the event, so that another call
+	// for the same event does not post it too.
+	posting bool
+}
+
+type Option func(*Notifier)
+
+func WithHTTPClient(c *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = c
+	}
+}
+
+// WithRetry sets how many attempts a subscription gets and how long to wait
+// between them, doubling from base up to max.
+func WithRetry(maxAttempts int, base, max time.Duration) Option {
+	return func(n *Notifier) {
+		n.maxAttempts = maxAttempts
+		n.baseBackoff = base
+		n.maxBackoff = max
+	}
+}
+
+// WithLogger sets where failures that are not returned, such as a dead
+// letter that could not be saved, are logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(n *Notifier) {
+		n.logger = logger
+	}
+}
+
+func NewNotifier(store *Store, opts ...Option) *Notifier {
+	n := &Notifier{
+		store:       store,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		logger:      logging.Discard(),
+		maxAttempts: 5,
+		baseBackoff: time.Second,
+		maxBackoff:  30 * time.Second,
+		now:         time.Now,
+		deliveries:  make(map[string]map[string]*delivery),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n
+}
+
+func (n *Notifier) Handle(ctx context.Context, e model.Event) error {
+	if e.Transaction == nil {
+		return nil
+	}
+
+	subs, err := n.store.List()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(Payload{
+		EventID:     e.ID,
+		EventType:   e.Type,
+		AccountID:   e.AccountID,
+		OccurredAt:  e.OccurredAt,
+		Transaction: *e.Transaction,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+
+	due, owed := n.claim(e, subs)
+
+	// Receivers may take their time, so the posts run without the lock:
+	// claim marked the deliveries as in flight.
+	errs := make([]error, len(due))
+	for i, sub := range due {
+		if errs[i] = ctx.Err(); errs[i] == nil {
+			errs[i] = n.post(ctx, sub, e, body)
+		}
+	}
+
+	dead, owed := n.record(ctx, e, due, errs, body, owed)
+	for _, letter := range dead {
+		if err := n.store.AddDeadLetter(letter); err != nil {
+			n.logger.Error("save webhook dead letter failed",
+				slog.String("subscription_id", letter.SubscriptionID),
+				slog.String("event_id", e.ID),
+				slog.Any("error", err))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if owed > 0 {
+		return fmt.Errorf("%w: %d subscriptions not reached yet", ErrDeliveryPending, owed)
+	}
+	return nil
+}
+
+// claim returns the subscriptions to post e to now and marks them in
+// flight, together with the number of others still owed it.
+func (n *Notifier) claim(e model.Event, subs []Subscription) ([]Subscription, int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	progress := n.deliveries[e.ID]
+	if progress == nil {
+		progress = make(map[string]*delivery)
+		n.deliveries[e.ID] = progress
+	}
+
+	var due []Subscription
+	owed := 0
+	for _, sub := range subs {
+		if !sub.Matches(e) {
+			continue
+		}
+		d := progress[sub.ID]
+		if d == nil {
+			d = &delivery{}
+			progress[sub.ID] = d
+		}
+
+		switch {
+		case d.done:
+		case d.posting || n.now().Before(d.nextTry):
+			owed++
+		default:
+			d.posting = true
+			due = append(due, sub)
+		}
+	}
+
+	return due, owed
+}
+
+// record takes the results of the posts to due and returns the dead letters
+// to save and owed, the number of other subscriptions still owed e, plus
+// those of due that still are. The progress of e is forgotten once no
+// subscription is owed it and none is being posted it.
+func (n *Notifier) record(ctx context.Context, e model.Event, due []Subscription,
+	errs []error, body []byte, owed int) ([]DeadLetter, int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	progress := n.deliveries[e.ID]
+	var dead []DeadLetter
+	for i, sub := range due {
+		d := progress[sub.ID]
+		d.posting = false
+
+		switch {
+		case errs[i] == nil:
+			d.done = true
+		case ctx.Err() != nil:
+			// Cancelled rather than refused: not an attempt.
+			owed++
+		default:
+			d.attempts++
+			if d.attempts < n.maxAttempts {
+				d.nextTry = n.now().Add(n.backoff(d.attempts))
+				owed++
+				continue
+			}
+
+			// The event is not posted to this subscription again either
+			// way: failing here would only repeat it to those that already
+			// got it.
+			d.done = true
+			dead = append(dead, DeadLetter{
+				SubscriptionID: sub.ID,
+				URL:            sub.URL,
+				EventID:        e.ID,
+				Payload:        body,
+				Attempts:       d.attempts,
+				LastError:      errs[i].Error(),
+				FailedAt:       time.Now(),
+			})
+		}
+	}
+
+	if owed > 0 {
+		return dead, owed
+	}
+	for _, d := range progress {
+		if d.posting {
+			return dead, owed
+		}
+	}
+	delete(n.deliveries, e.ID)
+	return dead, owed
+}
+
+func (n *Notifier) backoff(attempts int) time.Duration {
+	delay := n.baseBackoff
+	for i := 1; i < attempts && delay < n.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, n.maxBackoff)
+}
+
+func (n *Notifier) post(ctx context.Context, sub Subscription, e model.Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body))
+	req.Header.Set(EventHeader, string(e.Type))
+	req.Header.Set(DeliveryHeader, e.ID)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver responded %s", resp.Status)
+	}
+
+	return nil
+}
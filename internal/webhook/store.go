@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"bank-app/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrInvalidSubscription  = errors.New("invalid subscription")
+)
+
+type Subscription struct {
+	ID         string            `json:"id"`
+	URL        string            `json:"url"`
+	Secret     string            `json:"secret"`
+	EventTypes []model.EventType `json:"event_types,omitempty"`
+	AccountIDs []string          `json:"account_ids,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// Matches reports whether e should be delivered; empty filters match all.
+func (s Subscription) Matches(e model.Event) bool {
+	if len(s.EventTypes) > 0 && !slices.Contains(s.EventTypes, e.Type) {
+		return false
+	}
+	if len(s.AccountIDs) > 0 && !slices.Contains(s.AccountIDs, e.AccountID) {
+		return false
+	}
+
+	return true
+}
+
+type DeadLetter struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	URL            string          `json:"url"`
+	EventID        string          `json:"event_id"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error"`
+	FailedAt       time.Time       `json:"failed_at"`
+}
+
+type storeFile struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	DeadLetters   []DeadLetter   `json:"dead_letters"`
+}
+
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+func (s *Store) Create(sub Subscription) (Subscription, error) {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, fmt.Errorf("%w: url must be absolute http(s)", ErrInvalidSubscription)
+	}
+	if sub.Secret == "" {
+		return Subscription{}, fmt.Errorf("%w: empty secret", ErrInvalidSubscription)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.loadUnsafe()
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = time.Now()
+	file.Subscriptions = append(file.Subscriptions, sub)
+
+	if err := s.writeUnsafe(file); err != nil {
+		return Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+func (s *Store) List() ([]Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.loadUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	return file.Subscriptions, nil
+}
+
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.loadUnsafe()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(file.Subscriptions, func(sub Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
+	}
+	file.Subscriptions = slices.Delete(file.Subscriptions, i, i+1)
+
+	return s.writeUnsafe(file)
+}
+
+func (s *Store) AddDeadLetter(dl DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.loadUnsafe()
+	if err != nil {
+		return err
+	}
+
+	dl.ID = uuid.New().String()
+	file.DeadLetters = append(file.DeadLetters, dl)
+
+	return s.writeUnsafe(file)
+}
+
+func (s *Store) DeadLetters() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.loadUnsafe()
+	if err != nil {
+		return nil, err
+	}
+
+	return file.DeadLetters, nil
+}
+
+func (s *Store) loadUnsafe() (*storeFile, error) {
+	file := &storeFile{
+		Subscriptions: []Subscription{},
+		DeadLetters:   []DeadLetter{},
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read webhooks file: %w", err)
+	}
+	if len(data) == 0 {
+		return file, nil
+	}
+
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("corrupted webhooks file: %w", err)
+	}
+
+	return file, nil
+}
+
+func (s *Store) writeUnsafe(file *storeFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal webhooks: %w", err)
+	}
+
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write webhooks file: %w", err)
+	}
+
+	return nil
+}
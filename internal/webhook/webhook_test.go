@@ -0,0 +1,255 @@
+package webhook_test
+
+import (
+	"bank-app/internal/model"
+	"bank-app/internal/webhook"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	payloads []webhook.Payload
+	valid    []bool
+}
+
+func (rc *receiver) handler(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+
+		if rc.failures > 0 {
+			rc.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var p webhook.Payload
+		json.Unmarshal(body, &p)
+		rc.payloads = append(rc.payloads, p)
+		rc.valid = append(rc.valid, webhook.Verify(secret, body, r.Header.Get(webhook.SignatureHeader)))
+	}
+}
+
+func newNotifier(t *testing.T) (*webhook.Store, *webhook.Notifier) {
+	t.Helper()
+
+	store := webhook.NewStore(filepath.Join(t.TempDir(), "webhooks.json"))
+	notifier := webhook.NewNotifier(store, webhook.WithRetry(3, time.Millisecond, 4*time.Millisecond))
+
+	return store, notifier
+}
+
+// handleUntilDone calls Handle the way the outbox dispatcher would, again
+// for as long as some subscription is still owed the event.
+func handleUntilDone(t *testing.T, notifier *webhook.Notifier, e model.Event) {
+	t.Helper()
+
+	for range 100 {
+		err := notifier.Handle(context.Background(), e)
+		if err == nil {
+			return
+		}
+		require.ErrorIs(t, err, webhook.ErrDeliveryPending)
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("event still pending after 100 calls")
+}
+
+func TestNotifier_DeliversSignedPayload(t *testing.T) {
+	store, notifier := newNotifier(t)
+
+	rc := &receiver{failures: 2}
+	srv := httptest.NewServer(rc.handler("s3cret"))
+	defer srv.Close()
+
+	_, err := store.Create(webhook.Subscription{URL: srv.URL, Secret: "s3cret"})
+	require.NoError(t, err)
+
+	tx := model.NewDepositTransaction("a", 25)
+	e := model.NewTransactionEvent(tx)
+	require.ErrorIs(t, notifier.Handle(context.Background(), e), webhook.ErrDeliveryPending,
+		"a failed attempt is retried on a later call, not waited for")
+	handleUntilDone(t, notifier, e)
+
+	require.Len(t, rc.payloads, 1)
+	assert.True(t, rc.valid[0])
+	assert.Equal(t, model.MoneyDeposited, rc.payloads[0].EventType)
+	assert.Equal(t, tx.ID, rc.payloads[0].Transaction.ID)
+	assert.Equal(t, 25.0, rc.payloads[0].Transaction.Amount)
+
+	letters, err := store.DeadLetters()
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestNotifier_DeadLettersAfterRetries(t *testing.T) {
+	store, notifier := newNotifier(t)
+
+	rc := &receiver{failures: 100}
+	srv := httptest.NewServer(rc.handler("s3cret"))
+	defer srv.Close()
+
+	sub, err := store.Create(webhook.Subscription{URL: srv.URL, Secret: "s3cret"})
+	require.NoError(t, err)
+
+	e := model.NewTransactionEvent(model.NewWithdrawTransaction("a", 5))
+	handleUntilDone(t, notifier, e)
+
+	letters, err := store.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, sub.ID, letters[0].SubscriptionID)
+	assert.Equal(t, e.ID, letters[0].EventID)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Contains(t, letters[0].LastError, "503")
+	assert.Equal(t, 97, rc.failures)
+}
+
+func TestNotifier_DeliversOncePerSubscription(t *testing.T) {
+	store, notifier := newNotifier(t)
+
+	ok := &receiver{}
+	okSrv := httptest.NewServer(ok.handler("k"))
+	defer okSrv.Close()
+	failing := &receiver{failures: 2}
+	failingSrv := httptest.NewServer(failing.handler("k"))
+	defer failingSrv.Close()
+
+	for _, url := range []string{okSrv.URL, failingSrv.URL} {
+		_, err := store.Create(webhook.Subscription{URL: url, Secret: "k"})
+		require.NoError(t, err)
+	}
+
+	e := model.NewTransactionEvent(model.NewDepositTransaction("a", 1))
+	handleUntilDone(t, notifier, e)
+
+	assert.Len(t, ok.payloads, 1, "the retries of one subscription do not repeat the event to another")
+	assert.Len(t, failing.payloads, 1)
+}
+
+func TestNotifier_LogsDeadLetterFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "webhooks.json")
+	store := webhook.NewStore(path)
+	var logs bytes.Buffer
+	notifier := webhook.NewNotifier(store,
+		webhook.WithRetry(1, time.Millisecond, time.Millisecond),
+		webhook.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	ok := &receiver{}
+	okSrv := httptest.NewServer(ok.handler("k"))
+	defer okSrv.Close()
+	// The failing receiver also makes the webhooks file unreadable, so the
+	// dead letter cannot be saved.
+	failingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		os.Rename(path, path+".moved")
+		os.Mkdir(path, 0755)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failingSrv.Close()
+
+	for _, url := range []string{okSrv.URL, failingSrv.URL} {
+		_, err := store.Create(webhook.Subscription{URL: url, Secret: "k"})
+		require.NoError(t, err)
+	}
+
+	e := model.NewTransactionEvent(model.NewDepositTransaction("a", 1))
+	require.NoError(t, notifier.Handle(context.Background(), e),
+		"an error would make the dispatcher repeat the event to every subscription")
+	assert.Len(t, ok.payloads, 1)
+	assert.Contains(t, logs.String(), "save webhook dead letter failed")
+}
+
+func TestNotifier_SlowReceiverDoesNotHoldOtherEvents(t *testing.T) {
+	store, notifier := newNotifier(t)
+
+	slow := model.NewTransactionEvent(model.NewDepositTransaction("a", 1))
+	fast := model.NewTransactionEvent(model.NewDepositTransaction("b", 1))
+	arrived, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(webhook.DeliveryHeader) == slow.ID {
+			close(arrived)
+			<-release
+		}
+	}))
+	defer srv.Close()
+
+	_, err := store.Create(webhook.Subscription{URL: srv.URL, Secret: "k"})
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- notifier.Handle(context.Background(), slow) }()
+	<-arrived
+
+	require.ErrorIs(t, notifier.Handle(context.Background(), slow), webhook.ErrDeliveryPending,
+		"an event being posted is not posted again")
+	require.NoError(t, notifier.Handle(context.Background(), fast))
+
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func TestNotifier_Filters(t *testing.T) {
+	store, notifier := newNotifier(t)
+
+	rc := &receiver{}
+	srv := httptest.NewServer(rc.handler("k"))
+	defer srv.Close()
+
+	_, err := store.Create(webhook.Subscription{
+		URL:        srv.URL,
+		Secret:     "k",
+		EventTypes: []model.EventType{model.MoneyWithdrawn},
+		AccountIDs: []string{"a"},
+	})
+	require.NoError(t, err)
+
+	events := []model.Event{
+		model.NewTransactionEvent(model.NewDepositTransaction("a", 1)),
+		model.NewTransactionEvent(model.NewWithdrawTransaction("b", 1)),
+		model.NewAccountOpenedEvent(model.Account{ID: "a"}),
+		model.NewTransactionEvent(model.NewWithdrawTransaction("a", 3)),
+	}
+	for _, e := range events {
+		require.NoError(t, notifier.Handle(context.Background(), e))
+	}
+
+	require.Len(t, rc.payloads, 1)
+	assert.Equal(t, events[3].ID, rc.payloads[0].EventID)
+}
+
+func TestStore_Subscriptions(t *testing.T) {
+	store := webhook.NewStore(filepath.Join(t.TempDir(), "webhooks.json"))
+
+	_, err := store.Create(webhook.Subscription{URL: "ftp://example.com", Secret: "k"})
+	require.ErrorIs(t, err, webhook.ErrInvalidSubscription)
+	_, err = store.Create(webhook.Subscription{URL: "https://example.com/hook"})
+	require.ErrorIs(t, err, webhook.ErrInvalidSubscription)
+
+	sub, err := store.Create(webhook.Subscription{URL: "https://example.com/hook", Secret: "k"})
+	require.NoError(t, err)
+
+	subs, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+
+	require.NoError(t, store.Delete(sub.ID))
+	require.ErrorIs(t, store.Delete(sub.ID), webhook.ErrSubscriptionNotFound)
+}